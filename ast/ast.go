@@ -16,13 +16,18 @@ type Typedef struct {
 	Node MetaNode
 }
 
-// Func represents a global function definition with it's body.
+// Func represents a global function definition with it's body. Generic
+// functions have type parameters, which the arguments and return type may refer
+// to. Methods have the name of the structure they are defined on as Recv, and
+// take a value of that structure as their first argument.
 type Func struct {
-	Name string
-	Args []types.Descriptor
-	Ret  types.Type
-	Body Block
-	Node MetaNode
+	Name   string
+	Recv   string
+	Params []string
+	Args   []types.Descriptor
+	Ret    types.Type
+	Body   Block
+	Node   MetaNode
 }
 
 // Extern represents a global external function with an unknown body.
@@ -34,13 +39,31 @@ type Extern struct {
 	Node  MetaNode
 }
 
-// Structure represents a global structure type definition.
+// Structure represents a global structure type definition. Generic structures
+// have type parameters, which the fields may refer to.
 type Structure struct {
 	Name   string
+	Params []string
 	Fields []types.Descriptor
 	Node   MetaNode
 }
 
+// Union represents a global tagged union type definition. Like structures,
+// unions may be generic.
+type Union struct {
+	Name     string
+	Params   []string
+	Variants []types.Descriptor
+	Node     MetaNode
+}
+
+// Alias represents a global type alias definition.
+type Alias struct {
+	Name string
+	Type types.Type
+	Node MetaNode
+}
+
 // AST is the complete Abstract Syntax Tree of a Skol source file.
 type AST struct {
 	Vars     map[string]Var
@@ -48,6 +71,10 @@ type AST struct {
 	Funcs    map[string]Func
 	Exerns   map[string]Extern
 	Structs  map[string]Structure
+	Unions   map[string]Union
+	// Methods holds the methods of every structure by the structure's name
+	Methods map[string]map[string]Func
+	Aliases map[string]Alias
 }
 
 func NewAST() AST {
@@ -57,5 +84,8 @@ func NewAST() AST {
 		Funcs:    make(map[string]Func),
 		Exerns:   make(map[string]Extern),
 		Structs:  make(map[string]Structure),
+		Unions:   make(map[string]Union),
+		Methods:  make(map[string]map[string]Func),
+		Aliases:  make(map[string]Alias),
 	}
 }
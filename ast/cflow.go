@@ -1,12 +1,15 @@
 package ast
 
-import "github.com/syzkrash/skol/lexer"
+import (
+	"github.com/syzkrash/skol/lexer"
+	"github.com/syzkrash/skol/parser/values/types"
+)
 
 // Branch represents the condition and body of an if statement branch.
 type Branch struct {
 	Cond  MetaNode
 	Block Block
-	Pos   lexer.Position
+	Pos   lexer.Span
 }
 
 // IfNode represents an if statement. Contains the main branch, any other
@@ -34,6 +37,40 @@ func (WhileNode) Kind() NodeKind {
 	return NWhile
 }
 
+// ForEachNode represents a loop over the elements of an array or the
+// characters of a string. The index variable is optional.
+type ForEachNode struct {
+	Index string
+	Elem  string
+	Iter  MetaNode
+	Block Block
+}
+
+var _ Node = ForEachNode{}
+
+func (ForEachNode) Kind() NodeKind {
+	return NForEach
+}
+
+// BreakNode represents a break statement, leaving the innermost loop.
+type BreakNode struct{}
+
+var _ Node = BreakNode{}
+
+func (BreakNode) Kind() NodeKind {
+	return NBreak
+}
+
+// ContinueNode represents a continue statement, skipping to the next iteration
+// of the innermost loop.
+type ContinueNode struct{}
+
+var _ Node = ContinueNode{}
+
+func (ContinueNode) Kind() NodeKind {
+	return NContinue
+}
+
 type ReturnNode struct {
 	Value MetaNode
 }
@@ -43,3 +80,74 @@ var _ Node = ReturnNode{}
 func (ReturnNode) Kind() NodeKind {
 	return NReturn
 }
+
+// PatternKind is the kind of value a [Pattern] matches.
+type PatternKind byte
+
+// Pattern kind constants.
+const (
+	// PatBind matches any value, binding it to a variable unless the name is
+	// empty.
+	PatBind PatternKind = iota
+	// PatLiteral matches a value equal to a literal.
+	PatLiteral
+	// PatStruct matches a structure whose fields match the field patterns.
+	PatStruct
+	// PatVariant matches a variant of a tagged union whose payload matches the
+	// payload pattern, if there is one.
+	PatVariant
+)
+
+// Pattern represents the pattern of a match statement arm.
+type Pattern struct {
+	Kind PatternKind
+	// Bind is the name of the variable of a [PatBind] pattern.
+	Bind string
+	// Value is the literal of a [PatLiteral] pattern.
+	Value MetaNode
+	// Type is the structure or union type of a [PatStruct] or [PatVariant]
+	// pattern.
+	Type types.Type
+	// Variant is the union variant of a [PatVariant] pattern.
+	Variant string
+	// Fields contains the field patterns of a [PatStruct] pattern, or the
+	// payload pattern of a [PatVariant] pattern, if there is one.
+	Fields []Pattern
+	Where  lexer.Span
+}
+
+// Irrefutable returns true if this pattern matches every value of it's type.
+func (p Pattern) Irrefutable() bool {
+	switch p.Kind {
+	case PatBind:
+		return true
+	case PatStruct:
+		for _, f := range p.Fields {
+			if !f.Irrefutable() {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// MatchArm represents one arm of a match statement.
+type MatchArm struct {
+	Pattern Pattern
+	Block   Block
+}
+
+// MatchNode represents a match statement. The block of the first arm whose
+// pattern matches the value is executed.
+type MatchNode struct {
+	Value MetaNode
+	Arms  []MatchArm
+}
+
+var _ Node = MatchNode{}
+
+func (MatchNode) Kind() NodeKind {
+	return NMatch
+}
@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"bytes"
+	"hash/crc32"
 	"io"
 
 	"github.com/syzkrash/skol/common/pack"
@@ -9,55 +11,147 @@ import (
 	"github.com/syzkrash/skol/parser/values/types"
 )
 
+// decoder wraps an Unpacker with the version of the format being decoded.
+// Versions 1 and 2 of the format use 8-bit counts, string lengths and
+// characters as well as 32-bit positions, whereas later versions use
+// variable-length ints for all of these.
+type decoder struct {
+	*pack.Unpacker
+	ver byte
+}
+
+// count reads the amount of elements in a section or slice
+func (u *decoder) count() uint64 {
+	if u.ver < 3 {
+		return uint64(u.U8())
+	}
+	return u.UVarint()
+}
+
+// str reads a length-prefixed string
+func (u *decoder) str() string {
+	if u.ver < 3 {
+		return u.Str()
+	}
+	return u.VStr()
+}
+
+// uint reads an unsigned int that was 32-bit in versions 1 and 2 of the format
+func (u *decoder) uint() uint {
+	if u.ver < 3 {
+		return uint(u.U32())
+	}
+	return uint(u.UVarint())
+}
+
+// ok returns false if any error has occurred while decoding, used to stop
+// decoding long sections early
+func (u *decoder) ok() bool {
+	return len(u.Err) == 0
+}
+
 // Decode reads a binary representation of an AST and returns it. This function
 // assumes the input data begins with the [FormatMagic] string, followed by a
 // one-byte version of the format. See [FormatVersion] for the current version.
+// Any version since [MinFormatVersion] can be decoded.
 func Decode(src io.Reader) (tree AST, err error) {
-	u := pack.NewUnpacker(src)
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return
+	}
 
-	magic := u.Bytes(uint(len(FormatMagic)))
-	if string(magic) != FormatMagic {
+	hdrLen := len(FormatMagic) + 1
+	if len(data) < hdrLen || string(data[:len(FormatMagic)]) != FormatMagic {
 		err = pe.New(pe.EBadMagic)
 		return
 	}
-	ver := u.U8()
-	if ver != FormatVersion {
-		err = pe.New(pe.EBadEncoderVer).Section("Caused By", "%02X at $%08X", ver, u.Offset-1)
+	ver := data[hdrLen-1]
+	if ver < MinFormatVersion || ver > FormatVersion {
+		err = pe.New(pe.EBadEncoderVer).Section("Caused By", "%02X at $%08X", ver, hdrLen-1)
 		return
 	}
 
+	body := data[hdrLen:]
+	if ver >= 3 {
+		if len(body) < 4 {
+			err = pe.New(pe.EBadChecksum).Section("Caused By", "Missing checksum")
+			return
+		}
+		sumAt := len(body) - 4
+		want := pack.NewUnpacker(bytes.NewReader(body[sumAt:])).U32()
+		body = body[:sumAt]
+		if got := crc32.ChecksumIEEE(body); got != want {
+			err = pe.New(pe.EBadChecksum).Section("Caused By", "Expected %08X, got %08X", want, got)
+			return
+		}
+	}
+
+	u := &decoder{
+		Unpacker: pack.NewUnpacker(bytes.NewReader(body)),
+		ver:      ver,
+	}
+
 	tree = NewAST()
 
-	count := u.U8()
-	for i := uint8(0); i < count; i++ {
+	count := u.count()
+	for i := uint64(0); i < count && u.ok(); i++ {
 		v := decodeVar(u)
 		tree.Vars[v.Name] = v
 	}
 
-	count = u.U8()
-	for i := uint8(0); i < count; i++ {
+	count = u.count()
+	for i := uint64(0); i < count && u.ok(); i++ {
 		t := decodeTypedef(u)
 		tree.Typedefs[t.Name] = t
 	}
 
-	count = u.U8()
-	for i := uint8(0); i < count; i++ {
+	count = u.count()
+	for i := uint64(0); i < count && u.ok(); i++ {
 		f := decodeFunc(u)
 		tree.Funcs[f.Name] = f
 	}
 
-	count = u.U8()
-	for i := uint8(0); i < count; i++ {
+	count = u.count()
+	for i := uint64(0); i < count && u.ok(); i++ {
 		e := decodeExtern(u)
 		tree.Exerns[e.Alias] = e
 	}
 
-	count = u.U8()
-	for i := uint8(0); i < count; i++ {
+	count = u.count()
+	for i := uint64(0); i < count && u.ok(); i++ {
 		s := decodeStruct(u)
 		tree.Structs[s.Name] = s
 	}
 
+	if ver >= 5 {
+		count = u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			un := decodeUnion(u)
+			tree.Unions[un.Name] = un
+		}
+	}
+
+	if ver >= 6 {
+		count = u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			recv := u.str()
+			m := decodeFunc(u)
+			m.Recv = recv
+			if tree.Methods[recv] == nil {
+				tree.Methods[recv] = make(map[string]Func)
+			}
+			tree.Methods[recv][m.Name] = m
+		}
+	}
+
+	if ver >= 7 {
+		count = u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			a := decodeAlias(u)
+			tree.Aliases[a.Name] = a
+		}
+	}
+
 	if len(u.Err) > 0 {
 		err = u.Err[0]
 	}
@@ -65,52 +159,111 @@ func Decode(src io.Reader) (tree AST, err error) {
 	return
 }
 
-func decodeVar(u *pack.Unpacker) (v Var) {
-	v.Name = u.Str()
+func decodeVar(u *decoder) (v Var) {
+	v.Name = u.str()
 	v.Value = decodeNode(u)
 	return
 }
 
-func decodeTypedef(u *pack.Unpacker) (t Typedef) {
-	t.Name = u.Str()
+func decodeTypedef(u *decoder) (t Typedef) {
+	t.Name = u.str()
 	t.Type = decodeType(u)
 	return
 }
 
-func decodeFunc(u *pack.Unpacker) (f Func) {
-	f.Name = u.Str()
+func decodeFunc(u *decoder) (f Func) {
+	f.Name = u.str()
+	f.Params = decodeParams(u)
 	f.Ret = decodeType(u)
 	f.Args = decodeDescriptorSlice(u)
 	f.Body = decodeNodeSlice(u)
 	return
 }
 
-func decodeExtern(u *pack.Unpacker) (e Extern) {
-	e.Alias = u.Str()
-	e.Name = u.Str()
+func decodeExtern(u *decoder) (e Extern) {
+	e.Alias = u.str()
+	e.Name = u.str()
 	e.Ret = decodeType(u)
 	e.Args = decodeDescriptorSlice(u)
 	return
 }
 
-func decodeStruct(u *pack.Unpacker) (s Structure) {
-	s.Name = u.Str()
+func decodeStruct(u *decoder) (s Structure) {
+	s.Name = u.str()
+	s.Params = decodeParams(u)
 	s.Fields = decodeDescriptorSlice(u)
 	return
 }
 
-func decodeNode(u *pack.Unpacker) (mn MetaNode) {
-	mn.Where = decodePos(u)
+func decodeUnion(u *decoder) (un Union) {
+	un.Name = u.str()
+	un.Params = decodeParams(u)
+	un.Variants = decodeDescriptorSlice(u)
+	return
+}
+
+func decodeAlias(u *decoder) (a Alias) {
+	a.Name = u.str()
+	a.Type = decodeType(u)
+	return
+}
+
+// nodeSince is the version of the format each node kind was added in. Kinds
+// that are not listed are part of every version.
+var nodeSince = map[NodeKind]byte{
+	NVariant:      5,
+	NMethodCall:   6,
+	NBad:          8,
+	NFuncRef:      9,
+	NLambda:       9,
+	NMatch:        10,
+	NForEach:      11,
+	NBreak:        11,
+	NContinue:     11,
+	NMap:          12,
+	NSelectorSet:  13,
+	NStructUpdate: 14,
+	NTry:          15,
+	NInterp:       16,
+	NTuple:        17,
+	NDestructure:  17,
+	NFuncDef:      18,
+}
+
+// primSince is the version of the format each type primitive was added in.
+// Primitives that are not listed are part of every version.
+var primSince = map[types.Primitive]byte{
+	types.PParam: 4,
+	types.PUnion: 5,
+	types.PAlias: 7,
+	types.PFunc:  9,
+	types.PMap:   12,
+	types.PTuple: 17,
+}
+
+func decodeNode(u *decoder) (mn MetaNode) {
+	mn.Where = decodeSpan(u)
 	k := NodeKind(u.U8())
 
+	if since, ok := nodeSince[k]; ok && u.ver < since {
+		u.Error(pe.New(pe.EBadNodeKind).Section("Caused By", "%02X at $%08X", k, u.Offset-1).Section("Added In", "Version %d", since))
+		return
+	}
+
 	switch k {
 	case NBool:
 		mn.Node = BoolNode{
 			Value: u.U8() > 0,
 		}
 	case NChar:
+		var c rune
+		if u.ver < 3 {
+			c = rune(u.U8())
+		} else {
+			c = rune(u.UVarint())
+		}
 		mn.Node = CharNode{
-			Value: u.U8(),
+			Value: c,
 		}
 	case NInt:
 		mn.Node = IntNode{
@@ -122,8 +275,37 @@ func decodeNode(u *pack.Unpacker) (mn MetaNode) {
 		}
 	case NString:
 		mn.Node = StringNode{
-			Value: u.Str(),
+			Value: u.str(),
+		}
+	case NInterp:
+		in := InterpNode{}
+		count := u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			in.Parts = append(in.Parts, u.str())
 		}
+		in.Values = decodeNodeSlice(u)
+		mn.Node = in
+	case NStruct:
+		t := decodeType(u)
+		a := decodeNodeSlice(u)
+		st, _ := t.(types.StructType)
+		mn.Node = StructNode{
+			Type: st,
+			Args: a,
+		}
+	case NStructUpdate:
+		t := decodeType(u)
+		st, _ := t.(types.StructType)
+		sun := StructUpdateNode{
+			Type: st,
+			Base: decodeNode(u),
+		}
+		count := u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			sun.Fields = append(sun.Fields, u.str())
+		}
+		sun.Values = decodeNodeSlice(u)
+		mn.Node = sun
 	case NArray:
 		t := decodeType(u)
 		e := decodeNodeSlice(u)
@@ -134,6 +316,22 @@ func decodeNode(u *pack.Unpacker) (mn MetaNode) {
 			Elems: e,
 		}
 
+	case NTuple:
+		mn.Node = TupleNode{
+			Elems: decodeNodeSlice(u),
+		}
+
+	case NMap:
+		t := decodeType(u)
+		k := decodeNodeSlice(u)
+		v := decodeNodeSlice(u)
+		mt, _ := t.(types.MapType)
+		mn.Node = MapNode{
+			Type:   mt,
+			Keys:   k,
+			Values: v,
+		}
+
 	case NIf:
 		m := decodeBranch(u)
 		o := decodeBranchSlice(u)
@@ -155,23 +353,62 @@ func decodeNode(u *pack.Unpacker) (mn MetaNode) {
 		mn.Node = ReturnNode{
 			Value: v,
 		}
+	case NForEach:
+		i := u.str()
+		e := u.str()
+		it := decodeNode(u)
+		b := decodeNodeSlice(u)
+		mn.Node = ForEachNode{
+			Index: i,
+			Elem:  e,
+			Iter:  it,
+			Block: b,
+		}
+	case NBreak:
+		mn.Node = BreakNode{}
+	case NContinue:
+		mn.Node = ContinueNode{}
+	case NMatch:
+		v := decodeNode(u)
+		count := u.count()
+		arms := []MatchArm{}
+		for i := uint64(0); i < count && u.ok(); i++ {
+			p := decodePattern(u)
+			b := decodeNodeSlice(u)
+			arms = append(arms, MatchArm{
+				Pattern: p,
+				Block:   b,
+			})
+		}
+		mn.Node = MatchNode{
+			Value: v,
+			Arms:  arms,
+		}
 
 	case NVarSet:
-		n := u.Str()
+		n := u.str()
 		v := decodeNode(u)
 		mn.Node = VarSetNode{
 			Var:   n,
 			Value: v,
 		}
+	case NDestructure:
+		dn := DestructureNode{}
+		count := u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			dn.Vars = append(dn.Vars, u.str())
+		}
+		dn.Value = decodeNode(u)
+		mn.Node = dn
 	case NVarDef:
-		n := u.Str()
+		n := u.str()
 		t := decodeType(u)
 		mn.Node = VarDefNode{
 			Var:  n,
 			Type: t,
 		}
 	case NVarSetTyped:
-		n := u.Str()
+		n := u.str()
 		t := decodeType(u)
 		v := decodeNode(u)
 		mn.Node = VarSetTypedNode{
@@ -179,14 +416,78 @@ func decodeNode(u *pack.Unpacker) (mn MetaNode) {
 			Type:  t,
 			Value: v,
 		}
+	case NFuncDef:
+		n := u.str()
+		r := decodeType(u)
+		p := decodeDescriptorSlice(u)
+		b := decodeNodeSlice(u)
+		mn.Node = FuncDefNode{
+			Name:  n,
+			Proto: p,
+			Ret:   r,
+			Body:  b,
+		}
+
+	case NSelectorSet:
+		t := decodeSelectorRef(u)
+		v := decodeNode(u)
+		mn.Node = SelectorSetNode{
+			Target: t,
+			Value:  v,
+		}
+
+	case NSelector, NTypecast, NIndexConst, NIndexSelector:
+		mn.Node = decodeSelector(u, k)
 
 	case NFuncCall:
-		n := u.Str()
+		n := u.str()
 		a := decodeNodeSlice(u)
 		mn.Node = FuncCallNode{
 			Func: n,
 			Args: a,
 		}
+	case NMethodCall:
+		r := decodeNode(u)
+		t := u.str()
+		m := u.str()
+		a := decodeNodeSlice(u)
+		mn.Node = MethodCallNode{
+			Recv:   r,
+			Type:   t,
+			Method: m,
+			Args:   a,
+		}
+	case NTry:
+		mn.Node = TryNode{
+			Value: decodeNode(u),
+		}
+
+	case NBad:
+		mn.Node = BadNode{}
+	case NFuncRef:
+		mn.Node = FuncRefNode{
+			Func: u.str(),
+		}
+	case NLambda:
+		p := decodeDescriptorSlice(u)
+		r := decodeType(u)
+		b := decodeNodeSlice(u)
+		mn.Node = LambdaNode{
+			Proto: p,
+			Ret:   r,
+			Body:  b,
+		}
+	case NVariant:
+		t := decodeType(u)
+		ut, _ := t.(types.UnionType)
+		vn := VariantNode{
+			Type:    ut,
+			Variant: u.str(),
+		}
+		if u.U8() > 0 {
+			vn.Value = decodeNode(u)
+		}
+		mn.Node = vn
 
 	default:
 		u.Error(pe.New(pe.EBadNodeKind).Section("Caused By", "%02X at $%08X", k, u.Offset-1))
@@ -195,18 +496,72 @@ func decodeNode(u *pack.Unpacker) (mn MetaNode) {
 	return
 }
 
-func decodeNodeSlice(u *pack.Unpacker) (mns []MetaNode) {
-	count := u.U8()
-	mns = make([]MetaNode, count)
-	for i := uint8(0); i < count; i++ {
-		mns[i] = decodeNode(u)
+func decodeNodeSlice(u *decoder) (mns []MetaNode) {
+	count := u.count()
+	mns = []MetaNode{}
+	for i := uint64(0); i < count && u.ok(); i++ {
+		mns = append(mns, decodeNode(u))
+	}
+	return
+}
+
+// decodeSelector reads a selector node of the given kind. See
+// [encodeSelector].
+func decodeSelector(u *decoder, k NodeKind) (s Selector) {
+	switch k {
+	case NSelector:
+		p := decodeSelectorRef(u)
+		c := u.str()
+		s = SelectorNode{
+			Parent: p,
+			Child:  c,
+		}
+	case NTypecast:
+		p := decodeSelectorRef(u)
+		t := decodeType(u)
+		s = TypecastNode{
+			Parent: p,
+			Cast:   t,
+		}
+	case NIndexConst:
+		p := decodeSelectorRef(u)
+		i := u.Varint()
+		s = IndexConstNode{
+			Parent: p,
+			Idx:    int(i),
+		}
+	case NIndexSelector:
+		p := decodeSelectorRef(u)
+		i := decodeSelectorRef(u)
+		s = IndexSelectorNode{
+			Parent: p,
+			Idx:    i,
+		}
+	default:
+		u.Error(pe.New(pe.EBadNodeKind).Section("Caused By", "%02X at $%08X", k, u.Offset-1))
 	}
 	return
 }
 
-func decodeType(u *pack.Unpacker) (t types.Type) {
+// decodeSelectorRef reads a selector preceded by it's kind. See
+// [encodeSelectorRef].
+func decodeSelectorRef(u *decoder) Selector {
+	k := NodeKind(u.U8())
+	if k == NInvalid || !u.ok() {
+		return nil
+	}
+	return decodeSelector(u, k)
+}
+
+func decodeType(u *decoder) (t types.Type) {
 	p := types.Primitive(u.U8())
 
+	if since, ok := primSince[p]; ok && u.ver < since {
+		t = types.Undefined
+		u.Error(pe.New(pe.EBadTypePrim).Section("Caused By", "%02X at $%08X", p, u.Offset-1).Section("Added In", "Version %d", since))
+		return
+	}
+
 	switch p {
 	case types.PBool:
 		t = types.Bool
@@ -219,12 +574,16 @@ func decodeType(u *pack.Unpacker) (t types.Type) {
 	case types.PString:
 		t = types.String
 	case types.PStruct:
-		n := u.Str()
-		f := decodeDescriptorSlice(u)
-		t = types.StructType{
-			Name:   n,
-			Fields: f,
+		st := types.StructType{Name: u.str()}
+		st.Params = decodeParams(u)
+		if u.ver >= 4 {
+			count := u.count()
+			for i := uint64(0); i < count && u.ok(); i++ {
+				st.Args = append(st.Args, decodeType(u))
+			}
 		}
+		st.Fields = decodeDescriptorSlice(u)
+		t = st
 	case types.PArray:
 		t = types.ArrayType{
 			Element: decodeType(u),
@@ -235,47 +594,139 @@ func decodeType(u *pack.Unpacker) (t types.Type) {
 		t = types.Nothing
 	case types.PUndefined:
 		t = types.Undefined
+	case types.PParam:
+		t = types.ParamType{Name: u.str()}
+	case types.PUnion:
+		ut := types.UnionType{Name: u.str()}
+		ut.Params = decodeParams(u)
+		count := u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			ut.Args = append(ut.Args, decodeType(u))
+		}
+		ut.Variants = decodeDescriptorSlice(u)
+		t = ut
+	case types.PMap:
+		k := decodeType(u)
+		v := decodeType(u)
+		t = types.MapType{
+			Key:   k,
+			Value: v,
+		}
+	case types.PFunc:
+		ft := types.FuncType{Args: []types.Type{}}
+		count := u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			ft.Args = append(ft.Args, decodeType(u))
+		}
+		ft.Ret = decodeType(u)
+		t = ft
+	case types.PTuple:
+		tt := types.TupleType{}
+		count := u.count()
+		for i := uint64(0); i < count && u.ok(); i++ {
+			tt.Elems = append(tt.Elems, decodeType(u))
+		}
+		t = tt
+	case types.PAlias:
+		n := u.str()
+		t = types.AliasType{
+			Name: n,
+			Type: decodeType(u),
+		}
 
 	default:
-		u.Error(pe.New(pe.EBadTypePrim).Section("Caused By", "%02X at $%08X", p, -1))
+		// keep a valid type around so a malformed AST can't cause a nil pointer
+		// dereference before the error is noticed
+		t = types.Undefined
+		u.Error(pe.New(pe.EBadTypePrim).Section("Caused By", "%02X at $%08X", p, u.Offset-1))
 	}
 
 	return
 }
 
-func decodeDescriptor(u *pack.Unpacker) (d types.Descriptor) {
-	d.Name = u.Str()
+// decodeParams reads the type parameters of a generic function or structure,
+// which were added in version 4 of the format
+func decodeParams(u *decoder) (ps []string) {
+	if u.ver < 4 {
+		return
+	}
+	count := u.count()
+	for i := uint64(0); i < count && u.ok(); i++ {
+		ps = append(ps, u.str())
+	}
+	return
+}
+
+func decodeDescriptor(u *decoder) (d types.Descriptor) {
+	d.Name = u.str()
 	d.Type = decodeType(u)
 	return
 }
 
-func decodeDescriptorSlice(u *pack.Unpacker) (ds []types.Descriptor) {
-	count := u.U8()
-	ds = make([]types.Descriptor, count)
-	for i := uint8(0); i < count; i++ {
-		ds[i] = decodeDescriptor(u)
+func decodeDescriptorSlice(u *decoder) (ds []types.Descriptor) {
+	count := u.count()
+	ds = []types.Descriptor{}
+	for i := uint64(0); i < count && u.ok(); i++ {
+		ds = append(ds, decodeDescriptor(u))
 	}
 	return
 }
 
-func decodeBranch(u *pack.Unpacker) (b Branch) {
+func decodeBranch(u *decoder) (b Branch) {
 	b.Cond = decodeNode(u)
 	b.Block = decodeNodeSlice(u)
 	return
 }
 
-func decodeBranchSlice(u *pack.Unpacker) (bs []Branch) {
-	count := u.U8()
-	bs = make([]Branch, count)
-	for i := uint8(0); i < count; i++ {
-		bs[i] = decodeBranch(u)
+func decodeBranchSlice(u *decoder) (bs []Branch) {
+	count := u.count()
+	bs = []Branch{}
+	for i := uint64(0); i < count && u.ok(); i++ {
+		bs = append(bs, decodeBranch(u))
 	}
 	return
 }
 
-func decodePos(u *pack.Unpacker) (p lexer.Position) {
-	p.Col = uint(u.U32())
-	p.Line = uint(u.U32())
-	p.File = u.Str()
+func decodePattern(u *decoder) (p Pattern) {
+	p.Kind = PatternKind(u.U8())
+	p.Where = decodeSpan(u)
+	switch p.Kind {
+	case PatBind:
+		p.Bind = u.str()
+	case PatLiteral:
+		p.Value = decodeNode(u)
+	case PatStruct, PatVariant:
+		p.Type = decodeType(u)
+		p.Variant = u.str()
+		count := u.count()
+		p.Fields = []Pattern{}
+		for i := uint64(0); i < count && u.ok(); i++ {
+			p.Fields = append(p.Fields, decodePattern(u))
+		}
+	}
+	return
+}
+
+func decodePos(u *decoder, fn string) (p lexer.Position) {
+	p.File = fn
+	p.Col = u.uint()
+	p.Line = u.uint()
+	p.Offset = u.uint()
+	return
+}
+
+func decodeSpan(u *decoder) (s lexer.Span) {
+	if u.ver < 2 {
+		// version 1 only has the line and column a node starts at, followed by
+		// the file name
+		s.Start.Col = u.uint()
+		s.Start.Line = u.uint()
+		s.Start.File = u.str()
+		s.End = s.Start
+		return
+	}
+	fn := u.str()
+	s.Start = decodePos(u, fn)
+	s.End = decodePos(u, fn)
 	return
 }
@@ -18,6 +18,37 @@ func (VarSetNode) Kind() NodeKind {
 	return NVarSet
 }
 
+// SelectorSetNode represents an assignment to a structure field or an array
+// element:
+//
+//	%MyVar#Field: "New Value"
+//	%MyArr#[Idx]: "New Value"
+type SelectorSetNode struct {
+	Target Selector
+	Value  MetaNode
+}
+
+var _ Node = SelectorSetNode{}
+
+func (SelectorSetNode) Kind() NodeKind {
+	return NSelectorSet
+}
+
+// DestructureNode represents an assignment of every element of a tuple to a
+// variable of it's own:
+//
+//	%(State Row): ReadRow! R
+type DestructureNode struct {
+	Vars  []string
+	Value MetaNode
+}
+
+var _ Node = DestructureNode{}
+
+func (DestructureNode) Kind() NodeKind {
+	return NDestructure
+}
+
 // VarDef represents a type definition for a variable:
 //
 //	%MyVar/string
@@ -48,10 +79,12 @@ func (VarSetTypedNode) Kind() NodeKind {
 }
 
 type FuncDefNode struct {
-	Name  string
-	Proto []types.Descriptor
-	Ret   types.Type
-	Body  Block
+	Name   string
+	Recv   string
+	Params []string
+	Proto  []types.Descriptor
+	Ret    types.Type
+	Body   Block
 }
 
 var _ Node = FuncDefNode{}
@@ -61,10 +94,12 @@ func (FuncDefNode) Kind() NodeKind {
 }
 
 type FuncShorthandNode struct {
-	Name string
-	Proto []types.Descriptor
-	Ret types.Type
-	Body MetaNode
+	Name   string
+	Recv   string
+	Params []string
+	Proto  []types.Descriptor
+	Ret    types.Type
+	Body   MetaNode
 }
 
 var _ Node = FuncShorthandNode{}
@@ -88,6 +123,7 @@ func (FuncExternNode) Kind() NodeKind {
 
 type StructDefNode struct {
 	Name   string
+	Params []string
 	Fields []types.Descriptor
 }
 
@@ -96,3 +132,32 @@ var _ Node = StructDefNode{}
 func (StructDefNode) Kind() NodeKind {
 	return NStructDef
 }
+
+// AliasDefNode represents a type alias definition:
+//
+//	@Lines: [str]
+type AliasDefNode struct {
+	Name string
+	Type types.Type
+}
+
+var _ Node = AliasDefNode{}
+
+func (AliasDefNode) Kind() NodeKind {
+	return NAliasDef
+}
+
+// UnionDefNode represents a tagged union type definition:
+//
+//	@Shape?(Circle/float Rect/Vec2f Empty)
+type UnionDefNode struct {
+	Name     string
+	Params   []string
+	Variants []types.Descriptor
+}
+
+var _ Node = UnionDefNode{}
+
+func (UnionDefNode) Kind() NodeKind {
+	return NUnionDef
+}
@@ -7,5 +7,19 @@ package ast
 // FormatMagic is the magic string of the AST file format
 const FormatMagic = "SKAST"
 
-// FormatVersion is the version ordinal of the AST file format
-const FormatVersion byte = 1
+// FormatVersion is the version ordinal of the AST file format. Version 2 adds
+// the end and byte offsets of the spans of nodes. Version 3 uses
+// variable-length ints and adds a checksum. Version 4 adds the type parameters
+// of generic functions and structures. Version 5 adds tagged unions. Version 6
+// adds methods. Version 7 adds type aliases. Version 8 adds placeholders for
+// code that could not be parsed. Version 9 adds function types, function
+// references and anonymous functions. Version 10 adds match statements. Version
+// 11 adds for-each loops. Version 12 adds maps. Version 13 adds assignments to
+// fields and elements. Version 14 adds structure updates. Version 15 adds
+// failure propagation. Version 16 adds interpolated strings. Version 17 adds
+// tuples. Version 18 adds nested functions.
+const FormatVersion byte = 18
+
+// MinFormatVersion is the oldest version of the AST file format that can still
+// be decoded
+const MinFormatVersion byte = 1
@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"bytes"
+	"hash/crc32"
 	"io"
 
 	"github.com/syzkrash/skol/common/pack"
@@ -10,37 +12,68 @@ import (
 )
 
 // Encode writes a binary representation of the given AST into the provided
-// [io.Writer]
+// [io.Writer]. The AST itself is followed by a CRC-32 checksum of the encoded
+// AST.
 func Encode(w io.Writer, tree AST) (err error) {
-	pk := pack.NewPacker(w)
+	body := bytes.Buffer{}
+	pk := pack.NewPacker(&body)
 
-	pk.Write([]byte(FormatMagic)).U8(FormatVersion)
-
-	pk.U8(uint8(len(tree.Vars)))
+	pk.UVarint(uint64(len(tree.Vars)))
 	for _, v := range tree.Vars {
 		encodeVar(pk, v)
 	}
 
-	pk.U8(uint8(len(tree.Typedefs)))
+	pk.UVarint(uint64(len(tree.Typedefs)))
 	for _, v := range tree.Typedefs {
 		encodeTypedef(pk, v)
 	}
 
-	pk.U8(uint8(len(tree.Funcs)))
+	pk.UVarint(uint64(len(tree.Funcs)))
 	for _, f := range tree.Funcs {
 		encodeFunc(pk, f)
 	}
 
-	pk.U8(uint8(len(tree.Exerns)))
+	pk.UVarint(uint64(len(tree.Exerns)))
 	for _, e := range tree.Exerns {
 		encodeExtern(pk, e)
 	}
 
-	pk.U8(uint8(len(tree.Structs)))
+	pk.UVarint(uint64(len(tree.Structs)))
 	for _, s := range tree.Structs {
 		encodeStruct(pk, s)
 	}
 
+	pk.UVarint(uint64(len(tree.Unions)))
+	for _, u := range tree.Unions {
+		encodeUnion(pk, u)
+	}
+
+	methods := 0
+	for _, ms := range tree.Methods {
+		methods += len(ms)
+	}
+	pk.UVarint(uint64(methods))
+	for _, ms := range tree.Methods {
+		for _, m := range ms {
+			pk.VStr(m.Recv)
+			encodeFunc(pk, m)
+		}
+	}
+
+	pk.UVarint(uint64(len(tree.Aliases)))
+	for _, a := range tree.Aliases {
+		encodeAlias(pk, a)
+	}
+
+	if len(pk.Err) > 0 {
+		return pk.Err[0]
+	}
+
+	pk = pack.NewPacker(w)
+	pk.Write([]byte(FormatMagic)).U8(FormatVersion)
+	pk.Write(body.Bytes())
+	pk.U32(crc32.ChecksumIEEE(body.Bytes()))
+
 	if len(pk.Err) > 0 {
 		return pk.Err[0]
 	}
@@ -49,36 +82,49 @@ func Encode(w io.Writer, tree AST) (err error) {
 }
 
 func encodeVar(pk *pack.Packer, v Var) {
-	pk.Str(v.Name)
+	pk.VStr(v.Name)
 	encodeNode(pk, v.Value)
 }
 
 func encodeTypedef(pk *pack.Packer, t Typedef) {
-	pk.Str(t.Name)
+	pk.VStr(t.Name)
 	encodeType(pk, t.Type)
 }
 
 func encodeFunc(pk *pack.Packer, f Func) {
-	pk.Str(f.Name)
+	pk.VStr(f.Name)
+	encodeStrSlice(pk, f.Params)
 	encodeType(pk, f.Ret)
 	encodeDescriptorSlice(pk, f.Args)
 	encodeNodeSlice(pk, f.Body)
 }
 
 func encodeExtern(pk *pack.Packer, e Extern) {
-	pk.Str(e.Alias)
-	pk.Str(e.Name)
+	pk.VStr(e.Alias)
+	pk.VStr(e.Name)
 	encodeType(pk, e.Ret)
 	encodeDescriptorSlice(pk, e.Args)
 }
 
 func encodeStruct(pk *pack.Packer, s Structure) {
-	pk.Str(s.Name)
+	pk.VStr(s.Name)
+	encodeStrSlice(pk, s.Params)
 	encodeDescriptorSlice(pk, s.Fields)
 }
 
+func encodeUnion(pk *pack.Packer, u Union) {
+	pk.VStr(u.Name)
+	encodeStrSlice(pk, u.Params)
+	encodeDescriptorSlice(pk, u.Variants)
+}
+
+func encodeAlias(pk *pack.Packer, a Alias) {
+	pk.VStr(a.Name)
+	encodeType(pk, a.Type)
+}
+
 func encodeNode(pk *pack.Packer, mn MetaNode) {
-	encodePos(pk, mn.Where)
+	encodeSpan(pk, mn.Where)
 	k := mn.Node.Kind()
 	pk.U8(uint8(k))
 
@@ -90,22 +136,41 @@ func encodeNode(pk *pack.Packer, mn MetaNode) {
 		}
 		pk.U8(b)
 	case NChar:
-		pk.U8(mn.Node.(CharNode).Value)
+		pk.UVarint(uint64(mn.Node.(CharNode).Value))
 	case NInt:
 		pk.I64(mn.Node.(IntNode).Value)
 	case NFloat:
 		pk.F64(mn.Node.(FloatNode).Value)
 	case NString:
-		pk.Str(mn.Node.(StringNode).Value)
+		pk.VStr(mn.Node.(StringNode).Value)
+	case NInterp:
+		in := mn.Node.(InterpNode)
+		encodeStrSlice(pk, in.Parts)
+		encodeNodeSlice(pk, in.Values)
 	case NStruct:
 		sn := mn.Node.(StructNode)
 		encodeType(pk, sn.Type)
 		encodeNodeSlice(pk, sn.Args)
+	case NStructUpdate:
+		sun := mn.Node.(StructUpdateNode)
+		encodeType(pk, sun.Type)
+		encodeNode(pk, sun.Base)
+		encodeStrSlice(pk, sun.Fields)
+		encodeNodeSlice(pk, sun.Values)
 	case NArray:
 		an := mn.Node.(ArrayNode)
 		encodeType(pk, an.Type.Element)
 		encodeNodeSlice(pk, an.Elems)
 
+	case NTuple:
+		encodeNodeSlice(pk, mn.Node.(TupleNode).Elems)
+
+	case NMap:
+		man := mn.Node.(MapNode)
+		encodeType(pk, man.Type)
+		encodeNodeSlice(pk, man.Keys)
+		encodeNodeSlice(pk, man.Values)
+
 	case NIf:
 		in := mn.Node.(IfNode)
 		encodeBranch(pk, in.Main)
@@ -116,25 +181,88 @@ func encodeNode(pk *pack.Packer, mn MetaNode) {
 		encodeBranchOf(pk, wn.Cond, wn.Block)
 	case NReturn:
 		encodeNode(pk, mn.Node.(ReturnNode).Value)
+	case NForEach:
+		fen := mn.Node.(ForEachNode)
+		pk.VStr(fen.Index)
+		pk.VStr(fen.Elem)
+		encodeBranchOf(pk, fen.Iter, fen.Block)
+	case NBreak, NContinue:
+		// no data
+	case NMatch:
+		man := mn.Node.(MatchNode)
+		encodeNode(pk, man.Value)
+		pk.UVarint(uint64(len(man.Arms)))
+		for _, a := range man.Arms {
+			encodePattern(pk, a.Pattern)
+			encodeNodeSlice(pk, a.Block)
+		}
 
 	case NVarSet:
 		vsn := mn.Node.(VarSetNode)
-		pk.Str(vsn.Var)
+		pk.VStr(vsn.Var)
 		encodeNode(pk, vsn.Value)
+	case NDestructure:
+		dn := mn.Node.(DestructureNode)
+		encodeStrSlice(pk, dn.Vars)
+		encodeNode(pk, dn.Value)
 	case NVarDef:
 		vdn := mn.Node.(VarDefNode)
-		pk.Str(vdn.Var)
+		pk.VStr(vdn.Var)
 		encodeType(pk, vdn.Type)
 	case NVarSetTyped:
 		vstn := mn.Node.(VarSetTypedNode)
-		pk.Str(vstn.Var)
+		pk.VStr(vstn.Var)
 		encodeType(pk, vstn.Type)
 		encodeNode(pk, vstn.Value)
+	case NFuncDef:
+		// only nested functions are part of a body, which are never methods
+		// or generic
+		fdn := mn.Node.(FuncDefNode)
+		pk.VStr(fdn.Name)
+		encodeType(pk, fdn.Ret)
+		encodeDescriptorSlice(pk, fdn.Proto)
+		encodeNodeSlice(pk, fdn.Body)
+
+	case NSelectorSet:
+		ssn := mn.Node.(SelectorSetNode)
+		encodeSelectorRef(pk, ssn.Target)
+		encodeNode(pk, ssn.Value)
+
+	case NSelector, NTypecast, NIndexConst, NIndexSelector:
+		encodeSelector(pk, mn.Node.(Selector))
 
 	case NFuncCall:
 		fcn := mn.Node.(FuncCallNode)
-		pk.Str(fcn.Func)
+		pk.VStr(fcn.Func)
 		encodeNodeSlice(pk, fcn.Args)
+	case NMethodCall:
+		mcn := mn.Node.(MethodCallNode)
+		encodeNode(pk, mcn.Recv)
+		pk.VStr(mcn.Type)
+		pk.VStr(mcn.Method)
+		encodeNodeSlice(pk, mcn.Args)
+	case NTry:
+		encodeNode(pk, mn.Node.(TryNode).Value)
+
+	case NBad:
+		// no data
+	case NFuncRef:
+		pk.VStr(mn.Node.(FuncRefNode).Func)
+	case NLambda:
+		ln := mn.Node.(LambdaNode)
+		encodeDescriptorSlice(pk, ln.Proto)
+		encodeType(pk, ln.Ret)
+		encodeNodeSlice(pk, ln.Body)
+	case NVariant:
+		vn := mn.Node.(VariantNode)
+		encodeType(pk, vn.Type)
+		pk.VStr(vn.Variant)
+		if vn.Value.Node == nil {
+			pk.U8(0)
+		} else {
+			pk.U8(1)
+			encodeNode(pk, vn.Value)
+		}
 
 	default:
 		pk.Error(pe.New(pe.EUnencodableNode).Section("Caused By", "%s Node at %s", k, mn.Where))
@@ -143,38 +271,129 @@ func encodeNode(pk *pack.Packer, mn MetaNode) {
 }
 
 func encodeNodeSlice(pk *pack.Packer, ns []MetaNode) {
-	pk.U8(uint8(len(ns)))
+	pk.UVarint(uint64(len(ns)))
 	for _, n := range ns {
 		encodeNode(pk, n)
 	}
 }
 
+// encodeSelector writes the given selector node without it's kind. Parent
+// selectors are written with their kind, see [encodeSelectorRef].
+func encodeSelector(pk *pack.Packer, s Selector) {
+	switch n := s.(type) {
+	case SelectorNode:
+		encodeSelectorRef(pk, n.Parent)
+		pk.VStr(n.Child)
+	case TypecastNode:
+		encodeSelectorRef(pk, n.Parent)
+		encodeType(pk, n.Cast)
+	case IndexConstNode:
+		encodeSelectorRef(pk, n.Parent)
+		pk.Varint(int64(n.Idx))
+	case IndexSelectorNode:
+		encodeSelectorRef(pk, n.Parent)
+		encodeSelectorRef(pk, n.Idx)
+	}
+}
+
+// encodeSelectorRef writes the kind of the given selector followed by the
+// selector itself. A nil selector is written as [NInvalid].
+func encodeSelectorRef(pk *pack.Packer, s Selector) {
+	if s == nil {
+		pk.U8(uint8(NInvalid))
+		return
+	}
+	pk.U8(uint8(s.Kind()))
+	encodeSelector(pk, s)
+}
+
 func encodeType(pk *pack.Packer, t types.Type) {
+	// functions declared without a return type have no type at all
+	if t == nil {
+		pk.U8(uint8(types.PNothing))
+		return
+	}
+
+	// aliases have the primitive of the type they stand for, so they need a
+	// marker of their own
+	if a, ok := t.(types.AliasType); ok {
+		pk.U8(uint8(types.PAlias))
+		pk.VStr(a.Name)
+		encodeType(pk, a.Type)
+		return
+	}
+
 	p := t.Prim()
 	pk.U8(uint8(p))
 
 	switch p {
 	case types.PStruct:
 		st := t.(types.StructType)
-		pk.Str(st.Name)
+		pk.VStr(st.Name)
+		encodeStrSlice(pk, st.Params)
+		pk.UVarint(uint64(len(st.Args)))
+		for _, a := range st.Args {
+			encodeType(pk, a)
+		}
 		encodeDescriptorSlice(pk, st.Fields)
 	case types.PArray:
 		encodeType(pk, t.(types.ArrayType).Element)
+	case types.PParam:
+		pk.VStr(t.(types.ParamType).Name)
+	case types.PUnion:
+		ut := t.(types.UnionType)
+		pk.VStr(ut.Name)
+		encodeStrSlice(pk, ut.Params)
+		pk.UVarint(uint64(len(ut.Args)))
+		for _, a := range ut.Args {
+			encodeType(pk, a)
+		}
+		encodeDescriptorSlice(pk, ut.Variants)
+	case types.PMap:
+		mt := t.(types.MapType)
+		encodeType(pk, mt.Key)
+		encodeType(pk, mt.Value)
+	case types.PFunc:
+		ft := t.(types.FuncType)
+		pk.UVarint(uint64(len(ft.Args)))
+		for _, a := range ft.Args {
+			encodeType(pk, a)
+		}
+		encodeType(pk, ft.Ret)
+	case types.PTuple:
+		tt := t.(types.TupleType)
+		pk.UVarint(uint64(len(tt.Elems)))
+		for _, e := range tt.Elems {
+			encodeType(pk, e)
+		}
 	}
 	return
 }
 
+func encodeStrSlice(pk *pack.Packer, ss []string) {
+	pk.UVarint(uint64(len(ss)))
+	for _, s := range ss {
+		pk.VStr(s)
+	}
+}
+
 func encodePos(pk *pack.Packer, p lexer.Position) {
-	pk.U32(uint32(p.Col)).U32(uint32(p.Line)).Str(p.File)
+	pk.UVarint(uint64(p.Col)).UVarint(uint64(p.Line)).UVarint(uint64(p.Offset))
+}
+
+func encodeSpan(pk *pack.Packer, s lexer.Span) {
+	pk.VStr(s.Start.File)
+	encodePos(pk, s.Start)
+	encodePos(pk, s.End)
 }
 
 func encodeDescriptor(pk *pack.Packer, d types.Descriptor) {
-	pk.Str(d.Name)
+	pk.VStr(d.Name)
 	encodeType(pk, d.Type)
 }
 
 func encodeDescriptorSlice(pk *pack.Packer, ds []types.Descriptor) {
-	pk.U8(uint8(len(ds)))
+	pk.UVarint(uint64(len(ds)))
 	for _, d := range ds {
 		encodeDescriptor(pk, d)
 	}
@@ -193,8 +412,26 @@ func encodeBranch(pk *pack.Packer, b Branch) {
 }
 
 func encodeBranchSlice(pk *pack.Packer, bs []Branch) {
-	pk.U8(uint8(len(bs)))
+	pk.UVarint(uint64(len(bs)))
 	for _, b := range bs {
 		encodeBranch(pk, b)
 	}
 }
+
+func encodePattern(pk *pack.Packer, p Pattern) {
+	pk.U8(uint8(p.Kind))
+	encodeSpan(pk, p.Where)
+	switch p.Kind {
+	case PatBind:
+		pk.VStr(p.Bind)
+	case PatLiteral:
+		encodeNode(pk, p.Value)
+	case PatStruct, PatVariant:
+		encodeType(pk, p.Type)
+		pk.VStr(p.Variant)
+		pk.UVarint(uint64(len(p.Fields)))
+		for _, f := range p.Fields {
+			encodePattern(pk, f)
+		}
+	}
+}
@@ -2,12 +2,24 @@ package ast_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"unicode"
 
 	"github.com/syzkrash/skol/ast"
 	"github.com/syzkrash/skol/common"
+	"github.com/syzkrash/skol/common/pack"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
 	"github.com/syzkrash/skol/parser"
+	"github.com/syzkrash/skol/parser/values/types"
 )
 
 func TestEncode(t *testing.T) {
@@ -115,4 +127,713 @@ func TestRecode(t *testing.T) {
 	if len(decTree.Structs) != len(tree.Structs) {
 		t.Fatalf("incorrect # of structs: %d != %d", len(decTree.Structs), len(tree.Structs))
 	}
+	for n, f := range tree.Funcs {
+		for i, mn := range f.Body {
+			if got := decTree.Funcs[n].Body[i].Where; got != mn.Where {
+				t.Fatalf("incorrect span of node %d in %s: %s != %s", i, n, got, mn.Where)
+			}
+		}
+	}
+}
+
+// parse parses the given code, failing the test if any errors are reported
+func parse(t *testing.T, name, code string) ast.AST {
+	errs := make(chan error)
+	done := make(chan struct{})
+	var got []error
+	go func() {
+		for err := range errs {
+			got = append(got, err)
+		}
+		close(done)
+	}()
+	p := parser.NewParser(name, strings.NewReader(code), "test", errs)
+	tree := p.Parse()
+	close(errs)
+	<-done
+	if len(got) > 0 {
+		t.Fatal(got[0])
+	}
+	return tree
+}
+
+// TestRecodeNoReturn ensures that functions declared without a return type can
+// be encoded, which every parsed program goes through to be cached
+func TestRecodeNoReturn(t *testing.T) {
+	tree := parse(t, "TestRecodeNoReturn", `
+		$greet(
+			print! "Hello, world!"
+		)
+	`)
+	// functions built without the parser may have no return type at all
+	tree.Funcs["bare"] = ast.Func{Name: "bare"}
+
+	decTree := recode(t, tree)
+	for _, n := range []string{"greet", "bare"} {
+		if got := decTree.Funcs[n].Ret; got.Prim() != types.PNothing {
+			t.Fatalf("expected %s to return nothing, got %s", n, got)
+		}
+	}
+}
+
+// randomAST generates random, but structurally valid, ASTs for round-trip
+// testing
+type randomAST struct {
+	*rand.Rand
+}
+
+func (r randomAST) name() string {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_"
+	b := make([]byte, 1+r.Intn(12))
+	for i := range b {
+		b[i] = chars[r.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+func (r randomAST) str() string {
+	// occasionally generate strings longer than 255 bytes
+	b := make([]byte, r.Intn(20)+r.Intn(2)*r.Intn(1000))
+	r.Read(b)
+	return string(b)
+}
+
+func (r randomAST) span() lexer.Span {
+	s := lexer.Span{
+		Start: lexer.Position{
+			File:   "Random",
+			Line:   uint(r.Intn(100000)),
+			Col:    uint(r.Intn(200)),
+			Offset: uint(r.Uint32()),
+		},
+	}
+	s.End = s.Start
+	s.End.Col += uint(r.Intn(50))
+	s.End.Offset += uint(r.Intn(50))
+	return s
+}
+
+func (r randomAST) typ(depth int) types.Type {
+	max := 9
+	if depth > 0 {
+		max = 16
+	}
+	switch r.Intn(max) {
+	case 0:
+		return types.Bool
+	case 1:
+		return types.Char
+	case 2:
+		return types.Int
+	case 3:
+		return types.Float
+	case 4:
+		return types.String
+	case 5:
+		return types.Any
+	case 6:
+		return types.Nothing
+	case 7:
+		return types.Undefined
+	case 8:
+		return types.ParamType{Name: r.name()}
+	case 9:
+		return types.ArrayType{Element: r.typ(depth - 1)}
+	case 10:
+		f := types.FuncType{Args: make([]types.Type, r.Intn(3)), Ret: r.typ(depth - 1)}
+		for i := range f.Args {
+			f.Args[i] = r.typ(depth - 1)
+		}
+		return f
+	case 11:
+		return r.unionType(depth - 1)
+	case 12:
+		return types.MapType{Key: r.typ(depth - 1), Value: r.typ(depth - 1)}
+	case 13:
+		return types.AliasType{Name: r.name(), Type: r.typ(depth - 1)}
+	case 14:
+		return types.TupleType{Elems: []types.Type{r.typ(depth - 1), r.typ(depth - 1)}}
+	default:
+		return r.structType(depth - 1)
+	}
+}
+
+func (r randomAST) structType(depth int) types.StructType {
+	s := types.StructType{
+		Name:   r.name(),
+		Params: r.params(),
+		Fields: r.descriptors(depth),
+	}
+	if len(s.Params) > 0 && r.Intn(2) == 0 {
+		s.Args = make([]types.Type, len(s.Params))
+		for i := range s.Args {
+			s.Args[i] = r.typ(depth)
+		}
+	}
+	return s
+}
+
+func (r randomAST) unionType(depth int) types.UnionType {
+	u := types.UnionType{
+		Name:     r.name(),
+		Params:   r.params(),
+		Variants: r.descriptors(depth),
+	}
+	if len(u.Params) > 0 && r.Intn(2) == 0 {
+		u.Args = make([]types.Type, len(u.Params))
+		for i := range u.Args {
+			u.Args[i] = r.typ(depth)
+		}
+	}
+	return u
+}
+
+func (r randomAST) params() []string {
+	var ps []string
+	for i := r.Intn(3); i > 0; i-- {
+		ps = append(ps, r.name())
+	}
+	return ps
+}
+
+func (r randomAST) descriptors(depth int) []types.Descriptor {
+	ds := make([]types.Descriptor, r.Intn(4))
+	for i := range ds {
+		ds[i] = types.Descriptor{Name: r.name(), Type: r.typ(depth)}
+	}
+	return ds
+}
+
+func (r randomAST) selector(depth int) ast.Selector {
+	var s ast.Selector = ast.SelectorNode{Child: r.name()}
+	for i := r.Intn(4); i > 0; i-- {
+		switch r.Intn(4) {
+		case 0:
+			s = ast.SelectorNode{Parent: s, Child: r.name()}
+		case 1:
+			s = ast.TypecastNode{Parent: s, Cast: r.typ(depth)}
+		case 2:
+			s = ast.IndexConstNode{Parent: s, Idx: r.Intn(1 << 20)}
+		default:
+			s = ast.IndexSelectorNode{Parent: s, Idx: ast.SelectorNode{Child: r.name()}}
+		}
+	}
+	return s
+}
+
+func (r randomAST) value(depth int) ast.MetaNode {
+	mn := ast.MetaNode{Where: r.span()}
+	max := 7
+	if depth > 0 {
+		max = 18
+	}
+	switch r.Intn(max) {
+	case 0:
+		mn.Node = ast.BoolNode{Value: r.Intn(2) == 0}
+	case 1:
+		mn.Node = ast.CharNode{Value: rune(r.Intn(unicode.MaxRune + 1))}
+	case 2:
+		mn.Node = ast.IntNode{Value: r.Int63() - r.Int63()}
+	case 3:
+		mn.Node = ast.FloatNode{Value: r.NormFloat64()}
+	case 4:
+		mn.Node = ast.StringNode{Value: r.str()}
+	case 5:
+		mn.Node = r.selector(depth)
+	case 6:
+		mn.Node = ast.FuncRefNode{Func: r.name()}
+	case 7:
+		mn.Node = ast.LambdaNode{
+			Proto: r.descriptors(depth - 1),
+			Ret:   r.typ(depth - 1),
+			Body:  r.block(depth - 1),
+		}
+	case 8:
+		mn.Node = ast.StructNode{Type: r.structType(depth - 1), Args: r.values(depth - 1)}
+	case 9:
+		mn.Node = ast.ArrayNode{
+			Type:  types.ArrayType{Element: r.typ(depth - 1)},
+			Elems: r.values(depth - 1),
+		}
+	case 10:
+		v := ast.VariantNode{Type: r.unionType(depth - 1), Variant: r.name()}
+		if r.Intn(2) == 0 {
+			v.Value = r.value(depth - 1)
+		}
+		mn.Node = v
+	case 11:
+		n := r.Intn(4)
+		m := ast.MapNode{
+			Type:   types.MapType{Key: r.typ(depth - 1), Value: r.typ(depth - 1)},
+			Keys:   make([]ast.MetaNode, n),
+			Values: make([]ast.MetaNode, n),
+		}
+		for i := 0; i < n; i++ {
+			m.Keys[i] = r.value(depth - 1)
+			m.Values[i] = r.value(depth - 1)
+		}
+		mn.Node = m
+	case 12:
+		mn.Node = ast.MethodCallNode{
+			Recv:   ast.MetaNode{Where: r.span(), Node: r.selector(depth - 1)},
+			Type:   r.name(),
+			Method: r.name(),
+			Args:   r.values(depth - 1),
+		}
+	case 13:
+		u := ast.StructUpdateNode{
+			Type:   r.structType(depth - 1),
+			Base:   r.value(depth - 1),
+			Values: r.values(depth - 1),
+		}
+		for range u.Values {
+			u.Fields = append(u.Fields, r.name())
+		}
+		mn.Node = u
+	case 14:
+		mn.Node = ast.TryNode{Value: r.value(depth - 1)}
+	case 15:
+		in := ast.InterpNode{Parts: []string{r.str()}, Values: r.values(depth - 1)}
+		for range in.Values {
+			in.Parts = append(in.Parts, r.str())
+		}
+		mn.Node = in
+	case 16:
+		mn.Node = ast.TupleNode{Elems: []ast.MetaNode{r.value(depth - 1), r.value(depth - 1)}}
+	default:
+		mn.Node = ast.FuncCallNode{Func: r.name(), Args: r.values(depth - 1)}
+	}
+	return mn
+}
+
+func (r randomAST) values(depth int) []ast.MetaNode {
+	vs := make([]ast.MetaNode, r.Intn(4))
+	for i := range vs {
+		vs[i] = r.value(depth)
+	}
+	return vs
+}
+
+func (r randomAST) stmt(depth int) ast.MetaNode {
+	mn := ast.MetaNode{Where: r.span()}
+	max := 9
+	if depth > 0 {
+		max = 14
+	}
+	switch r.Intn(max) {
+	case 0:
+		mn.Node = ast.ReturnNode{Value: r.value(depth)}
+	case 1:
+		mn.Node = ast.VarSetNode{Var: r.name(), Value: r.value(depth)}
+	case 2:
+		mn.Node = ast.VarDefNode{Var: r.name(), Type: r.typ(depth)}
+	case 3:
+		mn.Node = ast.VarSetTypedNode{Var: r.name(), Type: r.typ(depth), Value: r.value(depth)}
+	case 4:
+		mn.Node = ast.FuncCallNode{Func: r.name(), Args: r.values(depth)}
+	case 5:
+		mn.Node = ast.BreakNode{}
+	case 6:
+		mn.Node = ast.ContinueNode{}
+	case 7:
+		mn.Node = ast.SelectorSetNode{Target: r.selector(depth), Value: r.value(depth)}
+	case 8:
+		mn.Node = ast.DestructureNode{Vars: []string{r.name(), r.name()}, Value: r.value(depth)}
+	case 9:
+		other := make([]ast.Branch, r.Intn(3))
+		for i := range other {
+			other[i] = ast.Branch{Cond: r.value(depth - 1), Block: r.block(depth - 1)}
+		}
+		mn.Node = ast.IfNode{
+			Main:  ast.Branch{Cond: r.value(depth - 1), Block: r.block(depth - 1)},
+			Other: other,
+			Else:  r.block(depth - 1),
+		}
+	case 10:
+		arms := make([]ast.MatchArm, r.Intn(3))
+		for i := range arms {
+			arms[i] = ast.MatchArm{Pattern: r.pattern(depth - 1), Block: r.block(depth - 1)}
+		}
+		mn.Node = ast.MatchNode{Value: r.value(depth - 1), Arms: arms}
+	case 11:
+		mn.Node = ast.ForEachNode{Index: r.name(), Elem: r.name(), Iter: r.value(depth - 1), Block: r.block(depth - 1)}
+	case 12:
+		mn.Node = ast.FuncDefNode{
+			Name:  r.name(),
+			Proto: r.descriptors(depth - 1),
+			Ret:   r.typ(depth - 1),
+			Body:  r.block(depth - 1),
+		}
+	default:
+		mn.Node = ast.WhileNode{Cond: r.value(depth - 1), Block: r.block(depth - 1)}
+	}
+	return mn
+}
+
+func (r randomAST) pattern(depth int) ast.Pattern {
+	p := ast.Pattern{Where: r.span()}
+	max := 2
+	if depth > 0 {
+		max = 4
+	}
+	switch r.Intn(max) {
+	case 0:
+		p.Kind = ast.PatBind
+		p.Bind = r.name()
+	case 1:
+		p.Kind = ast.PatLiteral
+		p.Value = ast.MetaNode{Where: r.span(), Node: ast.IntNode{Value: r.Int63()}}
+	case 2:
+		p.Kind = ast.PatStruct
+		p.Type = r.structType(depth - 1)
+		p.Fields = make([]ast.Pattern, r.Intn(3))
+		for i := range p.Fields {
+			p.Fields[i] = r.pattern(depth - 1)
+		}
+	default:
+		p.Kind = ast.PatVariant
+		p.Type = r.unionType(depth - 1)
+		p.Variant = r.name()
+		p.Fields = []ast.Pattern{}
+		if r.Intn(2) == 0 {
+			p.Fields = append(p.Fields, r.pattern(depth-1))
+		}
+	}
+	return p
+}
+
+func (r randomAST) block(depth int) ast.Block {
+	b := make(ast.Block, r.Intn(5))
+	for i := range b {
+		b[i] = r.stmt(depth)
+	}
+	return b
+}
+
+func (r randomAST) tree() ast.AST {
+	tree := ast.NewAST()
+	for i := r.Intn(5); i > 0; i-- {
+		v := ast.Var{Name: r.name(), Value: r.value(3)}
+		tree.Vars[v.Name] = v
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		t := ast.Typedef{Name: r.name(), Type: r.typ(3)}
+		tree.Typedefs[t.Name] = t
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		f := ast.Func{Name: r.name(), Params: r.params(), Args: r.descriptors(2), Ret: r.typ(2), Body: r.block(3)}
+		tree.Funcs[f.Name] = f
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		e := ast.Extern{Alias: r.name(), Name: r.name(), Args: r.descriptors(2), Ret: r.typ(2)}
+		tree.Exerns[e.Alias] = e
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		s := ast.Structure{Name: r.name(), Params: r.params(), Fields: r.descriptors(2)}
+		tree.Structs[s.Name] = s
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		u := ast.Union{Name: r.name(), Params: r.params(), Variants: r.descriptors(2)}
+		tree.Unions[u.Name] = u
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		m := ast.Func{Name: r.name(), Recv: r.name(), Params: r.params(), Args: r.descriptors(2), Ret: r.typ(2), Body: r.block(3)}
+		if tree.Methods[m.Recv] == nil {
+			tree.Methods[m.Recv] = make(map[string]ast.Func)
+		}
+		tree.Methods[m.Recv][m.Name] = m
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		a := ast.Alias{Name: r.name(), Type: r.typ(2)}
+		tree.Aliases[a.Name] = a
+	}
+	return tree
+}
+
+func recode(t *testing.T, tree ast.AST) ast.AST {
+	out := bytes.Buffer{}
+	if err := ast.Encode(&out, tree); err != nil {
+		t.Fatal(err)
+	}
+	decTree, err := ast.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decTree
+}
+
+// TestRoundTrip ensures that random ASTs are decoded exactly as they were
+// before encoding
+func TestRoundTrip(t *testing.T) {
+	r := randomAST{rand.New(rand.NewSource(0x5C01))}
+	for i := 0; i < 200; i++ {
+		tree := r.tree()
+		if decTree := recode(t, tree); !reflect.DeepEqual(tree, decTree) {
+			t.Fatalf("random AST #%d does not round-trip:\n%+v\n%+v", i, tree, decTree)
+		}
+	}
+}
+
+// TestLargeAST ensures that sections, blocks and strings are not limited to
+// 255 elements
+func TestLargeAST(t *testing.T) {
+	tree := ast.NewAST()
+	body := make(ast.Block, 1000)
+	for i := range body {
+		body[i] = ast.MetaNode{Node: ast.VarSetNode{
+			Var:   "v",
+			Value: ast.MetaNode{Node: ast.IntNode{Value: int64(i)}},
+		}}
+	}
+	for i := 0; i < 300; i++ {
+		n := fmt.Sprintf("f%d", i)
+		tree.Funcs[n] = ast.Func{
+			Name: n,
+			Args: []types.Descriptor{},
+			Ret:  types.Nothing,
+			Body: body,
+		}
+	}
+	long := strings.Repeat("skol", 100)
+	tree.Vars[long] = ast.Var{
+		Name:  long,
+		Value: ast.MetaNode{Node: ast.StringNode{Value: long}},
+	}
+
+	if decTree := recode(t, tree); !reflect.DeepEqual(tree, decTree) {
+		t.Fatal("large AST does not round-trip")
+	}
+}
+
+// TestChecksum ensures that a corrupted AST is rejected
+func TestChecksum(t *testing.T) {
+	r := randomAST{rand.New(rand.NewSource(0x5C02))}
+	out := bytes.Buffer{}
+	if err := ast.Encode(&out, r.tree()); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	data[len(ast.FormatMagic)+1+r.Intn(len(data)-len(ast.FormatMagic)-1)] ^= 0x10
+
+	_, err := ast.Decode(bytes.NewReader(data))
+	if perr, ok := err.(*pe.PrettyError); !ok || perr.Code != pe.EBadChecksum {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+}
+
+// TestDecodeV1 ensures that ASTs written by the first version of the encoder
+// can still be decoded. testdata/v1.skol_ast was written by that encoder from
+// testdata/v1.sk.
+func TestDecodeV1(t *testing.T) {
+	f, err := os.Open("testdata/v1.skol_ast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tree, err := ast.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := lexer.Position{File: "old.sk", Line: 1, Col: 13}
+	want := ast.Var{
+		Name: "greeting",
+		Value: ast.MetaNode{
+			Node:  ast.StringNode{Value: "hi"},
+			Where: lexer.Span{Start: at, End: at},
+		},
+	}
+	if !reflect.DeepEqual(tree.Vars["greeting"], want) {
+		t.Fatalf("%+v != %+v", tree.Vars["greeting"], want)
+	}
+	if got := tree.Vars["ratio"].Value.Node; got != (ast.FloatNode{Value: 1.5}) {
+		t.Fatalf("expected ratio to be 1.5, got %+v", got)
+	}
+	if got := tree.Vars["yes"].Value.Node; got != (ast.BoolNode{Value: true}) {
+		t.Fatalf("expected yes to be true, got %+v", got)
+	}
+	if got := tree.Typedefs["limit"].Type; !types.Int.Equals(got) {
+		t.Fatalf("expected limit to be an int, got %s", got)
+	}
+	vec := types.MakeStruct("Vec", "x", types.Int, "y", types.Int)
+	if got := tree.Structs["Vec"]; !reflect.DeepEqual(got.Fields, vec.(types.StructType).Fields) {
+		t.Fatalf("expected the fields of Vec, got %+v", got.Fields)
+	}
+
+	two := tree.Funcs["Two"]
+	if !types.Int.Equals(two.Ret) || len(two.Args) != 0 {
+		t.Fatalf("expected Two to take nothing and return an int, got %+v", two)
+	}
+	kinds := []ast.NodeKind{ast.NVarSet, ast.NIf, ast.NWhile, ast.NReturn}
+	if len(two.Body) != len(kinds) {
+		t.Fatalf("expected %d nodes in Two, got %d", len(kinds), len(two.Body))
+	}
+	for i, k := range kinds {
+		if got := two.Body[i].Node.Kind(); got != k {
+			t.Fatalf("expected node %d of Two to be %s, got %s", i, k, got)
+		}
+	}
+	loop := two.Body[2].Node.(ast.WhileNode)
+	set := loop.Block[0].Node.(ast.VarSetTypedNode)
+	if set.Var != "n" || !types.Char.Equals(set.Type) || set.Value.Node != (ast.CharNode{Value: 'c'}) {
+		t.Fatalf("expected n to be set to 'c', got %+v", set)
+	}
+}
+
+// TestDecodeV2 ensures that ASTs encoded with version 2 of the format can
+// still be decoded
+func TestDecodeV2(t *testing.T) {
+	buf := bytes.Buffer{}
+	pk := pack.NewPacker(&buf)
+	pk.Write([]byte(ast.FormatMagic)).U8(2)
+	// 1 variable: %v: 'q'
+	pk.U8(1).Str("v")
+	pk.Str("Old").U32(2).U32(1).U32(5).U32(5).U32(1).U32(8)
+	pk.U8(uint8(ast.NChar)).U8('q')
+	// no typedefs, functions, externs or structures
+	pk.U8(0).U8(0).U8(0).U8(0)
+
+	tree, err := ast.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ast.Var{
+		Name: "v",
+		Value: ast.MetaNode{
+			Node: ast.CharNode{Value: 'q'},
+			Where: lexer.Span{
+				Start: lexer.Position{File: "Old", Line: 1, Col: 2, Offset: 5},
+				End:   lexer.Position{File: "Old", Line: 1, Col: 5, Offset: 8},
+			},
+		},
+	}
+	if !reflect.DeepEqual(tree.Vars["v"], want) {
+		t.Fatalf("%+v != %+v", tree.Vars["v"], want)
+	}
+}
+
+// encodeAs encodes the AST and marks it as the given version of the format, to
+// check what the decoder accepts from older versions
+func encodeAs(t *testing.T, tree ast.AST, ver byte) *bytes.Buffer {
+	out := bytes.Buffer{}
+	if err := ast.Encode(&out, tree); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	hdrLen := len(ast.FormatMagic) + 1
+	data[hdrLen-1] = ver
+	body := data[hdrLen : len(data)-4]
+
+	buf := bytes.Buffer{}
+	pack.NewPacker(&buf).Write(data[:hdrLen]).Write(body).U32(crc32.ChecksumIEEE(body))
+	return &buf
+}
+
+// TestDecodeVersionGates ensures that nodes and types are only decoded from
+// versions of the format they are a part of
+func TestDecodeVersionGates(t *testing.T) {
+	span := lexer.Span{Start: lexer.Position{File: "Gates"}, End: lexer.Position{File: "Gates"}}
+	cases := []struct {
+		Name string
+		Tree func(tree ast.AST)
+		Ver  byte
+		Err  pe.ErrorCode
+	}{
+		{"tuple", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{
+				Node: ast.TupleNode{Elems: []ast.MetaNode{
+					{Node: ast.IntNode{Value: 1}, Where: span},
+					{Node: ast.IntNode{Value: 2}, Where: span},
+				}},
+				Where: span,
+			}}
+		}, 17, pe.EBadNodeKind},
+		{"map type", func(tree ast.AST) {
+			tree.Typedefs["v"] = ast.Typedef{Name: "v", Type: types.MapType{Key: types.String, Value: types.Int}}
+		}, 12, pe.EBadTypePrim},
+		{"method call", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{
+				Node:  ast.MethodCallNode{Recv: ast.MetaNode{Node: ast.IntNode{Value: 1}, Where: span}, Method: "m", Args: []ast.MetaNode{}},
+				Where: span,
+			}}
+		}, 6, pe.EBadNodeKind},
+		{"alias type", func(tree ast.AST) {
+			tree.Typedefs["v"] = ast.Typedef{Name: "v", Type: types.AliasType{Name: "A", Type: types.Int}}
+		}, 7, pe.EBadTypePrim},
+		{"bad node", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.BadNode{}, Where: span}}
+		}, 8, pe.EBadNodeKind},
+		{"function reference", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.FuncRefNode{Func: "f"}, Where: span}}
+		}, 9, pe.EBadNodeKind},
+		{"match", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.MatchNode{Value: ast.MetaNode{Node: ast.IntNode{Value: 1}, Where: span}, Arms: []ast.MatchArm{}}, Where: span}}
+		}, 10, pe.EBadNodeKind},
+		{"break", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.BreakNode{}, Where: span}}
+		}, 11, pe.EBadNodeKind},
+		{"selector set", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.SelectorSetNode{Target: ast.SelectorNode{Child: "x"}, Value: ast.MetaNode{Node: ast.IntNode{Value: 1}, Where: span}}, Where: span}}
+		}, 13, pe.EBadNodeKind},
+		{"structure update", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.StructUpdateNode{Type: types.StructType{Name: "S", Fields: []types.Descriptor{}}, Base: ast.MetaNode{Node: ast.IntNode{Value: 1}, Where: span}, Fields: []string{}, Values: []ast.MetaNode{}}, Where: span}}
+		}, 14, pe.EBadNodeKind},
+		{"try", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.TryNode{Value: ast.MetaNode{Node: ast.IntNode{Value: 1}, Where: span}}, Where: span}}
+		}, 15, pe.EBadNodeKind},
+		{"interpolated string", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.InterpNode{Parts: []string{"a", "b"}, Values: []ast.MetaNode{ast.MetaNode{Node: ast.IntNode{Value: 1}, Where: span}}}, Where: span}}
+		}, 16, pe.EBadNodeKind},
+		{"nested function", func(tree ast.AST) {
+			tree.Vars["v"] = ast.Var{Name: "v", Value: ast.MetaNode{Node: ast.FuncDefNode{Name: "f", Params: []string{}, Proto: []types.Descriptor{}, Ret: types.Nothing, Body: ast.Block{}}, Where: span}}
+		}, 18, pe.EBadNodeKind},
+	}
+
+	for _, c := range cases {
+		tree := ast.NewAST()
+		c.Tree(tree)
+
+		if _, err := ast.Decode(encodeAs(t, tree, c.Ver)); err != nil {
+			t.Fatalf("%s: expected version %d to decode, got %s", c.Name, c.Ver, err)
+		}
+
+		_, err := ast.Decode(encodeAs(t, tree, c.Ver-1))
+		var perr *pe.PrettyError
+		if !errors.As(err, &perr) || perr.Code != c.Err {
+			t.Fatalf("%s: expected error %d from version %d, got %v", c.Name, c.Err, c.Ver-1, err)
+		}
+	}
+}
+
+// TestStringContents ensures that strings using escape sequences and raw
+// strings keep their exact contents through encoding and JSON
+func TestStringContents(t *testing.T) {
+	tree := parse(t, "TestStringContents",
+		"%Escaped: \"\\0\\x41\\u{142}\\u{1F642}\\t\\\"\\\\\"\n"+
+			"%Raw: `SELECT *\n  FROM \"t\" -- \\n\n`\n")
+
+	expect := map[string]string{
+		"Escaped": "\x00Ał🙂\t\"\\",
+		"Raw":     "SELECT *\n  FROM \"t\" -- \\n\n",
+	}
+
+	decTree := recode(t, tree)
+	for n, e := range expect {
+		got := decTree.Vars[n].Value.Node.(ast.StringNode).Value
+		if got != e {
+			t.Fatalf("Incorrect contents of %s! Want %q but got %q!", n, e, got)
+		}
+
+		data, err := json.Marshal(decTree.Vars[n].Value.Node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fromJSON ast.StringNode
+		if err := json.Unmarshal(data, &fromJSON); err != nil {
+			t.Fatal(err)
+		}
+		if fromJSON.Value != e {
+			t.Fatalf("Incorrect JSON contents of %s! Want %q but got %q!", n, e, fromJSON.Value)
+		}
+	}
 }
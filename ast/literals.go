@@ -14,8 +14,10 @@ func (BoolNode) Kind() NodeKind {
 	return NBool
 }
 
+// CharNode represents a character literal. A character is any Unicode code
+// point.
 type CharNode struct {
-	Value byte
+	Value rune
 }
 
 var _ Node = CharNode{}
@@ -54,6 +56,22 @@ func (StringNode) Kind() NodeKind {
 	return NString
 }
 
+// InterpNode represents an interpolated string literal. Every embedded value is
+// turned into a string and placed between the surrounding parts, so there is
+// always one more part than there are values:
+//
+//	"Hello \{Name}, you are \{Age}!"
+type InterpNode struct {
+	Parts  []string
+	Values []MetaNode
+}
+
+var _ Node = InterpNode{}
+
+func (InterpNode) Kind() NodeKind {
+	return NInterp
+}
+
 type StructNode struct {
 	Type types.StructType
 	Args []MetaNode
@@ -65,6 +83,22 @@ func (StructNode) Kind() NodeKind {
 	return NStruct
 }
 
+// StructUpdateNode represents a copy of a structure value with some of its
+// fields changed. Fields[i] is set to Values[i], any other field is taken from
+// Base.
+type StructUpdateNode struct {
+	Type   types.StructType
+	Base   MetaNode
+	Fields []string
+	Values []MetaNode
+}
+
+var _ Node = StructUpdateNode{}
+
+func (StructUpdateNode) Kind() NodeKind {
+	return NStructUpdate
+}
+
 type ArrayNode struct {
 	Type  types.ArrayType
 	Elems []MetaNode
@@ -75,3 +109,30 @@ var _ Node = ArrayNode{}
 func (ArrayNode) Kind() NodeKind {
 	return NArray
 }
+
+// MapNode represents a map literal. Keys[i] is mapped to Values[i].
+type MapNode struct {
+	Type   types.MapType
+	Keys   []MetaNode
+	Values []MetaNode
+}
+
+var _ Node = MapNode{}
+
+func (MapNode) Kind() NodeKind {
+	return NMap
+}
+
+// TupleNode represents a tuple literal. A tuple holds a fixed amount of values,
+// which may be of different types:
+//
+//	(State * Row)
+type TupleNode struct {
+	Elems []MetaNode
+}
+
+var _ Node = TupleNode{}
+
+func (TupleNode) Kind() NodeKind {
+	return NTuple
+}
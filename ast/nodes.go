@@ -40,6 +40,24 @@ const (
 
 	// others
 	NFuncCall
+	NBad
+	NFuncRef
+	NLambda
+	NUnionDef
+	NVariant
+	NMatch
+	NForEach
+	NBreak
+	NContinue
+	NMap
+	NSelectorSet
+	NMethodCall
+	NAliasDef
+	NStructUpdate
+	NTry
+	NInterp
+	NTuple
+	NDestructure
 
 	// max bound
 	NMax
@@ -70,6 +88,24 @@ var nodeKindNames = []string{
 	"IndexConst",
 	"IndexSelector",
 	"FuncCall",
+	"Bad",
+	"FuncRef",
+	"Lambda",
+	"UnionDef",
+	"Variant",
+	"Match",
+	"ForEach",
+	"Break",
+	"Continue",
+	"Map",
+	"SelectorSet",
+	"MethodCall",
+	"AliasDef",
+	"StructUpdate",
+	"Try",
+	"Interp",
+	"Tuple",
+	"Destructure",
 }
 
 // Ensure checks if this is a valid NodeKind, returning NInvalid if it's not.
@@ -89,7 +125,7 @@ func (k NodeKind) String() string {
 func (k NodeKind) IsValue() bool {
 	switch k {
 	case NBool, NChar, NInt, NFloat, NString, NStruct, NArray,
-		NSelector, NTypecast, NIndexConst, NIndexSelector, NFuncCall:
+		NSelector, NTypecast, NIndexConst, NIndexSelector, NFuncCall, NFuncRef, NLambda, NVariant, NMap, NMethodCall, NStructUpdate, NTry, NInterp, NTuple:
 		return true
 	default:
 		return false
@@ -101,10 +137,11 @@ type Node interface {
 	Kind() NodeKind
 }
 
-// MetaNode wraps an abstract node with position information.
+// MetaNode wraps an abstract node with the span of source code it was parsed
+// from.
 type MetaNode struct {
 	Node  Node
-	Where lexer.Position
+	Where lexer.Span
 }
 
 // Block represents a list of MetaNodes, typically for multiple statements.
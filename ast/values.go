@@ -1,5 +1,7 @@
 package ast
 
+import "github.com/syzkrash/skol/parser/values/types"
+
 type FuncCallNode struct {
 	Func string
 	Args []MetaNode
@@ -10,3 +12,92 @@ var _ Node = FuncCallNode{}
 func (FuncCallNode) Kind() NodeKind {
 	return NFuncCall
 }
+
+// MethodCallNode represents a call to a method of a structure. The receiver is
+// passed to the method as it's first argument:
+//
+//	R#GetChar!
+//	V#Add! W
+//
+// Type is the name of the structure the method was found on by the parser.
+type MethodCallNode struct {
+	Recv   MetaNode
+	Type   string
+	Method string
+	Args   []MetaNode
+}
+
+var _ Node = MethodCallNode{}
+
+func (MethodCallNode) Kind() NodeKind {
+	return NMethodCall
+}
+
+// BadNode is a placeholder for a statement that could not be parsed. The
+// position of the [MetaNode] holding it covers the skipped code.
+type BadNode struct{}
+
+var _ Node = BadNode{}
+
+func (BadNode) Kind() NodeKind {
+	return NBad
+}
+
+// FuncRefNode represents a named function used as a value:
+//
+//	$Add
+type FuncRefNode struct {
+	Func string
+}
+
+var _ Node = FuncRefNode{}
+
+func (FuncRefNode) Kind() NodeKind {
+	return NFuncRef
+}
+
+// LambdaNode represents an anonymous function literal:
+//
+//	$(A/int B/int)/int(> add! A B)
+type LambdaNode struct {
+	Proto []types.Descriptor
+	Ret   types.Type
+	Body  Block
+}
+
+var _ Node = LambdaNode{}
+
+func (LambdaNode) Kind() NodeKind {
+	return NLambda
+}
+
+// VariantNode represents a value of a tagged union. Value is empty if the
+// variant has no payload:
+//
+//	@Shape#Circle 1.5
+//	@Shape#Empty
+type VariantNode struct {
+	Type    types.UnionType
+	Variant string
+	Value   MetaNode
+}
+
+var _ Node = VariantNode{}
+
+func (VariantNode) Kind() NodeKind {
+	return NVariant
+}
+
+// TryNode represents a propagated result. It evaluates to the value held by the
+// result, or returns the failed result from the current function:
+//
+//	^ParseInt! S
+type TryNode struct {
+	Value MetaNode
+}
+
+var _ Node = TryNode{}
+
+func (TryNode) Kind() NodeKind {
+	return NTry
+}
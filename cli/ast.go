@@ -1,18 +1,14 @@
 package cli
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/syzkrash/skol/ast"
 	"github.com/syzkrash/skol/common"
 	"github.com/syzkrash/skol/common/pe"
-	"github.com/syzkrash/skol/debug"
-	"github.com/syzkrash/skol/parser"
 	"github.com/syzkrash/skol/typecheck"
 )
 
@@ -55,33 +51,7 @@ func runAst(args []string) error {
 		return err
 	}
 
-	errs := make(chan error)
-
-	go func() {
-		typecheck.NewChecker(errs).Check(tree)
-		close(errs)
-	}()
-
-	var errOne error
-
-	for err := range errs {
-		if err == nil {
-			continue
-		}
-
-		if errOne == nil {
-			errOne = err
-			continue
-		}
-
-		if perr, ok := err.(common.Printable); ok {
-			perr.Print()
-		} else {
-			fmt.Fprintf(os.Stderr, "Error: %s", err)
-		}
-	}
-
-	if errOne != nil {
+	if err := checkAST(tree); err != nil {
 		return err
 	}
 
@@ -106,6 +76,8 @@ func runAst(args []string) error {
 	fmt.Printf("  %d global functions\n", len(tree.Funcs))
 	fmt.Printf("  %d external functions\n", len(tree.Exerns))
 	fmt.Printf("  %d structures\n", len(tree.Structs))
+	fmt.Printf("  %d unions\n", len(tree.Unions))
+	fmt.Printf("  %d type aliases\n", len(tree.Aliases))
 
 	fmt.Println()
 
@@ -164,93 +136,68 @@ func runAst(args []string) error {
 		for _, f := range s.Fields {
 			fmt.Printf("    Field %s: %s\n", f.Name, f.Type)
 		}
+		for _, m := range tree.Methods[s.Name] {
+			fmt.Printf("    Method %s -> %s\n", m.Name, m.Ret)
+		}
 	}
 	if len(tree.Structs) == 0 {
 		fmt.Println("  (none)")
 	}
 
-	return nil
-}
+	fmt.Println()
 
-func parseOrCacheAST(input string) (tree ast.AST, err error) {
-	debug.Log(debug.AttrCache, "Checking for AST cache for %s", input)
-	cacheName := common.CachedASTName(input)
-	asts, err := os.Stat(cacheName)
-	if err == nil {
-		srcs, err := os.Stat(input)
-		if err == nil {
-			if srcs.ModTime().Before(asts.ModTime()) {
-				return loadCachedAST(cacheName)
-			}
+	fmt.Println("Unions:")
+	for _, u := range tree.Unions {
+		fmt.Printf("  Union %s:\n", u.Name)
+		for _, v := range u.Variants {
+			fmt.Printf("    Variant %s: %s\n", v.Name, v.Type)
 		}
 	}
-	return parseAST(input, cacheName)
-}
+	if len(tree.Unions) == 0 {
+		fmt.Println("  (none)")
+	}
 
-func loadCachedAST(input string) (tree ast.AST, err error) {
-	debug.Log(debug.AttrCache, "Loading cached AST from %s", input)
-	// we don't need to check if the file exists as this function would not get
-	// called if it didn't (due to the os.Stat call)
-	f, _ := os.Open(input)
-	defer f.Close()
-	return ast.Decode(f)
-}
+	fmt.Println()
 
-func parseAST(input, cacheName string) (tree ast.AST, err error) {
-	debug.Log(debug.AttrCache, "No cached AST found for %s", input)
-	f, err := os.Open(input)
-	if err != nil {
-		err = pe.New(pe.EBadInput).Cause(err)
-		return
+	fmt.Println("Type aliases:")
+	for _, a := range tree.Aliases {
+		fmt.Printf("  Alias %s: %s\n", a.Name, a.Type)
 	}
-	data, err := io.ReadAll(f)
-	f.Close()
-	if err != nil {
-		err = pe.New(pe.EBadInput).Cause(err)
-		return
+	if len(tree.Aliases) == 0 {
+		fmt.Println("  (none)")
 	}
 
+	return nil
+}
+
+// checkAST typechecks the given AST, printing all the errors that occur
+// except for the first one, which is returned.
+func checkAST(tree ast.AST) error {
 	errs := make(chan error)
-	var errOne error
 
 	go func() {
-		for err := range errs {
-			if err == nil {
-				continue
-			}
-
-			if errOne == nil {
-				errOne = err
-				continue
-			}
-
-			if perr, ok := err.(common.Printable); ok {
-				perr.Print()
-			} else {
-				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			}
-		}
+		typecheck.NewChecker(errs).Check(tree)
+		close(errs)
 	}()
 
-	src := bytes.NewReader(data)
-	p := parser.NewParser(input, src, "ast", errs)
+	var errOne error
 
-	tree = p.Parse()
-	close(errs)
-	if errOne != nil {
-		err = errOne
-		return
-	}
+	for err := range errs {
+		if err == nil {
+			continue
+		}
 
-	f, err = os.Create(cacheName)
-	if err != nil {
-		err = pe.New(pe.EBadAST).Cause(err)
-		return
-	}
-	err = ast.Encode(f, tree)
-	if err == nil {
-		debug.Log(debug.AttrCache, "Cached AST for %s", input)
+		if errOne == nil {
+			errOne = err
+			continue
+		}
+
+		if perr, ok := err.(common.Printable); ok {
+			perr.Print()
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
 	}
-	f.Close()
-	return
+
+	return errOne
 }
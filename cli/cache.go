@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/debug"
+	"github.com/syzkrash/skol/parser"
+)
+
+// CacheCommand defines the `skol cache` command.
+var CacheCommand = Command{
+	Name:  "cache",
+	Short: "Manage the AST cache",
+	Long: `
+Usage: skol cache <action>
+Where action can be one of:
+  stats  :: Print the location, amount and total size of cached ASTs.
+  clean  :: Remove all cached ASTs.
+  verify :: Ensure all cached ASTs can be loaded, removing the ones that can't.
+
+Parsed files are cached as ASTs, which are identified by the Skol version, the
+AST format version, the file's name and the file's contents. The cache is
+stored in the user's cache directory, unless the ` + common.CacheDirEnv + `
+environment variable is set.`,
+	Run: runCache,
+}
+
+func runCache(args []string) error {
+	if len(args) < 1 {
+		return pe.New(pe.EUnknownAction)
+	}
+
+	switch args[0] {
+	case "stats":
+		return cacheStats()
+	case "clean":
+		return cacheClean()
+	case "verify":
+		return cacheVerify()
+	default:
+		return pe.New(pe.EUnknownAction).Section("Action", args[0])
+	}
+}
+
+// cacheEntries lists the paths of all the cached ASTs
+func cacheEntries() (entries []string, err error) {
+	dir := common.CacheDir()
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, pe.New(pe.EBadCache).Cause(err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), common.CacheExt) {
+			continue
+		}
+		entries = append(entries, filepath.Join(dir, f.Name()))
+	}
+	return
+}
+
+func cacheStats() error {
+	entries, err := cacheEntries()
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, e := range entries {
+		if s, err := os.Stat(e); err == nil {
+			size += s.Size()
+		}
+	}
+
+	fmt.Println("AST cache:")
+	fmt.Printf("  Directory: %s\n", common.CacheDir())
+	fmt.Printf("  %d cached ASTs\n", len(entries))
+	fmt.Printf("  %d bytes total\n", size)
+	return nil
+}
+
+func cacheClean() error {
+	entries, err := cacheEntries()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := os.Remove(e); err != nil {
+			return pe.New(pe.EBadCache).Cause(err)
+		}
+	}
+
+	fmt.Printf("Removed %d cached ASTs\n", len(entries))
+	return nil
+}
+
+func cacheVerify() error {
+	entries, err := cacheEntries()
+	if err != nil {
+		return err
+	}
+
+	bad := 0
+	for _, e := range entries {
+		if _, err := loadCachedAST(e); err != nil {
+			bad++
+			fmt.Printf("  %s: %s\n", filepath.Base(e), err)
+			if err := os.Remove(e); err != nil {
+				return pe.New(pe.EBadCache).Cause(err)
+			}
+		}
+	}
+
+	fmt.Printf("Verified %d cached ASTs, removed %d\n", len(entries), bad)
+	return nil
+}
+
+// parseOrCacheAST reads the given file and loads it's AST from the cache. If
+// the AST is not cached or the cached AST can't be used, the file is parsed
+// and the resulting AST is cached.
+func parseOrCacheAST(input string) (tree ast.AST, err error) {
+	f, err := os.Open(input)
+	if err != nil {
+		err = pe.New(pe.EBadInput).Cause(err)
+		return
+	}
+	src, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		err = pe.New(pe.EBadInput).Cause(err)
+		return
+	}
+
+	debug.Log(debug.AttrCache, "Checking for AST cache for %s", input)
+	cacheName := common.CachedASTName(input, src)
+	tree, err = loadCachedAST(cacheName)
+	if err == nil {
+		return
+	}
+	// this is either a cache miss or a cache written with a different format
+	// version, so we just parse the file again
+	debug.Log(debug.AttrCache, "Could not load cached AST: %s", err)
+
+	tree, err = parseAST(input, src)
+	if err != nil {
+		// the partial AST is returned along with the error, but never cached
+		return
+	}
+	if err := storeCachedAST(cacheName, tree); err != nil {
+		// failing to cache the AST should not stop us from using it
+		debug.Log(debug.AttrCache, "Could not cache AST: %s", err)
+	}
+	return
+}
+
+func loadCachedAST(input string) (tree ast.AST, err error) {
+	debug.Log(debug.AttrCache, "Loading cached AST from %s", input)
+	f, err := os.Open(input)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return ast.Decode(f)
+}
+
+// storeCachedAST encodes the AST into a temporary file, which is then renamed
+// to the cache file. This ensures a half-written cache file is never loaded.
+func storeCachedAST(cacheName string, tree ast.AST) error {
+	f, err := os.CreateTemp(filepath.Dir(cacheName), "*.tmp")
+	if err != nil {
+		return pe.New(pe.EBadCache).Cause(err)
+	}
+	err = ast.Encode(f, tree)
+	f.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), cacheName)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return pe.New(pe.EBadCache).Cause(err)
+	}
+	debug.Log(debug.AttrCache, "Cached AST as %s", cacheName)
+	return nil
+}
+
+func parseAST(input string, src []byte) (tree ast.AST, err error) {
+	errs := make(chan error)
+	var errOne error
+	done := make(chan struct{})
+
+	go func() {
+		for err := range errs {
+			if err == nil {
+				continue
+			}
+
+			if errOne == nil {
+				errOne = err
+				continue
+			}
+
+			if perr, ok := err.(common.Printable); ok {
+				perr.Print()
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			}
+		}
+		close(done)
+	}()
+
+	p := parser.NewParser(input, bytes.NewReader(src), "ast", errs)
+
+	tree = p.Parse()
+	close(errs)
+	<-done
+	err = errOne
+	return
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syzkrash/skol/common"
+)
+
+// useCache points the AST cache at a temporary directory and writes a source
+// file into it, returning the path of the source file.
+func useCache(t *testing.T, src string) string {
+	dir := t.TempDir()
+	t.Setenv(common.CacheDirEnv, filepath.Join(dir, "cache"))
+	input := filepath.Join(dir, "test.sk")
+	writeSource(t, input, src)
+	return input
+}
+
+func writeSource(t *testing.T, input, src string) {
+	if err := os.WriteFile(input, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectEntries(t *testing.T, want int) []string {
+	entries, err := cacheEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != want {
+		t.Fatalf("expected %d cached ASTs, got %d", want, len(entries))
+	}
+	return entries
+}
+
+func TestCacheHit(t *testing.T) {
+	input := useCache(t, "$One/int(>1)\n")
+
+	// the first parse misses the cache and stores the AST
+	tree, err := parseOrCacheAST(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.Funcs["One"]; !ok {
+		t.Fatal("expected function One")
+	}
+	entries := expectEntries(t, 1)
+
+	// replace the cached AST with another one, so a cache hit can be told apart
+	// from parsing the file again
+	other, err := parseAST("other.sk", []byte("$Two/int(>2)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeCachedAST(entries[0], other); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = parseOrCacheAST(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.Funcs["Two"]; !ok {
+		t.Fatal("expected the AST to be loaded from the cache")
+	}
+	expectEntries(t, 1)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	input := useCache(t, "$One/int(>1)\n")
+
+	if _, err := parseOrCacheAST(input); err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, 1)
+
+	// a changed file must not use the AST cached for its old contents
+	writeSource(t, input, "$Two/int(>2)\n")
+	tree, err := parseOrCacheAST(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.Funcs["Two"]; !ok {
+		t.Fatal("expected the changed file to be parsed again")
+	}
+	if _, ok := tree.Funcs["One"]; ok {
+		t.Fatal("expected the old AST to not be used")
+	}
+	expectEntries(t, 2)
+}
+
+func TestCacheNoErrors(t *testing.T) {
+	input := useCache(t, "$One/int(>)\n")
+
+	// ASTs with errors are never cached
+	if _, err := parseOrCacheAST(input); err == nil {
+		t.Fatal("expected an error")
+	}
+	expectEntries(t, 0)
+}
+
+func TestCacheClean(t *testing.T) {
+	input := useCache(t, "$One/int(>1)\n")
+
+	if _, err := parseOrCacheAST(input); err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, 1)
+
+	if err := runCache([]string{"clean"}); err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, 0)
+}
+
+func TestCacheVerify(t *testing.T) {
+	input := useCache(t, "$One/int(>1)\n")
+
+	if _, err := parseOrCacheAST(input); err != nil {
+		t.Fatal(err)
+	}
+	good := expectEntries(t, 1)[0]
+
+	bad := filepath.Join(common.CacheDir(), "bad"+common.CacheExt)
+	if err := os.WriteFile(bad, []byte("not an AST"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectEntries(t, 2)
+
+	// only the entry that can't be loaded is removed
+	if err := runCache([]string{"verify"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := expectEntries(t, 1)[0]; got != good {
+		t.Fatalf("expected %s to be kept, got %s", good, got)
+	}
+}
@@ -18,5 +18,7 @@ func init() {
 		CompileCommand,
 		ReplCommand,
 		LintCommand,
+		CacheCommand,
+		TokensCommand,
 	}
 }
@@ -3,16 +3,12 @@ package cli
 import (
 	"bytes"
 	"flag"
-	"fmt"
 	"io"
 	"os"
 
 	"github.com/syzkrash/skol/codegen"
 	"github.com/syzkrash/skol/codegen/py"
-	"github.com/syzkrash/skol/common"
 	"github.com/syzkrash/skol/common/pe"
-	"github.com/syzkrash/skol/parser"
-	"github.com/syzkrash/skol/typecheck"
 )
 
 // CompileCommand represents the `skol compile` command
@@ -49,17 +45,6 @@ func compile(args []string) error {
 	flags.BoolVar(&run, "run", false, "")
 	flags.Parse(args[2:])
 
-	srcf, err := os.Open(input)
-	if err != nil {
-		return pe.New(pe.EBadInput).Cause(err)
-	}
-	defer srcf.Close()
-
-	srcraw, err := io.ReadAll(srcf)
-	if err != nil {
-		return pe.New(pe.EBadInput).Cause(err)
-	}
-
 	var e codegen.Engine
 	switch engine {
 	case "py":
@@ -68,47 +53,12 @@ func compile(args []string) error {
 		return pe.New(pe.EUnknownEngine).Section("Engine", engine)
 	}
 
-	errs := make(chan error)
-	var errOne error
-
-	go func() {
-		for err := range errs {
-			if err == nil {
-				continue
-			}
-
-			if errOne == nil {
-				errOne = err
-				continue
-			}
-
-			if perr, ok := err.(common.Printable); ok {
-				perr.Print()
-			} else {
-				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			}
-		}
-	}()
-
-	p := parser.NewParser(input, bytes.NewReader(srcraw), engine, errs)
-	ast := p.Parse()
-	if errOne != nil {
-		close(errs)
-		return errOne
+	ast, err := parseOrCacheAST(input)
+	if err != nil {
+		return err
 	}
 
-	// cool note:
-	// It is neat to have a separate goroutine for typechecking and a separate one
-	// for printing to stderr. Because printing to stderr is quite slow, this does
-	// offer a very slight speedup, especially in case of many errors.
-
-	errs = make(chan error)
-	errOne = nil
-
-	typecheck.NewChecker(errs).Check(ast)
-	close(errs)
-
-	if errOne != nil {
+	if err := checkAST(ast); err != nil {
 		return err
 	}
 
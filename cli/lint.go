@@ -1,17 +1,11 @@
 package cli
 
 import (
-	"bytes"
-	"fmt"
-	"io"
-	"os"
 	"sync"
 
 	"github.com/syzkrash/skol/ast"
-	"github.com/syzkrash/skol/common"
 	"github.com/syzkrash/skol/common/pe"
 	"github.com/syzkrash/skol/lint"
-	"github.com/syzkrash/skol/parser"
 )
 
 // LintCommand defines the `skol lint` command.
@@ -29,45 +23,9 @@ func runLint(args []string) error {
 
 	input := args[0]
 
-	srcf, err := os.Open(input)
-	if err != nil {
-		return pe.New(pe.EBadInput).Cause(err)
-	}
-	defer srcf.Close()
-
-	srcraw, err := io.ReadAll(srcf)
-	if err != nil {
-		return pe.New(pe.EBadInput).Cause(err)
-	}
-
-	errs := make(chan error)
-	var errOne error
-
-	go func() {
-		for err := range errs {
-			if err == nil {
-				continue
-			}
-
-			if errOne == nil {
-				errOne = err
-				continue
-			}
-
-			if perr, ok := err.(common.Printable); ok {
-				perr.Print()
-			} else {
-				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-			}
-		}
-	}()
-
-	p := parser.NewParser(input, bytes.NewReader(srcraw), "lint", errs)
-	tree := p.Parse()
-	close(errs)
-	if errOne != nil {
-		return errOne
-	}
+	// the parser recovers from errors, so whatever could be parsed is still
+	// linted and the error is returned afterwards
+	tree, err := parseOrCacheAST(input)
 
 	wg := sync.WaitGroup{}
 	wg.Add(len(lint.Rules))
@@ -79,6 +37,13 @@ func runLint(args []string) error {
 					check(warns, n, r)
 				}
 			}
+			for _, ms := range tree.Methods {
+				for _, m := range ms {
+					for _, n := range m.Body {
+						check(warns, n, r)
+					}
+				}
+			}
 			wg.Done()
 		}(r)
 	}
@@ -92,7 +57,7 @@ func runLint(args []string) error {
 		w.Print()
 	}
 
-	return nil
+	return err
 }
 
 func check(w chan *lint.Warn, n ast.MetaNode, r lint.Rule) {
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/syzkrash/skol/common"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+)
+
+// TokensCommand defines the `skol tokens` command.
+var TokensCommand = Command{
+	Name:  "tokens",
+	Short: "Dump file tokens",
+	Long: `
+Usage: skol tokens <file> [arguments...]
+Where arguments can be any combination of:
+  -json :: Print tokens as JSON
+
+Prints every token of the file, including whitespace and comments, along with
+it's kind, punctuator name, raw value and position. Concatenating the text of
+all tokens gives back the original file. Invalid input is printed as Error
+tokens, and the errors are reported after all tokens have been printed.`,
+	Run: runTokens,
+}
+
+// jsonToken is the JSON representation of a token used by `skol tokens -json`
+type jsonToken struct {
+	Kind  string     `json:"kind"`
+	Punct string     `json:"punct,omitempty"`
+	Raw   string     `json:"raw"`
+	Text  string     `json:"text"`
+	Where lexer.Span `json:"where"`
+}
+
+func runTokens(args []string) error {
+	if len(args) < 1 {
+		return pe.New(pe.ENoInput)
+	}
+
+	input := args[0]
+
+	var asJSON bool
+
+	flags := flag.NewFlagSet("skol tokens", flag.ContinueOnError)
+	flags.BoolVar(&asJSON, "json", false, "")
+	flags.Parse(args[1:])
+
+	f, err := os.Open(input)
+	if err != nil {
+		return pe.New(pe.EBadInput).Cause(err)
+	}
+	defer f.Close()
+
+	lex := lexer.NewLexer(bufio.NewReader(f), input)
+	lex.Trivia = true
+	toks, err := lex.All()
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		out := make([]jsonToken, len(toks))
+		for i, t := range toks {
+			out[i] = jsonToken{
+				Kind:  t.Kind.String(),
+				Raw:   t.Raw,
+				Text:  t.Text,
+				Where: t.Where,
+			}
+			if p, ok := t.Punct(); ok {
+				out[i].Punct = p.String()
+			}
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			return pe.New(pe.EBadInput).Cause(err)
+		}
+		os.Stdout.Write(data)
+	} else {
+		for _, t := range toks {
+			punct := ""
+			if p, ok := t.Punct(); ok {
+				punct = p.String()
+			}
+			fmt.Printf("%-16s %-11s %-14s %q\n", fmt.Sprintf("%d:%d-%d:%d",
+				t.Where.Start.Line, t.Where.Start.Col, t.Where.End.Line, t.Where.End.Col),
+				t.Kind, punct, t.Raw)
+		}
+	}
+
+	if len(lex.Err) == 0 {
+		return nil
+	}
+	for _, e := range lex.Err[1:] {
+		if perr, ok := e.(common.Printable); ok {
+			perr.Print()
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", e)
+		}
+	}
+	return lex.Err[0]
+}
@@ -1,9 +1,13 @@
 package py
 
 import (
+	"bytes"
 	_ "embed"
 	"fmt"
 	"io"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/syzkrash/skol/ast"
@@ -19,15 +23,102 @@ var preamble []byte
 //go:embed epilogue.py
 var epilogue []byte
 
-var reservedFuncs = map[string]string{
-	"and": "and_",
-	"or":  "or_",
+// builtinFuncs maps the Skol built-in functions to the Python functions
+// implementing them, which are either Python built-ins or defined by the
+// preamble
+var builtinFuncs = map[string]string{
+	"add": "add", "sub": "sub", "mul": "mul", "div": "div", "pow": "pow",
+	"mod": "mod",
+
+	"eq": "eq", "gt": "gt", "lt": "lt",
+
+	"and": "and_", "or": "or_", "not": "not_",
+
+	"append": "append", "concat": "concat", "slice": "slice", "at": "at",
+	"len": "len",
+
+	"get":    "map_get",
+	"set":    "map_set",
+	"delete": "map_delete",
+	"has":    "map_has",
+	"keys":   "map_keys",
+
+	"str": "str", "bool": "bool", "parse_bool": "parse_bool",
+	"char": "to_char", "int": "to_int", "float": "to_float",
+
+	"print": "print",
+}
+
+// pyBuiltins are the Python built-in names that generated code, the preamble
+// and the epilogue rely on
+var pyBuiltins = []string{
+	"print", "str", "len", "int", "float", "bool", "list", "dict", "tuple",
+	"object", "enumerate", "chr", "ord", "map", "isinstance", "getattr",
+	"property", "Exception", "NameError", "traceback",
+}
+
+// preambleName matches the names defined at the top level of the preamble
+var preambleName = regexp.MustCompile(`(?m)^(?:def |class |import |from \S+ import )?(\w+)(?: =|\(|:| *$)`)
+
+// reservedNames are the names that user identifiers cannot take in generated
+// code: Python keywords, the names defined by the preamble and the Python
+// built-ins listed in pyBuiltins.
+var reservedNames = func() map[string]bool {
+	names := make(map[string]bool)
+	for k := range pyKeywords {
+		names[k] = true
+	}
+	for _, b := range pyBuiltins {
+		names[b] = true
+	}
+	for _, m := range preambleName.FindAllSubmatch(preamble, -1) {
+		names[string(m[1])] = true
+	}
+	return names
+}()
+
+// pyName returns the Python name of a variable or function. Names that are
+// reserved get an underscore appended, as does any name that would otherwise
+// end up the same as the mangled version of a reserved name.
+func pyName(name string) string {
+	if reservedNames[strings.TrimRight(name, "_")] {
+		return name + "_"
+	}
+	return name
+}
+
+// pyKeywords are the Python keywords that are valid Skol names
+var pyKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true,
+	"assert": true, "async": true, "await": true, "break": true, "class": true,
+	"continue": true, "def": true, "del": true, "elif": true, "else": true,
+	"except": true, "finally": true, "for": true, "from": true, "global": true,
+	"if": true, "import": true, "in": true, "is": true, "lambda": true,
+	"nonlocal": true, "not": true, "or": true, "pass": true, "raise": true,
+	"return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// attrName returns the name of the Python attribute for the given field or
+// variant name, which cannot be a keyword
+func attrName(name string) string {
+	if pyKeywords[name] {
+		return name + "_"
+	}
+	return name
 }
 
 type generator struct {
 	out    io.Writer
 	in     ast.AST
 	indent int
+	// hoisted receives the definitions of the anonymous functions used by the
+	// statement being written, which are written before the statement itself
+	hoisted *bytes.Buffer
+	lambdas int
+	matches int
+	// locals holds the names of the variables of every function being written,
+	// innermost last
+	locals []map[string]bool
 }
 
 var _ codegen.Generator = &generator{}
@@ -43,16 +134,26 @@ func (g *generator) Input(t ast.AST) {
 }
 
 func (g *generator) Generate() error {
+	// aliases come first, as they may be used in the type hints of anything
+	// else
+	for _, a := range g.in.Aliases {
+		g.writeAlias(a.Name, a.Type)
+	}
 	for _, t := range g.in.Structs {
 		g.writeClass_(t)
 	}
+	for _, u := range g.in.Unions {
+		g.writeUnion(u)
+	}
 	for n, t := range g.in.Typedefs {
-		g.write("%s: %s\n", n, g.pyType(t.Type))
+		g.write("%s: %s\n", pyName(n), g.pyType(t.Type))
 	}
 	for n, v := range g.in.Vars {
-		g.write("%s = ", n)
-		g.writeValue(v.Value)
-		g.write("\n")
+		g.hoist(func() error {
+			g.write("%s = ", pyName(n))
+			g.writeValue(v.Value)
+			return g.write("\n")
+		})
 	}
 	for _, f := range g.in.Funcs {
 		g.writeFunc_(f)
@@ -76,7 +177,23 @@ func (g *generator) write(format string, args ...any) error {
 	return err
 }
 
+// className returns the Python name of a structure, union or alias. Types
+// declared by the program are renamed like any other name, so they can shadow
+// the built-in Result structure without replacing the preamble's class.
+func (g *generator) className(name string) string {
+	_, isStruct := g.in.Structs[name]
+	_, isUnion := g.in.Unions[name]
+	_, isAlias := g.in.Aliases[name]
+	if name == types.ResultStruct.Name && !isStruct && !isUnion && !isAlias {
+		return name
+	}
+	return pyName(name)
+}
+
 func (g *generator) pyType(st types.Type) string {
+	if a, ok := st.(types.AliasType); ok {
+		return g.className(a.Name)
+	}
 	t := ""
 	switch {
 	case types.Bool.Equals(st):
@@ -91,8 +208,20 @@ func (g *generator) pyType(st types.Type) string {
 		t = "str"
 	case st.Prim() == types.PArray:
 		t = "list"
+	case st.Prim() == types.PMap:
+		t = "dict"
+	case st.Prim() == types.PTuple:
+		t = "tuple"
 	case st.Prim() == types.PStruct:
-		t = st.(types.StructType).Name
+		// generic structures are erased, so every instance uses the same class.
+		// the name is quoted as classes may refer to classes defined after them
+		t = strconv.Quote(g.className(st.(types.StructType).Name))
+	case st.Prim() == types.PUnion:
+		t = strconv.Quote(g.className(st.(types.UnionType).Name))
+	case st.Prim() == types.PParam:
+		t = "object"
+	case st.Prim() == types.PFunc:
+		t = "Callable"
 	default:
 		panic("pyType() call got unexpected type: " + st.String())
 	}
@@ -100,11 +229,16 @@ func (g *generator) pyType(st types.Type) string {
 }
 
 func (g *generator) writeArg(a types.Descriptor) error {
-	return g.write("%s: %s,", a.Name, g.pyType(a.Type))
+	return g.write("%s: %s,", pyName(a.Name), g.pyType(a.Type))
 }
 
 func (g *generator) writeBlock(b ast.Block) error {
 	g.indent++
+	if len(b) == 0 {
+		// python does not allow empty blocks
+		g.writeIndent()
+		g.write("pass\n")
+	}
 	for _, n := range b {
 		if err := g.writeStmt(n); err != nil {
 			return err
@@ -114,7 +248,26 @@ func (g *generator) writeBlock(b ast.Block) error {
 	return nil
 }
 
+// hoist calls write with a new hoisting buffer, then writes the hoisted
+// definitions followed by whatever write wrote.
+func (g *generator) hoist(write func() error) error {
+	out, hoisted := g.out, g.hoisted
+	stmt := &bytes.Buffer{}
+	g.out, g.hoisted = stmt, &bytes.Buffer{}
+	err := write()
+	out.Write(g.hoisted.Bytes())
+	out.Write(stmt.Bytes())
+	g.out, g.hoisted = out, hoisted
+	return err
+}
+
 func (g *generator) writeStmt(mn ast.MetaNode) error {
+	return g.hoist(func() error {
+		return g.writeStmt_(mn)
+	})
+}
+
+func (g *generator) writeStmt_(mn ast.MetaNode) error {
 	if err := g.writeIndent(); err != nil {
 		return err
 	}
@@ -124,39 +277,168 @@ func (g *generator) writeStmt(mn ast.MetaNode) error {
 		return g.writeIf(n.(ast.IfNode))
 	case ast.NWhile:
 		return g.writeWhile(n.(ast.WhileNode))
+	case ast.NMatch:
+		return g.writeMatch(n.(ast.MatchNode))
+	case ast.NForEach:
+		return g.writeForEach(n.(ast.ForEachNode))
+	case ast.NBreak:
+		return g.write("break\n")
+	case ast.NContinue:
+		return g.write("continue\n")
 	case ast.NReturn:
 		return g.writeReturn(n.(ast.ReturnNode))
 	case ast.NVarSet:
 		return g.writeVarSet(n.(ast.VarSetNode))
+	case ast.NSelectorSet:
+		return g.writeSelectorSet(n.(ast.SelectorSetNode))
+	case ast.NDestructure:
+		return g.writeDestructure(n.(ast.DestructureNode))
 	case ast.NVarDef:
 		return g.writeVarDef(n.(ast.VarDefNode))
 	case ast.NVarSetTyped:
 		return g.writeVarSetTyped(n.(ast.VarSetTypedNode))
 	case ast.NFuncDef:
-		return g.writeFunc(n.(ast.FuncDefNode))
+		nfd := n.(ast.FuncDefNode)
+		nfd.Name = pyName(nfd.Name)
+		return g.writeFunc(nfd)
 	case ast.NFuncExtern:
 		return nil
 	case ast.NStructDef:
 		return g.writeClass(n.(ast.StructDefNode))
+	case ast.NAliasDef:
+		nad := n.(ast.AliasDefNode)
+		return g.writeAlias(nad.Name, nad.Type)
 	case ast.NFuncCall:
 		return g.writeCall(n.(ast.FuncCallNode), true)
+	case ast.NMethodCall:
+		return g.writeMethodCall(n.(ast.MethodCallNode), true)
+	case ast.NTry:
+		g.writeValue(mn)
+		return g.write("\n")
 	default:
 		panic("writeStmt() unexpected argument: " + n.Kind().String())
 	}
 }
 
 func (g *generator) writeFunc(n ast.FuncDefNode) error {
+	if _, ok := types.IsResult(n.Ret); ok {
+		g.write("@propagates\n")
+		g.writeIndent()
+	}
 	g.write("def %s(", n.Name)
 	for _, a := range n.Proto {
 		g.writeArg(a)
 	}
 	g.write("):\n")
-	return g.writeBlock(n.Body)
+
+	// variables of enclosing functions are captured by reference, so assigning
+	// one of them must not create a new local variable
+	own := make(map[string]bool)
+	for _, a := range n.Proto {
+		own[a.Name] = true
+	}
+	assigned, local := bindings(n.Body)
+	for _, v := range local {
+		own[v] = true
+	}
+	captured := []string{}
+	for _, v := range assigned {
+		if !own[v] && g.enclosing(v) {
+			captured = append(captured, pyName(v))
+		} else {
+			own[v] = true
+		}
+	}
+	if len(captured) > 0 {
+		g.indent++
+		g.writeIndent()
+		g.write("nonlocal %s\n", strings.Join(captured, ", "))
+		g.indent--
+	}
+
+	g.locals = append(g.locals, own)
+	err := g.writeBlock(n.Body)
+	g.locals = g.locals[:len(g.locals)-1]
+	return err
+}
+
+// enclosing checks whether the given variable belongs to one of the functions
+// enclosing the function being written.
+func (g *generator) enclosing(name string) bool {
+	for _, l := range g.locals {
+		if l[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// bindings returns the names of the variables assigned within the given block,
+// and the names bound by loops, match arms and nested functions, which are
+// always local to the block's function. Nested function bodies are not
+// included.
+func bindings(b ast.Block) (assigned, local []string) {
+	seen := make(map[string]bool)
+	add := func(to *[]string, name string) {
+		if !seen[name] {
+			seen[name] = true
+			*to = append(*to, name)
+		}
+	}
+	var pattern func(p ast.Pattern)
+	pattern = func(p ast.Pattern) {
+		if p.Kind == ast.PatBind && p.Bind != "" {
+			add(&local, p.Bind)
+		}
+		for _, f := range p.Fields {
+			pattern(f)
+		}
+	}
+	var block func(b ast.Block)
+	block = func(b ast.Block) {
+		for _, mn := range b {
+			switch n := mn.Node.(type) {
+			case ast.VarSetNode:
+				add(&assigned, n.Var)
+			case ast.VarSetTypedNode:
+				add(&assigned, n.Var)
+			case ast.VarDefNode:
+				add(&assigned, n.Var)
+			case ast.DestructureNode:
+				for _, v := range n.Vars {
+					add(&assigned, v)
+				}
+			case ast.FuncDefNode:
+				add(&local, n.Name)
+			case ast.IfNode:
+				block(n.Main.Block)
+				for _, o := range n.Other {
+					block(o.Block)
+				}
+				block(n.Else)
+			case ast.WhileNode:
+				block(n.Block)
+			case ast.ForEachNode:
+				if n.Index != "" {
+					add(&local, n.Index)
+				}
+				add(&local, n.Elem)
+				block(n.Block)
+			case ast.MatchNode:
+				for _, a := range n.Arms {
+					pattern(a.Pattern)
+					block(a.Block)
+				}
+			}
+		}
+	}
+	block(b)
+	return
 }
 
 func (g *generator) writeFunc_(f ast.Func) error {
 	return g.writeFunc(ast.FuncDefNode{
-		Name:  f.Name,
+		Name:  pyName(f.Name),
 		Proto: f.Args,
 		Ret:   f.Ret,
 		Body:  f.Body,
@@ -183,6 +465,77 @@ func (g *generator) writeIf(n ast.IfNode) error {
 	return g.writeBlock(n.Else)
 }
 
+// writeMatch lowers a match statement into an if-elif chain on a temporary
+// variable holding the matched value. Variables bound by a pattern are
+// assigned at the start of it's arm.
+func (g *generator) writeMatch(n ast.MatchNode) error {
+	subject := fmt.Sprintf("_match%d", g.matches)
+	g.matches++
+	g.write("%s = ", subject)
+	g.writeValue(n.Value)
+	g.write("\n")
+	for i, a := range n.Arms {
+		g.writeIndent()
+		conds, binds := g.pattern(a.Pattern, subject)
+		switch {
+		case len(conds) == 0 && i > 0:
+			g.write("else:\n")
+		case len(conds) == 0:
+			g.write("if True:\n")
+		case i > 0:
+			g.write("elif %s:\n", strings.Join(conds, " and "))
+		default:
+			g.write("if %s:\n", strings.Join(conds, " and "))
+		}
+		g.indent++
+		for _, b := range binds {
+			g.writeIndent()
+			g.write("%s\n", b)
+		}
+		g.indent--
+		if err := g.writeBlock(a.Block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pattern returns the conditions under which the value of the given Python
+// expression matches the pattern, and the assignments of the variables it
+// binds.
+func (g *generator) pattern(p ast.Pattern, expr string) (conds, binds []string) {
+	switch p.Kind {
+	case ast.PatBind:
+		if p.Bind != "" {
+			binds = append(binds, fmt.Sprintf("%s = %s", pyName(p.Bind), expr))
+		}
+	case ast.PatLiteral:
+		out := g.out
+		lit := &bytes.Buffer{}
+		g.out = lit
+		g.writeValue(p.Value)
+		g.out = out
+		conds = append(conds, fmt.Sprintf("%s == %s", expr, lit))
+	case ast.PatStruct:
+		for i, f := range p.Type.(types.StructType).Fields {
+			if i >= len(p.Fields) {
+				break
+			}
+			c, b := g.pattern(p.Fields[i], expr+"."+attrName(f.Name))
+			conds = append(conds, c...)
+			binds = append(binds, b...)
+		}
+	case ast.PatVariant:
+		conds = append(conds, fmt.Sprintf("%s._tag == %s", expr, strconv.Quote(p.Variant)))
+		if len(p.Fields) > 0 {
+			c, b := g.pattern(p.Fields[0], expr+"._value")
+			conds = append(conds, c...)
+			binds = append(binds, b...)
+		}
+	}
+	return
+}
+
 func (g *generator) writeWhile(n ast.WhileNode) error {
 	g.write("while ")
 	g.writeValue(n.Cond)
@@ -190,6 +543,20 @@ func (g *generator) writeWhile(n ast.WhileNode) error {
 	return g.writeBlock(n.Block)
 }
 
+func (g *generator) writeForEach(n ast.ForEachNode) error {
+	if n.Index == "" {
+		g.write("for %s in each(", pyName(n.Elem))
+	} else {
+		g.write("for %s, %s in enumerate(each(", pyName(n.Index), pyName(n.Elem))
+	}
+	g.writeValue(n.Iter)
+	if n.Index != "" {
+		g.write(")")
+	}
+	g.write("):\n")
+	return g.writeBlock(n.Block)
+}
+
 func (g *generator) writeReturn(n ast.ReturnNode) error {
 	g.write("return ")
 	g.writeValue(n.Value)
@@ -197,50 +564,99 @@ func (g *generator) writeReturn(n ast.ReturnNode) error {
 }
 
 func (g *generator) writeVarSet(n ast.VarSetNode) error {
-	g.write("%s = ", n.Var)
+	g.write("%s = ", pyName(n.Var))
+	g.writeValue(n.Value)
+	return g.write("\n")
+}
+
+// writeDestructure writes a destructuring assignment as Python's own tuple
+// unpacking.
+func (g *generator) writeDestructure(n ast.DestructureNode) error {
+	for _, v := range n.Vars {
+		g.write("%s, ", pyName(v))
+	}
+	g.write("= ")
+	g.writeValue(n.Value)
+	return g.write("\n")
+}
+
+// writeSelectorSet writes an assignment to a structure field or an array
+// element. Unlike [generator.writeSelector], indexes are written as plain
+// subscripts, as the assigned element is not wrapped in a Result.
+func (g *generator) writeSelectorSet(n ast.SelectorSetNode) error {
+	p := n.Target.Path()
+	g.write("%s", pyName(p[0].Name))
+	for _, e := range p[1:] {
+		if e.Name != "" {
+			g.write(".%s", attrName(e.Name))
+		} else if e.IdxS != nil {
+			g.write("[")
+			g.writeSelector(e.IdxS)
+			g.write("]")
+		} else {
+			g.write("[%d]", e.IdxC)
+		}
+	}
+	g.write(" = ")
 	g.writeValue(n.Value)
 	return g.write("\n")
 }
 
 func (g *generator) writeVarDef(n ast.VarDefNode) error {
-	return g.write("%s: %s\n", n.Var, g.pyType(n.Type))
+	return g.write("%s: %s\n", pyName(n.Var), g.pyType(n.Type))
 }
 
 func (g *generator) writeVarSetTyped(n ast.VarSetTypedNode) error {
-	g.write("%s: %s =", n.Var, g.pyType(n.Type))
+	g.write("%s: %s =", pyName(n.Var), g.pyType(n.Type))
 	g.writeValue(n.Value)
 	return g.write("\n")
 }
 
 func (g *generator) writeClass(n ast.StructDefNode) error {
-	g.write("class %s:\n", n.Name)
+	g.write("class %s:\n", g.className(n.Name))
 	g.indent++
 	g.writeIndent()
 	g.write("__slots__ = (")
 	for _, f := range n.Fields {
-		g.write(`"%s", `, f.Name)
+		g.write(`"%s", `, attrName(f.Name))
 	}
 	g.write(")\n")
 	for _, f := range n.Fields {
 		g.writeIndent()
-		g.write("%s: %s\n", f.Name, g.pyType(f.Type))
+		g.write("%s: %s\n", attrName(f.Name), g.pyType(f.Type))
 	}
 	g.writeIndent()
 	g.write("def __init__(self, ")
 	for _, f := range n.Fields {
-		g.write("%s: %s, ", f.Name, g.pyType(f.Type))
+		g.write("%s: %s, ", attrName(f.Name), g.pyType(f.Type))
 	}
 	g.write("):\n")
 	g.indent++
 	for _, f := range n.Fields {
 		g.writeIndent()
-		g.write("self.%s = %s\n", f.Name, f.Name)
+		g.write("self.%s = %s\n", attrName(f.Name), attrName(f.Name))
 	}
 	g.indent--
+	for _, m := range g.in.Methods[n.Name] {
+		g.writeIndent()
+		g.writeFunc(ast.FuncDefNode{
+			Name:  attrName(m.Name),
+			Proto: m.Args,
+			Ret:   m.Ret,
+			Body:  m.Body,
+		})
+	}
 	g.indent--
 	return nil
 }
 
+// writeAlias writes a type alias as a Python variable holding the aliased type,
+// so it can be used in type hints. Aliases of aliases refer to the aliased type
+// directly, as aliases are written in no particular order.
+func (g *generator) writeAlias(name string, t types.Type) error {
+	return g.write("%s = %s\n", g.className(name), g.pyType(types.Unalias(t)))
+}
+
 func (g *generator) writeClass_(s ast.Structure) error {
 	return g.writeClass(ast.StructDefNode{
 		Name:   s.Name,
@@ -248,10 +664,41 @@ func (g *generator) writeClass_(s ast.Structure) error {
 	})
 }
 
+// writeUnion writes a class for the given tagged union. Every variant becomes a
+// property, which returns a Result of the payload that is only ok if the value
+// is that variant.
+func (g *generator) writeUnion(u ast.Union) error {
+	g.write("class %s:\n", g.className(u.Name))
+	g.indent++
+	g.writeIndent()
+	g.write("__slots__ = (\"_tag\", \"_value\", )\n")
+	g.writeIndent()
+	g.write("def __init__(self, tag: str, value, ):\n")
+	g.indent++
+	g.writeIndent()
+	g.write("self._tag = tag\n")
+	g.writeIndent()
+	g.write("self._value = value\n")
+	g.indent--
+	for _, v := range u.Variants {
+		g.writeIndent()
+		g.write("@property\n")
+		g.writeIndent()
+		g.write("def %s(self):\n", attrName(v.Name))
+		g.indent++
+		g.writeIndent()
+		g.write("return Result(self._tag == %s, self._value)\n", strconv.Quote(v.Name))
+		g.indent--
+	}
+	g.indent--
+	return nil
+}
+
 func (g *generator) writeCall(n ast.FuncCallNode, stmt bool) error {
-	fn := n.Func
-	if altname, ok := reservedFuncs[n.Func]; ok {
-		fn = altname
+	// named functions take priority over built-in functions, like in the parser
+	fn, ok := builtinFuncs[n.Func]
+	if _, isFunc := g.in.Funcs[n.Func]; isFunc || !ok {
+		fn = pyName(n.Func)
 	}
 	g.write("%s(", fn)
 	for _, a := range n.Args {
@@ -264,9 +711,43 @@ func (g *generator) writeCall(n ast.FuncCallNode, stmt bool) error {
 	return g.write(")")
 }
 
-var escaper = strings.NewReplacer(
-	"\"", "\\\"",
-	"\n", "\\n")
+// writeMethodCall writes a call to a method through the class of the structure
+// it was found on, passing the receiver as the first argument. Calling the
+// method on the receiver itself could find a different method, as the receiver
+// may be a value of any structure with the same fields.
+func (g *generator) writeMethodCall(n ast.MethodCallNode, stmt bool) error {
+	g.write("%s.%s(", n.Type, attrName(n.Method))
+	g.writeValue(n.Recv)
+	g.write(",")
+	for _, a := range n.Args {
+		g.writeValue(a)
+		g.write(",")
+	}
+	if stmt {
+		return g.write(")\n")
+	}
+	return g.write(")")
+}
+
+// pyFloat returns a Python literal for the given float that reads back as the
+// exact same value. Infinities and NaN have no literal, so they are written as
+// conversions from strings.
+func pyFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "float('inf')"
+	case math.IsInf(v, -1):
+		return "float('-inf')"
+	case math.IsNaN(v):
+		return "float('nan')"
+	}
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		// keep integral values floats
+		s += ".0"
+	}
+	return s
+}
 
 func (g *generator) writeValue(mn ast.MetaNode) error {
 	n := mn.Node
@@ -282,15 +763,37 @@ func (g *generator) writeValue(mn ast.MetaNode) error {
 	case ast.NInt:
 		return g.write("%d", n.(ast.IntNode).Value)
 	case ast.NFloat:
-		return g.write("%f", n.(ast.FloatNode).Value)
+		return g.write("%s", pyFloat(n.(ast.FloatNode).Value))
 	case ast.NString:
-		return g.write(`"%s"`, escaper.Replace(n.(ast.StringNode).Value))
+		// Go's quoted string syntax is valid Python as well, and it escapes any
+		// characters that can't be written as-is
+		return g.write("%s", strconv.Quote(n.(ast.StringNode).Value))
+	case ast.NInterp:
+		return g.writeInterp(n.(ast.InterpNode))
 	case ast.NStruct:
 		return g.writeInstance(n.(ast.StructNode))
+	case ast.NStructUpdate:
+		return g.writeUpdate(n.(ast.StructUpdateNode))
 	case ast.NArray:
 		return g.writeArray(n.(ast.ArrayNode))
+	case ast.NTuple:
+		return g.writeTuple(n.(ast.TupleNode))
+	case ast.NMap:
+		return g.writeMap(n.(ast.MapNode))
 	case ast.NFuncCall:
 		return g.writeCall(n.(ast.FuncCallNode), false)
+	case ast.NMethodCall:
+		return g.writeMethodCall(n.(ast.MethodCallNode), false)
+	case ast.NFuncRef:
+		return g.write("%s", pyName(n.(ast.FuncRefNode).Func))
+	case ast.NLambda:
+		return g.writeLambda(n.(ast.LambdaNode))
+	case ast.NVariant:
+		return g.writeVariant(n.(ast.VariantNode))
+	case ast.NTry:
+		g.write("try_(")
+		g.writeValue(n.(ast.TryNode).Value)
+		return g.write(")")
 	default:
 		if sel, ok := n.(ast.Selector); ok {
 			return g.writeSelector(sel)
@@ -299,8 +802,44 @@ func (g *generator) writeValue(mn ast.MetaNode) error {
 	}
 }
 
+// writeLambda hoists the given anonymous function into a named function
+// defined before the current statement, and writes its name.
+func (g *generator) writeLambda(n ast.LambdaNode) error {
+	name := fmt.Sprintf("_lambda%d", g.lambdas)
+	g.lambdas++
+	out := g.out
+	g.out = g.hoisted
+	g.writeIndent()
+	g.writeFunc(ast.FuncDefNode{
+		Name:  name,
+		Proto: n.Proto,
+		Ret:   n.Ret,
+		Body:  n.Body,
+	})
+	g.out = out
+	return g.write("%s", name)
+}
+
+// writeInterp writes an interpolated string as a join of it's parts and the
+// embedded values, which are turned into strings like the str builtin does.
+// Empty parts are left out.
+func (g *generator) writeInterp(n ast.InterpNode) error {
+	g.write("\"\".join((")
+	for i, p := range n.Parts {
+		if p != "" {
+			g.write("%s, ", strconv.Quote(p))
+		}
+		if i < len(n.Values) {
+			g.write("str(")
+			g.writeValue(n.Values[i])
+			g.write("), ")
+		}
+	}
+	return g.write("))")
+}
+
 func (g *generator) writeInstance(n ast.StructNode) error {
-	g.write("%s(", n.Type.Name)
+	g.write("%s(", g.className(n.Type.Name))
 	for _, f := range n.Args {
 		g.writeValue(f)
 		g.write(", ")
@@ -308,31 +847,79 @@ func (g *generator) writeInstance(n ast.StructNode) error {
 	return g.write(")")
 }
 
+// writeUpdate writes a structure update as a call to copy_with, which creates
+// a new instance taking every field not given as a keyword argument from the
+// base value.
+func (g *generator) writeUpdate(n ast.StructUpdateNode) error {
+	g.write("copy_with(%s, ", g.className(n.Type.Name))
+	g.writeValue(n.Base)
+	for i, f := range n.Fields {
+		g.write(", %s=", attrName(f))
+		g.writeValue(n.Values[i])
+	}
+	return g.write(")")
+}
+
+func (g *generator) writeVariant(n ast.VariantNode) error {
+	g.write("%s(%s, ", g.className(n.Type.Name), strconv.Quote(n.Variant))
+	if n.Value.Node == nil {
+		g.write("None")
+	} else {
+		g.writeValue(n.Value)
+	}
+	return g.write(")")
+}
+
+func (g *generator) writeTuple(n ast.TupleNode) error {
+	g.write("(")
+	for _, e := range n.Elems {
+		g.writeValue(e)
+		g.write(", ")
+	}
+	return g.write(")")
+}
+
 func (g *generator) writeArray(n ast.ArrayNode) error {
 	g.write("[")
 	for _, v := range n.Elems {
 		g.writeValue(v)
+		g.write(", ")
 	}
 	return g.write("]")
 }
 
+func (g *generator) writeMap(n ast.MapNode) error {
+	g.write("{")
+	for i, k := range n.Keys {
+		g.writeValue(k)
+		g.write(": ")
+		g.writeValue(n.Values[i])
+		g.write(", ")
+	}
+	return g.write("}")
+}
+
 func (g *generator) writeSelector(sel ast.Selector) error {
 	p := sel.Path()
-	g.write("%s", p[0].Name)
-	if len(p) == 1 {
-		return nil
+	// indexing returns a Result, so every index element wraps everything
+	// before it in a call to index()
+	for _, e := range p[1:] {
+		if e.Name == "" && e.Cast == nil {
+			g.write("index(")
+		}
 	}
+	g.write("%s", pyName(p[0].Name))
 	for _, e := range p[1:] {
 		if e.Name != "" {
-			g.write(".%s", e.Name)
+			g.write(".%s", attrName(e.Name))
 		} else if e.Cast != nil {
 			continue
 		} else if e.IdxS != nil {
-			g.write("[")
+			g.write(", ")
 			g.writeSelector(e.IdxS)
-			g.write("]")
+			g.write(")")
 		} else {
-			g.write("[%d]", e.IdxC)
+			g.write(", %d)", e.IdxC)
 		}
 	}
 	return nil
@@ -0,0 +1,245 @@
+package py
+
+import (
+	"bytes"
+	"math"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/parser"
+)
+
+// compile returns the Python program written for the given Skol code.
+func compile(t *testing.T, code string) string {
+	errs := make(chan error)
+	done := make(chan struct{})
+	var perr error
+	go func() {
+		for err := range errs {
+			if perr == nil {
+				perr = err
+			}
+		}
+		close(done)
+	}()
+	p := parser.NewParser("TestGenerate", strings.NewReader(code), "py", errs)
+	tree := p.Parse()
+	close(errs)
+	<-done
+	if perr != nil {
+		t.Fatal(perr)
+	}
+
+	out := &bytes.Buffer{}
+	g := &generator{}
+	g.Output(out)
+	g.Input(tree)
+	if err := g.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+// generate returns the Python code written for the given Skol code, without
+// the preamble and epilogue.
+func generate(t *testing.T, code string) string {
+	code = strings.TrimPrefix(compile(t, code), string(preamble))
+	return strings.TrimSuffix(code, string(epilogue))
+}
+
+// value returns the Python code written for the given value.
+func value(t *testing.T, n ast.Node) string {
+	out := &bytes.Buffer{}
+	g := &generator{out: out, hoisted: &bytes.Buffer{}}
+	if err := g.writeValue(ast.MetaNode{Node: n}); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestFloat(t *testing.T) {
+	cases := []struct {
+		Value float64
+		Code  string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-3, "-3.0"},
+		{1e-7, "1e-07"},
+		{0.0001, "0.0001"},
+		{1e300, "1e+300"},
+		{6.02214076e23, "6.02214076e+23"},
+		{math.Inf(1), "float('inf')"},
+		{math.Inf(-1), "float('-inf')"},
+		{math.NaN(), "float('nan')"},
+	}
+	for _, c := range cases {
+		if got := value(t, ast.FloatNode{Value: c.Value}); got != c.Code {
+			t.Fatalf("expected %s for %g, got %s", c.Code, c.Value, got)
+		}
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	cases := map[string]string{
+		"at":        "at_",
+		"at_":       "at__",
+		"index":     "index_",
+		"print":     "print_",
+		"pass":      "pass_",
+		"add":       "add_",
+		"each":      "each_",
+		"map_get":   "map_get_",
+		"copy_with": "copy_with_",
+		"try_":      "try__",
+		"Failure":   "Failure_",
+		"Offset":    "Offset",
+		"attempt":   "attempt",
+	}
+	for name, want := range cases {
+		if got := pyName(name); got != want {
+			t.Fatalf("expected %s for %s, got %s", want, name, got)
+		}
+	}
+
+	// helpers of the preamble used as local names must not shadow the helpers
+	// the generated code calls
+	generated := []struct {
+		Code string
+		Want string
+	}{{
+		Code: `$Get/str at/int slice/[str](
+  %index: at! slice at
+  >index
+)
+`,
+		Want: `def Get(at_: int,slice_: list,):
+  index_ = at(slice_,at_,)
+  return index_
+`,
+	}, {
+		Code: `$Sum/int each/[int](
+  %n: 0
+  *%x: each(
+    %n: add! n x
+  )
+  >n
+)
+`,
+		Want: `def Sum(each_: list,):
+  n = 0
+  for x in each(each_):
+    n = add(n,x,)
+  return n
+`,
+	}, {
+		Code: `$Count/int map_get/{str:int}(
+  %map_keys: keys! map_get
+  >len! map_keys
+)
+`,
+		Want: `def Count(map_get_: dict,):
+  map_keys_ = map_keys(map_get_,)
+  return len(map_keys_,)
+`,
+	}, {
+		Code: `@P(X/int)
+$Move/P copy_with/P(
+  >@P copy_with (X: 2)
+)
+`,
+		Want: `class P:
+  __slots__ = ("X", )
+  X: int
+  def __init__(self, X: int, ):
+    self.X = X
+def Move(copy_with_: "P",):
+  return copy_with(P, copy_with_, X=2)
+`,
+	}}
+	for _, c := range generated {
+		if got := generate(t, c.Code); got != c.Want {
+			t.Fatalf("expected:\n%s\ngot:\n%s", c.Want, got)
+		}
+	}
+}
+
+// TestShadowedResult ensures that structures shadowing the built-in Result
+// structure or the classes of the preamble do not replace the preamble's
+// classes
+func TestShadowedResult(t *testing.T) {
+	cases := []struct {
+		Code string
+		Want string
+	}{{
+		Code: `@Result(X/int)
+$Parse/int a/str(
+  %r: int! a
+  %m: @Result r#value
+  >m#X
+)
+`,
+		Want: `class Result_:
+  __slots__ = ("X", )
+  X: int
+  def __init__(self, X: int, ):
+    self.X = X
+def Parse(a: str,):
+  r = to_int(a,)
+  m = Result_(r.value, )
+  return m.X
+`,
+	}, {
+		Code: `@Failure(Why/str)
+$Parse/Result[int] a/str(
+  %f: @Failure "no"
+  >@Result * ^int! a
+)
+`,
+		Want: `class Failure_:
+  __slots__ = ("Why", )
+  Why: str
+  def __init__(self, Why: str, ):
+    self.Why = Why
+@propagates
+def Parse(a: str,):
+  f = Failure_("no", )
+  return Result(True, try_(to_int(a,)), )
+`,
+	}}
+	for _, c := range cases {
+		if got := generate(t, c.Code); got != c.Want {
+			t.Fatalf("expected:\n%s\ngot:\n%s", c.Want, got)
+		}
+	}
+}
+
+// TestForEachDocs runs the for-each example of docs/syntax.md, ensuring that it
+// prints what the documentation says it does
+func TestForEachDocs(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 is not installed")
+	}
+
+	cmd := exec.Command(python, "-")
+	cmd.Stdin = strings.NewReader(compile(t, `$Show Text/str(
+  *%i c: Text(
+    print! append! concat! str! i ": " c
+  )
+)
+
+$Main(
+  Show! "hi"
+)
+`))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	if want := "0: h\n1: i\n"; string(out) != want {
+		t.Fatalf("expected %q, got %q", want, out)
+	}
+}
@@ -1,47 +1,129 @@
 #region preamble
 
 import operator
+from collections.abc import Callable
 
-to_str = str
-to_bool = bool
+# Strings are sequences of characters (Unicode code points), not bytes. Chars
+# are represented as their code point, so `at`, `slice`, `len` and indexing all
+# count characters.
 
-add_i = add_f = add_c = concat = operator.add
-sub_i = sub_f = sub_c = operator.sub
-mul_i = mul_f = mul_c = operator.mul
-mod_i = mod_f = mod_c = operator.mod
-div_i = div_c = operator.floordiv
-div_f = operator.truediv
+class Result:
+  __slots__ = ("ok", "value")
+  def __init__(self, ok: bool, value):
+    self.ok = ok
+    self.value = value
+  def __repr__(self) -> str:
+    return f"Result({self.ok!r} {self.value!r})"
+
+# A propagated result raises Failure if it is not ok. Functions returning a
+# result are wrapped with propagates, which turns the Failure into the failed
+# result returned by the function.
+
+class Failure(Exception):
+  pass
+
+def try_(r: Result):
+  if not r.ok:
+    raise Failure()
+  return r.value
+
+def propagates(f: Callable) -> Callable:
+  def wrapper(*args):
+    try: return f(*args)
+    except Failure: return Result(False, None)
+  return wrapper
+
+add = operator.add
+sub = operator.sub
+mul = operator.mul
+pow = operator.pow
+mod = operator.mod
+
+def div(a, b):
+  if isinstance(a, float) or isinstance(b, float):
+    return a / b
+  return a // b
 
 eq = operator.eq
-or_ = operator.or_
-and_ = operator.and_
-
-gt_i = gt_f = gt_c = operator.gt
-lt_i = lt_f = lt_c = operator.lt
-
-def char_at(s: str, i: int) -> int:
-  while i > len(s):
-    i -= len(s)
-  while i < 0:
-    i += len(s)
-  return bytes(s, "utf8")[i]
-
-def substr(s: str, a: int, b: int) -> str:
-  while a > len(s):
-    a -= len(s)
-  while a < 0:
-    a += len(s)
-  while b > len(s):
-    b -= len(s)
-  while b < 0:
-    b += len(s)
-  return s[a:b]
-
-def char_append(s: str, c: int) -> str:
-  return s + bytes([c]).decode()
-
-str_len = len
-ctoi = int
+gt = operator.gt
+lt = operator.lt
+not_ = operator.not_
+and_ = lambda a, b: a and b
+or_ = lambda a, b: a or b
+
+def append(a, b):
+  if isinstance(a, str):
+    return a + chr(b)
+  return a + [b]
+
+concat = operator.add
+
+def slice(a, start: int, end: int):
+  if end < 0:
+    return a[start:]
+  return a[start:end]
+
+def at(a, i: int):
+  if isinstance(a, str):
+    return ord(a[i])
+  return a[i]
+
+def index(a, i: int) -> Result:
+  if i < 0 or i >= len(a):
+    return Result(False, None)
+  return Result(True, at(a, i))
+
+def each(a):
+  if isinstance(a, str):
+    return map(ord, a)
+  return a
+
+# copy_with creates an instance of cls with the fields of base, except for the
+# ones given as keyword arguments. base may be an instance of another class that
+# has all the fields of cls.
+
+def copy_with(cls, base, **changes):
+  return cls(*(changes[f] if f in changes else getattr(base, f) for f in cls.__slots__))
+
+# Maps are dicts, which are shared instead of copied like lists. map_set and
+# map_delete change the map in place.
+
+def map_get(m: dict, k) -> Result:
+  if k in m:
+    return Result(True, m[k])
+  return Result(False, None)
+
+def map_set(m: dict, k, v):
+  m[k] = v
+
+def map_delete(m: dict, k):
+  m.pop(k, None)
+
+def map_has(m: dict, k) -> bool:
+  return k in m
+
+def map_keys(m: dict) -> list:
+  return list(m)
+
+def parse_bool(s: str) -> Result:
+  if s in ("*", "true"):
+    return Result(True, True)
+  if s in ("/", "false"):
+    return Result(True, False)
+  return Result(False, False)
+
+def to_char(s: str) -> Result:
+  if len(s) != 1:
+    return Result(False, 0)
+  return Result(True, ord(s))
+
+def to_int(s: str) -> Result:
+  try: return Result(True, int(s, 0))
+  except ValueError: return Result(False, 0)
+
+def to_float(s: str) -> Result:
+  try: return Result(True, float(s))
+  except ValueError: return Result(False, 0.0)
 
 #endregion preamble
 
@@ -1,24 +1,48 @@
 package common
 
 import (
-	"crypto/md5"
-	"encoding/base64"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
+	"path/filepath"
+
+	"github.com/syzkrash/skol/ast"
 )
 
-func cacheSafeName(fn string) string {
-	hash := md5.Sum([]byte(fn))
-	return base64.URLEncoding.EncodeToString(hash[:])
+// CacheDirEnv is the name of the environment variable that can be used to
+// override the directory cached files are stored in.
+const CacheDirEnv = "SKOL_CACHE_DIR"
+
+// CacheExt is the file extension of cached AST files.
+const CacheExt = ".skol_ast"
+
+// CacheDir returns the directory cached files are stored in. This is the
+// directory specified by the [CacheDirEnv] environment variable, if it is set.
+// Otherwise, it is the `skol` directory within the user's cache directory.
+func CacheDir() string {
+	if dir := os.Getenv(CacheDirEnv); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "skol")
+	}
+	return filepath.Join(os.TempDir(), "skol")
 }
 
-const cacheDir = "_skolcache"
+// CachedASTName returns the path to a AST cache file for a given file. The
+// name of the cache file is a hash of the compiler [Version], the AST format
+// version, the file's name and the file's contents, so changing any of these
+// results in a different cache file being used. This also ensures the cache
+// directory exists.
+func CachedASTName(fn string, src []byte) string {
+	h := sha256.New()
+	h.Write([]byte(Version))
+	h.Write([]byte{0, ast.FormatVersion, 0})
+	h.Write([]byte(fn))
+	h.Write([]byte{0})
+	h.Write(src)
 
-// CachedASTName returns the path to a AST cache file for a given filename. This
-// also ensures the cache directory exists.
-func CachedASTName(fn string) string {
-	os.Mkdir(cacheDir, os.ModePerm)
-	return fmt.Sprintf(
-		"%s%c%s.skol_ast",
-		cacheDir, os.PathSeparator, cacheSafeName(fn))
+	dir := CacheDir()
+	os.MkdirAll(dir, os.ModePerm)
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+CacheExt)
 }
@@ -72,3 +72,42 @@ func TestPack(t *testing.T) {
 		}
 	}
 }
+
+// TestVarint ensures that variable-length values written by a [pack.Packer]
+// are read back correctly by a [pack.Unpacker]
+func TestVarint(t *testing.T) {
+	unsigned := []uint64{0, 1, 0x7F, 0x80, 0x3FFF, 0x4000, 1 << 32, 1<<64 - 1}
+	signed := []int64{0, 1, -1, 63, -64, 64, -65, 1<<63 - 1, -1 << 63}
+	long := string(bytes.Repeat([]byte("skol"), 1000))
+
+	buf := bytes.Buffer{}
+	p := pack.NewPacker(&buf)
+	for _, n := range unsigned {
+		p.UVarint(n)
+	}
+	for _, n := range signed {
+		p.Varint(n)
+	}
+	p.VStr(long)
+	if len(p.Err) > 0 {
+		t.Fatal(p.Err[0])
+	}
+
+	u := pack.NewUnpacker(&buf)
+	for _, n := range unsigned {
+		if got := u.UVarint(); got != n {
+			t.Fatalf("UVarint: %d != %d", got, n)
+		}
+	}
+	for _, n := range signed {
+		if got := u.Varint(); got != n {
+			t.Fatalf("Varint: %d != %d", got, n)
+		}
+	}
+	if got := u.VStr(); got != long {
+		t.Fatalf("VStr: got %d bytes, want %d bytes", len(got), len(long))
+	}
+	if len(u.Err) > 0 {
+		t.Fatal(u.Err[0])
+	}
+}
@@ -1,6 +1,7 @@
 package pack
 
 import (
+	"encoding/binary"
 	"io"
 	"math"
 )
@@ -104,7 +105,29 @@ func (p *Packer) F64(n float64) *Packer {
 	return p.U64(math.Float64bits(n))
 }
 
-// Str writes the string's length followed by the string's bytes
+// UVarint writes an unsigned variable-length int, using 1 to 10 bytes
+// depending on the magnitude of the value
+func (p *Packer) UVarint(n uint64) *Packer {
+	var buf [binary.MaxVarintLen64]byte
+	return p.Write(buf[:binary.PutUvarint(buf[:], n)])
+}
+
+// Varint writes a signed variable-length int, using 1 to 10 bytes depending
+// on the magnitude of the value
+func (p *Packer) Varint(n int64) *Packer {
+	var buf [binary.MaxVarintLen64]byte
+	return p.Write(buf[:binary.PutVarint(buf[:], n)])
+}
+
+// Str writes the string's length followed by the string's bytes. The length is
+// written as an 8-bit int, so only strings up to 255 bytes long can be
+// written. Use [VStr] for longer strings
 func (p *Packer) Str(s string) *Packer {
 	return p.U8(uint8(len(s))).Write([]byte(s))
 }
+
+// VStr writes the string's length as a variable-length int followed by the
+// string's bytes
+func (p *Packer) VStr(s string) *Packer {
+	return p.UVarint(uint64(len(s))).Write([]byte(s))
+}
@@ -1,10 +1,15 @@
 package pack
 
 import (
+	"errors"
 	"io"
 	"math"
 )
 
+// ErrVarintOverflow is reported when a variable-length int does not fit in 64
+// bits
+var ErrVarintOverflow = errors.New("varint overflows 64 bits")
+
 // Unpacker contains facilities for reading concrete values from byte streams
 // read from an [io.Reader]
 type Unpacker struct {
@@ -30,7 +35,7 @@ func (u *Unpacker) Error(e error) {
 }
 
 func (u *Unpacker) read(p []byte) {
-	if _, err := u.in.Read(p); err != nil {
+	if _, err := io.ReadFull(u.in, p); err != nil {
 		u.Error(err)
 	} else {
 		u.Offset += uint32(len(p))
@@ -113,6 +118,31 @@ func (u *Unpacker) Bytes(n uint) []byte {
 	return b
 }
 
+// UVarint reads an unsigned variable-length int
+func (u *Unpacker) UVarint() uint64 {
+	var n uint64
+	for shift := 0; shift < 64; shift += 7 {
+		errc := len(u.Err)
+		b := u.U8()
+		if len(u.Err) > errc {
+			return 0
+		}
+		n |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			return n
+		}
+	}
+	u.Error(ErrVarintOverflow)
+	return n
+}
+
+// Varint reads a signed variable-length int
+func (u *Unpacker) Varint() int64 {
+	n := u.UVarint()
+	// undo the zig-zag encoding used by the packer
+	return int64(n>>1) ^ -int64(n&1)
+}
+
 // Str reads a string's length and then reads that amount of bytes as a string
 func (u *Unpacker) Str() string {
 	length := u.U8()
@@ -120,3 +150,15 @@ func (u *Unpacker) Str() string {
 	u.read(buf)
 	return string(buf)
 }
+
+// VStr reads a string's length as a variable-length int and then reads that
+// amount of bytes as a string
+func (u *Unpacker) VStr() string {
+	length := u.UVarint()
+	if len(u.Err) > 0 {
+		return ""
+	}
+	buf := make([]byte, length)
+	u.read(buf)
+	return string(buf)
+}
@@ -15,6 +15,7 @@ const (
 	EUnknownEngine
 	EBadDebugFlag
 	EUnimplemented
+	EBadCache
 )
 
 const (
@@ -23,6 +24,8 @@ const (
 	EIllegalChar
 	EInvalidCharLit
 	EInvalidEscape
+	EInvalidNumber
+	EUnterminatedString
 )
 
 const (
@@ -60,6 +63,28 @@ const (
 	EBadTypePrim
 	EBadMagic
 	EBadEncoderVer
+	EBadChecksum
+
+	ETooManyErrors
+
+	ETypeArgCount
+	ECannotInferType
+	EGenericFuncRef
+	EUnknownVariant
+	EBadPattern
+	EOutsideLoop
+	EExpectedRBrace
+	EBadMapKey
+	EUnknownMethod
+	EBadReceiver
+	EMethodIsField
+	ENotConstant
+	EBadConstant
+	EDuplicateField
+	ENoZeroValue
+	ETupleTooShort
+	EBadNestedFunc
+	EShadowedFunc
 )
 
 const (
@@ -70,6 +95,16 @@ const (
 	ENeedMoreArgs
 	ETypeOfUnimplemented
 	EEmptySelector
+	ENotCallable
+	ENonExhaustive
+	EUnreachableArm
+	ENotIterable
+	ENotAssignable
+	EBadTry
+	ENotResult
+	ENotPrintable
+	ENotTuple
+	EDestructureCount
 )
 
 var emsgs = map[ErrorCode]string{
@@ -81,10 +116,14 @@ var emsgs = map[ErrorCode]string{
 	EUnknownEngine: "Unknown engine.",
 	EBadDebugFlag:  "Unknown debug flag.",
 	EUnimplemented: "Unimplemented.",
+	EBadCache:      "Could not access the cache.",
 
 	EIllegalChar:    "Illegal character.",
 	EInvalidCharLit: "Invalid character literal.",
 	EInvalidEscape:  "Invalid escape sequence.",
+	EInvalidNumber:  "Invalid number literal.",
+
+	EUnterminatedString: "String literal is never closed.",
 
 	EBadFloatLit:          "Invalid float literal.",
 	EBadIntLit:            "Invalid integer literal.",
@@ -113,12 +152,42 @@ var emsgs = map[ErrorCode]string{
 	EBadTypePrim:          "Unknown type primitive.",
 	EBadMagic:             "Magic string is missing or invalid.",
 	EBadEncoderVer:        "Incompatible file format version.",
+	EBadChecksum:          "Checksum mismatch.",
+	ETooManyErrors:        "Too many errors, giving up.",
+	ETypeArgCount:         "Wrong amount of type arguments.",
+	ECannotInferType:      "Cannot infer type arguments.",
+	EGenericFuncRef:       "Generic functions cannot be used as values.",
+	EUnknownVariant:       "Unknown union variant.",
+	EBadPattern:           "Only literals, names, structures and variants can be matched.",
+	EOutsideLoop:          "Break and continue can only be used inside of loops.",
+	EExpectedRBrace:       "Expected '}'.",
+	EBadMapKey:            "Map keys can only be booleans, characters, numbers or strings.",
+	EUnknownMethod:        "Unknown method.",
+	EBadReceiver:          "Methods must take their structure as the first argument.",
+	EMethodIsField:        "Methods cannot have the same name as a field.",
+	ENotConstant:          "Constants can only use literals, other constants and builtin functions.",
+	EBadConstant:          "Constant cannot be evaluated at compile time.",
+	EDuplicateField:       "Field is given more than once.",
+	ENoZeroValue:          "Field has no zero value and must be given.",
+	ETupleTooShort:        "Tuples need at least two elements.",
+	EBadNestedFunc:        "Nested functions cannot be methods, generic or externs.",
+	EShadowedFunc:         "Nested functions cannot have the name of another function.",
 
 	ETypeMismatch:        "Type mismatch.",
 	EVarTypeChanged:      "Variable type cannot change.",
 	ENeedMoreArgs:        "Need more arguments.",
 	ETypeOfUnimplemented: "TypeOf() unimplemented for this node.",
 	EEmptySelector:       "Selector of length 0",
+	ENotCallable:         "Only functions can be called.",
+	ENonExhaustive:       "Match does not cover every possible value.",
+	EUnreachableArm:      "Match arm can never be reached.",
+	ENotIterable:         "Only arrays and strings can be iterated.",
+	ENotAssignable:       "Only structure fields and array elements can be assigned.",
+	EBadTry:              "Failures can only be propagated in functions that return a result.",
+	ENotResult:           "Only results can be propagated.",
+	ENotPrintable:        "Only values that can be turned into a string can be embedded.",
+	ENotTuple:            "Only tuples can be destructured.",
+	EDestructureCount:    "Destructuring needs one variable for every element of the tuple.",
 }
 
 type section struct {
@@ -157,6 +226,16 @@ func (p *PrettyError) Section(title, mfmt string, margs ...any) *PrettyError {
 	return p
 }
 
+// Sections returns every section of this error as a "title: message" string,
+// in the order they were added.
+func (p *PrettyError) Sections() []string {
+	out := make([]string, len(p.sections))
+	for i, s := range p.sections {
+		out[i] = s.title + ": " + s.message
+	}
+	return out
+}
+
 func (p *PrettyError) Cause(e error) *PrettyError {
 	p.cause = e
 	return p.Section("Cause", e.Error())
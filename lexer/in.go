@@ -1,14 +1,28 @@
 package lexer
 
-import "io"
+import (
+	"io"
+	"unicode/utf8"
+)
 
 // Source wraps a RuneScanner and tracks it's position within the file, with
 // Position always pointing to the last read rune
 type Source struct {
 	Scanner  io.RuneScanner
 	Position Position
-	lastCol  uint
-	lastRune rune
+	// offset is the amount of bytes consumed so far
+	offset uint
+	// state before the last ReadRune call, restored by UnreadRune
+	lastPos    Position
+	lastOffset uint
+	// newline is set if the last read rune was a newline, meaning the next
+	// rune is on the next line
+	newline     bool
+	lastNewline bool
+	// bytes read since the last call to Mark, which was at the byte offset
+	// mark
+	raw  []byte
+	mark uint
 }
 
 // NewSource wraps any RuneScanner with the given filename for it's Position
@@ -28,25 +42,77 @@ func NewSource(s io.RuneScanner, fn string) *Source {
 // Position value accordingly
 func (s *Source) ReadRune() (c rune, l int, err error) {
 	c, l, err = s.Scanner.ReadRune()
-	if c == '\n' {
+	if err != nil {
+		return
+	}
+	s.lastPos = s.Position
+	s.lastOffset = s.offset
+	s.lastNewline = s.newline
+	if s.newline {
 		s.Position.Line++
-		s.lastCol = s.Position.Col
-		s.Position.Col = 0
+		s.Position.Col = 1
 	} else {
 		s.Position.Col++
 	}
-	s.lastRune = c
+	s.newline = c == '\n'
+	s.Position.Offset = s.offset
+	s.raw = s.appendRaw(s.raw[:s.offset-s.mark], c, l)
+	s.offset += uint(l)
 	return
 }
 
+// appendRaw appends the bytes the last read rune was decoded from. Bytes that
+// are not valid UTF-8 are read as [utf8.RuneError], so they are read again from
+// the underlying scanner if it is an [io.ByteScanner].
+func (s *Source) appendRaw(raw []byte, c rune, l int) []byte {
+	bs, ok := s.Scanner.(io.ByteScanner)
+	if c != utf8.RuneError || l != 1 || !ok || s.Scanner.UnreadRune() != nil {
+		return utf8.AppendRune(raw, c)
+	}
+	// the byte is read once more as a byte and then as a rune again, so that
+	// the rune can still be unread
+	b, err := bs.ReadByte()
+	if err == nil && bs.UnreadByte() == nil {
+		raw = append(raw, b)
+	} else {
+		raw = utf8.AppendRune(raw, c)
+	}
+	s.Scanner.ReadRune()
+	return raw
+}
+
 // UnreadRune unreads 1 rune from the underlying RuneScanner and properly
 // backs the Position value
 func (s *Source) UnreadRune() (err error) {
 	err = s.Scanner.UnreadRune()
-	if s.lastRune == '\n' {
-		s.Position.Line--
-		s.Position.Col = s.lastCol
-		s.lastRune = 0
+	if err != nil {
+		return
+	}
+	s.Position = s.lastPos
+	s.offset = s.lastOffset
+	s.newline = s.lastNewline
+	return
+}
+
+// Mark starts recording the text read from the source anew, see [Source.Text].
+func (s *Source) Mark() {
+	s.raw = s.raw[:0]
+	s.mark = s.offset
+}
+
+// Text returns the text read since the last call to [Source.Mark], byte for
+// byte as it is in the source. Bytes that are not valid UTF-8 are only kept if
+// the underlying scanner is an [io.ByteScanner].
+func (s *Source) Text() string {
+	return string(s.raw[:s.offset-s.mark])
+}
+
+// End returns the position directly after the last read rune.
+func (s *Source) End() Position {
+	return Position{
+		File:   s.Position.File,
+		Line:   s.Position.Line,
+		Col:    s.Position.Col + 1,
+		Offset: s.offset,
 	}
-	return err
 }
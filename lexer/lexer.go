@@ -3,6 +3,7 @@ package lexer
 import (
 	"errors"
 	"io"
+	"unicode/utf8"
 
 	"github.com/syzkrash/skol/common/pe"
 	"github.com/syzkrash/skol/debug"
@@ -10,8 +11,25 @@ import (
 
 // Lexer reads individual runes from a source stream and turns them into tokens.
 type Lexer struct {
+	// Err contains the errors the lexer has recovered from, such as illegal
+	// characters or invalid escape sequences. Instead of being returned by
+	// [Lexer.Next], these are collected here, so lexing can continue after them.
+	Err []error
+	// Trivia makes [Lexer.Next] return whitespace and comments as [TSpace] and
+	// [TComment] tokens instead of skipping them. Together with [Token.Text],
+	// this allows reconstructing the source exactly.
+	Trivia bool
+
 	src  *Source
 	prev *Token
+	// last is the last token returned by Next and beforeLast is the one
+	// returned before it, used to keep track of the end of consumed input
+	last       *Token
+	beforeLast *Token
+	// interp holds the brace depth within every embedded value of an
+	// interpolated string the lexer is in, so that the brace ending the value
+	// can be told apart from the braces of a map type
+	interp []int
 }
 
 // NewLexer creates and prepares a new lexer with the given source stream.
@@ -21,40 +39,55 @@ func NewLexer(src io.RuneScanner, fn string) *Lexer {
 	}
 }
 
-func (l *Lexer) nextIdent(c rune) (tok *Token, err error) {
-	pos := l.src.Position
-	ident := string(c)
+// span creates a span from the given start position to the end of the last
+// read rune.
+func (l *Lexer) span(start Position) Span {
+	return Span{
+		Start: start,
+		End:   l.src.End(),
+	}
+}
+
+// report records an error the lexer can recover from, see [Lexer.Err].
+func (l *Lexer) report(err error) {
+	debug.Log(debug.AttrLexer, "Error %s", err)
+	l.Err = append(l.Err, err)
+}
+
+// skipInvalid resynchronizes the lexer after an illegal character by consuming
+// everything up to the next whitespace, punctuator, quote or the end of input.
+// The skipped input is returned as a [TError] token.
+func (l *Lexer) skipInvalid(pos Position, raw string) (tok *Token, err error) {
+	var c rune
 	for {
 		c, _, err = l.src.ReadRune()
 		if errors.Is(err, io.EOF) {
 			err = nil
-			goto finish
+			break
 		}
 		if err != nil {
 			err = pe.New(pe.EBadInput).Cause(err)
 			return
 		}
-		if !isIdent(c) && !isDigit(c) {
+		if isSpace(c) || isPunct(c) || c == '"' || c == '\'' || c == '`' {
 			if err = l.src.UnreadRune(); err != nil {
 				return
 			}
 			break
 		}
-		ident += string(c)
+		raw += string(c)
 	}
-finish:
 	tok = &Token{
-		Kind:  TIdent,
-		Where: pos,
-		Raw:   ident,
+		Kind:  TError,
+		Where: l.span(pos),
+		Raw:   raw,
 	}
 	return
 }
 
-func (l *Lexer) nextConstant(c rune) (tok *Token, err error) {
+func (l *Lexer) nextIdent(c rune) (tok *Token, err error) {
 	pos := l.src.Position
-	num := string(c)
-	isfloat := false
+	ident := string(c)
 	for {
 		c, _, err = l.src.ReadRune()
 		if errors.Is(err, io.EOF) {
@@ -65,58 +98,185 @@ func (l *Lexer) nextConstant(c rune) (tok *Token, err error) {
 			err = pe.New(pe.EBadInput).Cause(err)
 			return
 		}
-		if !isNumberTail(c) {
+		if !isIdentTail(c) {
 			if err = l.src.UnreadRune(); err != nil {
 				return
 			}
 			break
 		}
-		if c == '.' {
-			isfloat = true
-		}
-		num += string(c)
+		ident += string(c)
 	}
 finish:
-	if isfloat {
-		tok = &Token{
-			Kind:  TFloat,
-			Where: pos,
-			Raw:   num,
+	tok = &Token{
+		Kind:  TIdent,
+		Where: l.span(pos),
+		Raw:   ident,
+	}
+	return
+}
+
+// escape reads the escape sequence following a backslash. Invalid escape
+// sequences are reported at the position of the backslash and returned as-is
+// in seq, so the literal containing them can still be read.
+func (l *Lexer) escape() (lit rune, seq string, ok bool, err error) {
+	bs := l.src.Position
+	seq = "\\"
+
+	var e rune
+	e, _, err = l.src.ReadRune()
+	if err != nil {
+		err = pe.New(pe.EBadInput).Cause(err)
+		return
+	}
+	seq += string(e)
+	lit = e
+
+	// hex reads up to max hex digits
+	hex := func(max int) (v rune, n int, err error) {
+		for ; n < max; n++ {
+			var c rune
+			if c, err = l.read(); err != nil {
+				return
+			}
+			d, ok := hexDigit(c)
+			if !ok {
+				// leave the rune in the source, it might close the literal
+				err = l.unread(c)
+				return
+			}
+			seq += string(c)
+			v = v*16 + d
 		}
-	} else {
-		tok = &Token{
-			Kind:  TInt,
-			Where: pos,
-			Raw:   num,
+		return
+	}
+
+	switch e {
+	case 'x':
+		var n int
+		if lit, n, err = hex(2); err != nil {
+			return
+		}
+		ok = n == 2
+	case 'u':
+		var c rune
+		if c, err = l.read(); err != nil {
+			return
+		}
+		if c != '{' {
+			err = l.unread(c)
+			break
+		}
+		seq += "{"
+		var n int
+		if lit, n, err = hex(6); err != nil {
+			return
+		}
+		if c, err = l.read(); err != nil {
+			return
+		}
+		if c != '}' {
+			err = l.unread(c)
+			break
+		}
+		seq += "}"
+		ok = n > 0 && utf8.ValidRune(lit)
+	default:
+		lit, ok = escapeSeq(e)
+	}
+	if err != nil {
+		return
+	}
+
+	if !ok {
+		l.report(pe.New(pe.EInvalidEscape).Section("Caused by", "'%s' at %s", seq, bs))
+		if lit == 0 {
+			lit = e
 		}
 	}
 	return
 }
 
-func (l *Lexer) nextString() (tok *Token, err error) {
+// unterminated reports a string that reaches the end of input, at the quote
+// that opened it.
+func (l *Lexer) unterminated(quote rune, pos Position) {
+	l.report(pe.New(pe.EUnterminatedString).Section("Caused by", "'%c' at %s", quote, pos))
+}
+
+// nextRawString reads a raw string, which may span multiple lines and has no
+// escape sequences. It ends at the first backtick.
+func (l *Lexer) nextRawString() (tok *Token, err error) {
 	var c rune
 	pos := l.src.Position
 	str := ""
 	for {
-		c, _, err = l.src.ReadRune()
-		if err != nil {
-			err = pe.New(pe.EBadInput).Cause(err)
+		if c, err = l.read(); err != nil {
+			return
+		}
+		if c == eof {
+			l.unterminated('`', pos)
+			break
+		}
+		if c == '`' {
+			break
+		}
+		str += string(c)
+	}
+	tok = &Token{
+		Kind:  TString,
+		Where: l.span(pos),
+		Raw:   str,
+	}
+	return
+}
+
+// nextString reads a string, or the segment of an interpolated string starting
+// at the given quote or closing brace. A `\{` starts an embedded value, ending
+// the segment.
+func (l *Lexer) nextString(start rune) (tok *Token, err error) {
+	var c rune
+	pos := l.src.Position
+	str := ""
+	embed := false
+	for {
+		if c, err = l.read(); err != nil {
 			return
 		}
+		if c == eof {
+			l.unterminated(start, pos)
+			break
+		}
 		if c == '\\' {
-			var e rune
-			e, _, err = l.src.ReadRune()
+			if c, err = l.read(); err != nil {
+				return
+			}
+			if c == eof {
+				l.unterminated(start, pos)
+				str += "\\"
+				break
+			}
+			if c == '{' {
+				l.interp = append(l.interp, 0)
+				embed = true
+				break
+			}
+			if err = l.unread(c); err != nil {
+				return
+			}
+			var (
+				lit rune
+				seq string
+				ok  bool
+			)
+			lit, seq, ok, err = l.escape()
 			if err != nil {
-				err = pe.New(pe.EBadInput).Cause(err)
 				return
 			}
-			var ok bool
-			e, ok = escapeSeq(e)
 			if !ok {
-				err = pe.New(pe.EInvalidEscape).Section("Caused by", "'\\%c' at %s", e, l.src.Position)
-				return
+				// keep the escape sequence as-is and carry on with the string
+				str += seq
+				continue
 			}
-			str += string(e)
+			str += string(lit)
 			continue
 		}
 		if c == '"' {
@@ -124,9 +284,18 @@ func (l *Lexer) nextString() (tok *Token, err error) {
 		}
 		str += string(c)
 	}
+	kind := TString
+	switch {
+	case start == '"' && embed:
+		kind = TStringHead
+	case embed:
+		kind = TStringMid
+	case start == '}':
+		kind = TStringTail
+	}
 	tok = &Token{
-		Kind:  TString,
-		Where: pos,
+		Kind:  kind,
+		Where: l.span(pos),
 		Raw:   str,
 	}
 	return
@@ -142,16 +311,8 @@ func (l *Lexer) nextChar() (tok *Token, err error) {
 		return
 	}
 	if c == '\\' {
-		var e rune
-		e, _, err = l.src.ReadRune()
+		lit, _, _, err = l.escape()
 		if err != nil {
-			err = pe.New(pe.EBadInput).Cause(err)
-			return
-		}
-		var ok bool
-		lit, ok = escapeSeq(e)
-		if !ok {
-			err = pe.New(pe.EInvalidEscape).Section("Caused by", "'\\%c' at %s", e, l.src.Position)
 			return
 		}
 	} else {
@@ -163,39 +324,63 @@ func (l *Lexer) nextChar() (tok *Token, err error) {
 		return
 	}
 	if c != '\'' {
-		err = pe.New(pe.EInvalidCharLit).Section("Caused by", "'%c' at %s", c, l.src.Position)
+		l.report(pe.New(pe.EInvalidCharLit).Section("Caused by", "'%c' at %s", c, l.src.Position))
+		// skip the rest of the literal, up to the closing quote or whitespace
+		for !isSpace(c) && c != '\'' {
+			c, _, err = l.src.ReadRune()
+			if errors.Is(err, io.EOF) {
+				err = nil
+				break
+			}
+			if err != nil {
+				err = pe.New(pe.EBadInput).Cause(err)
+				return
+			}
+		}
+		if isSpace(c) {
+			if err = l.src.UnreadRune(); err != nil {
+				return
+			}
+		}
 	}
 	tok = &Token{
 		Kind:  TChar,
-		Where: pos,
+		Where: l.span(pos),
 		Raw:   string(lit),
 	}
 	return
 }
 
 func (l *Lexer) nextPunctuator(c rune) (tok *Token, ok bool) {
-	switch c {
-	case '(', ')', '[', ']', '$', '%', ':', '/', '>', '?', '*', '#', '@', '!':
-		tok = &Token{
-			Kind:  TPunct,
-			Where: l.src.Position,
-			Raw:   string(c),
-		}
-		ok = true
+	if !isPunct(c) {
+		return
 	}
-	return
+	tok = &Token{
+		Kind:  TPunct,
+		Where: l.span(l.src.Position),
+		Raw:   string(c),
+	}
+	return tok, true
 }
 
+// ignoreLineComment consumes the rest of a line comment, leaving the newline
+// ending it in the source.
 func (l *Lexer) ignoreLineComment() (err error) {
 	var c rune
-	for c != '\n' {
+	for {
 		c, _, err = l.src.ReadRune()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			return
+		}
 		if err != nil {
 			err = pe.New(pe.EBadInput).Cause(err)
 			return
 		}
+		if c == '\n' {
+			return l.src.UnreadRune()
+		}
 	}
-	return
 }
 
 func (l *Lexer) ignoreBlockComment() (err error) {
@@ -249,25 +434,54 @@ func (l *Lexer) commentOrSlash() (comment bool, err error) {
 	return
 }
 
-func (l *Lexer) internalNext() (tok *Token, err error) {
-	c, _, err := l.src.ReadRune()
-	if err != nil {
-		err = pe.New(pe.EBadInput).Cause(err)
-		return
+// nextSpace reads a run of whitespace.
+func (l *Lexer) nextSpace() (tok *Token, err error) {
+	pos := l.src.Position
+	var c rune
+	for {
+		c, _, err = l.src.ReadRune()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			break
+		}
+		if err != nil {
+			err = pe.New(pe.EBadInput).Cause(err)
+			return
+		}
+		if !isSpace(c) {
+			if err = l.src.UnreadRune(); err != nil {
+				return
+			}
+			break
+		}
 	}
+	tok = &Token{
+		Kind:  TSpace,
+		Where: l.span(pos),
+		Raw:   l.src.Text(),
+	}
+	return
+}
+
+func (l *Lexer) internalNext() (tok *Token, err error) {
+	var c rune
 
 	for {
+		l.src.Mark()
+		c, _, err = l.src.ReadRune()
+		if err != nil {
+			err = pe.New(pe.EBadInput).Cause(err)
+			return
+		}
 		if isSpace(c) {
-			for isSpace(c) {
-				c, _, err = l.src.ReadRune()
-				if err != nil {
-					err = pe.New(pe.EBadInput).Cause(err)
-					return
-				}
+			tok, err = l.nextSpace()
+			if err != nil || l.Trivia {
+				return
 			}
 			continue
 		}
 		if c == '/' {
+			pos := l.src.Position
 			var cmt bool
 			cmt, err = l.commentOrSlash()
 			if err != nil {
@@ -276,14 +490,17 @@ func (l *Lexer) internalNext() (tok *Token, err error) {
 			if !cmt {
 				tok = &Token{
 					Kind:  TPunct,
-					Where: l.src.Position,
+					Where: l.span(pos),
 					Raw:   "/",
 				}
 				return
 			}
-			c, _, err = l.src.ReadRune()
-			if err != nil {
-				err = pe.New(pe.EBadInput).Cause(err)
+			if l.Trivia {
+				tok = &Token{
+					Kind:  TComment,
+					Where: l.span(pos),
+					Raw:   l.src.Text(),
+				}
 				return
 			}
 			continue
@@ -297,14 +514,30 @@ func (l *Lexer) internalNext() (tok *Token, err error) {
 	case isNumberHead(c):
 		tok, err = l.nextConstant(c)
 	case c == '"':
-		tok, err = l.nextString()
+		tok, err = l.nextString(c)
+	case c == '}' && len(l.interp) > 0 && l.interp[len(l.interp)-1] == 0:
+		// the embedded value has ended, so the string continues
+		l.interp = l.interp[:len(l.interp)-1]
+		tok, err = l.nextString(c)
+	case c == '`':
+		tok, err = l.nextRawString()
 	case c == '\'':
 		tok, err = l.nextChar()
 	default:
 		var ok bool
 		tok, ok = l.nextPunctuator(c)
+		if ok && len(l.interp) > 0 {
+			switch c {
+			case '{':
+				l.interp[len(l.interp)-1]++
+			case '}':
+				l.interp[len(l.interp)-1]--
+			}
+		}
 		if !ok {
-			err = pe.New(pe.EIllegalChar).Section("Caused by", "'%c' at %s", c, l.src.Position)
+			pos := l.src.Position
+			l.report(pe.New(pe.EIllegalChar).Section("Caused by", "'%c' at %s", c, pos))
+			tok, err = l.skipInvalid(pos, string(c))
 		}
 	}
 
@@ -312,24 +545,57 @@ func (l *Lexer) internalNext() (tok *Token, err error) {
 }
 
 // Next will read and return the next token found in the stream or any error
-// that may have occurred in the process as a [*LexerError].
+// that may have occurred in the process. Invalid input does not cause an error
+// to be returned, instead the error is added to [Lexer.Err] and lexing
+// continues. Illegal characters are returned as a single [TError] token.
 func (l *Lexer) Next() (tok *Token, err error) {
 	if l.prev != nil {
 		tok = l.prev
 		l.prev = nil
-		return
-	}
-	tok, err = l.internalNext()
-	if err != nil {
-		debug.Log(debug.AttrLexer, "Error %s", err)
 	} else {
+		tok, err = l.internalNext()
+		if err != nil {
+			debug.Log(debug.AttrLexer, "Error %s", err)
+			return
+		}
+		tok.Text = l.src.Text()
 		debug.Log(debug.AttrLexer, "%s token `%s` at %s", tok.Kind, tok.Raw, tok.Where)
 	}
+	l.beforeLast = l.last
+	l.last = tok
 	return
 }
 
+// All reads all the remaining tokens up to the end of input. If [Lexer.Trivia]
+// is set, joining the text of all tokens returns the original source.
+func (l *Lexer) All() (toks []*Token, err error) {
+	for {
+		var tok *Token
+		tok, err = l.Next()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+		toks = append(toks, tok)
+	}
+}
+
 // Rollback will save the given token as the token to return on the next call
 // to [Next]
 func (l *Lexer) Rollback(tok *Token) {
 	l.prev = tok
+	l.last = l.beforeLast
+}
+
+// End returns the position directly after the last token returned by [Next],
+// taking any [Rollback] into account. This is used to determine where a
+// construct spanning multiple tokens ends.
+func (l *Lexer) End() Position {
+	if l.last == nil {
+		return l.src.End()
+	}
+	return l.last.Where.End
 }
@@ -1,8 +1,14 @@
 package lexer
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
+
+	"github.com/syzkrash/skol/common/pe"
 )
 
 func TestIdent(t *testing.T) {
@@ -21,6 +27,22 @@ func TestIdent(t *testing.T) {
 	}
 }
 
+func TestIdentUnicode(t *testing.T) {
+	code := `  zażółć_名前2  `
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestIdentUnicode")
+	tok, err := lex.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Kind != TIdent {
+		t.Fatalf("Incorrect TokenKind! Want Ident but got %s!", tok.Kind)
+	}
+	if tok.Raw != "zażółć_名前2" {
+		t.Fatalf("Incorrect string! Want `zażółć_名前2` but got `%s`!", tok.Raw)
+	}
+}
+
 func TestConstant(t *testing.T) {
 	code := `-123.456  `
 	read := strings.NewReader(code)
@@ -53,6 +75,41 @@ func TestString(t *testing.T) {
 	}
 }
 
+func TestInterp(t *testing.T) {
+	code := `"a\t\{x} b \{{str:int}() "c"} d"`
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestInterp")
+	expect := []struct {
+		Kind TokenKind
+		Raw  string
+	}{
+		{TStringHead, "a\t"},
+		{TIdent, "x"},
+		{TStringMid, " b "},
+		{TPunct, "{"},
+		{TIdent, "str"},
+		{TPunct, ":"},
+		{TIdent, "int"},
+		{TPunct, "}"},
+		{TPunct, "("},
+		{TPunct, ")"},
+		{TString, "c"},
+		{TStringTail, " d"},
+	}
+	for i, e := range expect {
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Kind != e.Kind || tok.Raw != e.Raw {
+			t.Fatalf("Incorrect token #%d! Want %s `%s` but got %s `%s`!", i, e.Kind, e.Raw, tok.Kind, tok.Raw)
+		}
+	}
+	if len(lex.Err) != 0 {
+		t.Fatalf("Unexpected errors: %v", lex.Err)
+	}
+}
+
 func TestChar(t *testing.T) {
 	code := `'\''`
 	read := strings.NewReader(code)
@@ -85,3 +142,459 @@ func TestPunct(t *testing.T) {
 		t.Fatalf("Incorrect string! Want `(` but got `%s`!", tok.Raw)
 	}
 }
+
+func TestBraces(t *testing.T) {
+	code := `{str:int}`
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestBraces")
+	expect := []Punct{PLBrace, PInvalid, PIs, PInvalid, PRBrace}
+	for i, e := range expect {
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pn, _ := tok.Punct()
+		if pn != e {
+			t.Fatalf("Incorrect punctuator #%d! Want %s but got %s!", i, e, pn)
+		}
+	}
+}
+
+func TestTry(t *testing.T) {
+	code := `^int! S`
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestTry")
+	expect := []Punct{PTry, PInvalid, PExecute, PInvalid}
+	for i, e := range expect {
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pn, _ := tok.Punct()
+		if pn != e {
+			t.Fatalf("Incorrect punctuator #%d! Want %s but got %s!", i, e, pn)
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+	code := "(\n  hello \"wörld\"\n)"
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestSpan")
+
+	expect := []Span{
+		{Start: Position{Line: 1, Col: 1, Offset: 0}, End: Position{Line: 1, Col: 2, Offset: 1}},
+		{Start: Position{Line: 2, Col: 3, Offset: 4}, End: Position{Line: 2, Col: 8, Offset: 9}},
+		{Start: Position{Line: 2, Col: 9, Offset: 10}, End: Position{Line: 2, Col: 16, Offset: 18}},
+		{Start: Position{Line: 3, Col: 1, Offset: 19}, End: Position{Line: 3, Col: 2, Offset: 20}},
+	}
+
+	for i, e := range expect {
+		e.Start.File = "TestSpan"
+		e.End.File = "TestSpan"
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Where != e {
+			t.Fatalf("Incorrect span for token %d! Want %+v but got %+v!", i, e, tok.Where)
+		}
+		if lex.End() != e.End {
+			t.Fatalf("Incorrect lexer end after token %d! Want %+v but got %+v!", i, e.End, lex.End())
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	code := "%a: 1 ~\n$f€x (print! \"b\\qd\")\n%c: 'zz' 'y'"
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestRecovery")
+
+	expect := []struct {
+		Kind TokenKind
+		Raw  string
+	}{
+		{TPunct, "%"}, {TIdent, "a"}, {TPunct, ":"}, {TInt, "1"},
+		{TError, "~"},
+		{TPunct, "$"}, {TIdent, "f"}, {TError, "€x"},
+		{TPunct, "("}, {TIdent, "print"}, {TPunct, "!"}, {TString, "b\\qd"},
+		{TPunct, ")"},
+		{TPunct, "%"}, {TIdent, "c"}, {TPunct, ":"}, {TChar, "z"}, {TChar, "y"},
+	}
+
+	for i, e := range expect {
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Kind != e.Kind || tok.Raw != e.Raw {
+			t.Fatalf("Incorrect token %d! Want %s `%s` but got %s `%s`!", i, e.Kind, e.Raw, tok.Kind, tok.Raw)
+		}
+	}
+	if _, err := lex.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("Expected end of input but got %v!", err)
+	}
+
+	codes := []pe.ErrorCode{pe.EIllegalChar, pe.EIllegalChar, pe.EInvalidEscape, pe.EInvalidCharLit}
+	if len(lex.Err) != len(codes) {
+		t.Fatalf("Incorrect error count! Want %d but got %d!", len(codes), len(lex.Err))
+	}
+	for i, c := range codes {
+		if got := lex.Err[i].(*pe.PrettyError).Code; got != c {
+			t.Fatalf("Incorrect error %d! Want %d but got %d!", i, c, got)
+		}
+	}
+}
+
+// TestRecoveryPunct ensures recovering from an illegal character stops at every
+// punctuator, so that the punctuator itself is not lost.
+func TestRecoveryPunct(t *testing.T) {
+	cases := []struct {
+		Code  string
+		Punct Punct
+	}{
+		{"~^x", PTry},
+		{"~{str:int}", PLBrace},
+		{"~}", PRBrace},
+	}
+
+	for _, c := range cases {
+		lex := NewLexer(strings.NewReader(c.Code), "TestRecoveryPunct")
+		bad, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bad.Kind != TError || bad.Raw != "~" {
+			t.Fatalf("Incorrect token for `%s`! Want Error `~` but got %s `%s`!", c.Code, bad.Kind, bad.Raw)
+		}
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pn, _ := tok.Punct(); pn != c.Punct {
+			t.Fatalf("Incorrect punctuator for `%s`! Want %s but got %s `%s`!", c.Code, c.Punct, tok.Kind, tok.Raw)
+		}
+	}
+}
+
+func TestRecoverySpan(t *testing.T) {
+	code := "a ~~~ b"
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestRecoverySpan")
+
+	expect := []Span{
+		{Start: Position{Line: 1, Col: 1, Offset: 0}, End: Position{Line: 1, Col: 2, Offset: 1}},
+		{Start: Position{Line: 1, Col: 3, Offset: 2}, End: Position{Line: 1, Col: 6, Offset: 5}},
+		{Start: Position{Line: 1, Col: 7, Offset: 6}, End: Position{Line: 1, Col: 8, Offset: 7}},
+	}
+
+	for i, e := range expect {
+		e.Start.File = "TestRecoverySpan"
+		e.End.File = "TestRecoverySpan"
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Where != e {
+			t.Fatalf("Incorrect span for token %d! Want %+v but got %+v!", i, e, tok.Where)
+		}
+	}
+	if len(lex.Err) != 1 {
+		t.Fatalf("Incorrect error count! Want 1 but got %d!", len(lex.Err))
+	}
+}
+
+func TestThreeTypos(t *testing.T) {
+	code := "$main (\n  %x: 1 & 2\n  print! \"a\\yb\"\n  %y: 3 |\n)"
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestThreeTypos")
+
+	for {
+		_, err := lex.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(lex.Err) != 3 {
+		t.Fatalf("Incorrect error count! Want 3 but got %d!", len(lex.Err))
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	code := "// comment\n$main ( /* block\n comment */\n\tprint! \"a\\tb\" ~x\n  %c: '\\n' 'ł' 12.5)\n"
+	read := strings.NewReader(code)
+	lex := NewLexer(read, "TestTrivia")
+	lex.Trivia = true
+
+	toks, err := lex.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := ""
+	for _, tok := range toks {
+		text += tok.Text
+	}
+	if text != code {
+		t.Fatalf("Incorrect text! Want `%s` but got `%s`!", code, text)
+	}
+
+	expect := []TokenKind{TComment, TSpace, TPunct, TIdent, TSpace, TPunct, TSpace, TComment, TSpace}
+	for i, k := range expect {
+		if toks[i].Kind != k {
+			t.Fatalf("Incorrect TokenKind for token %d! Want %s but got %s!", i, k, toks[i].Kind)
+		}
+	}
+	// the newline after the line comment still belongs to the first line
+	want := Span{
+		Start: Position{File: "TestTrivia", Line: 1, Col: 11, Offset: 10},
+		End:   Position{File: "TestTrivia", Line: 1, Col: 12, Offset: 11},
+	}
+	if toks[1].Where != want {
+		t.Fatalf("Incorrect span for newline! Want %+v but got %+v!", want, toks[1].Where)
+	}
+}
+
+// TestTriviaInvalidUTF8 ensures that the text of tokens keeps bytes which are
+// not valid UTF-8
+func TestTriviaInvalidUTF8(t *testing.T) {
+	code := "$main (\n\t// \xff\xfe\n\tprint! \"\xc3(\" ~\x80x \xe2\x82)\n"
+	for _, read := range []io.RuneScanner{strings.NewReader(code), bufio.NewReader(strings.NewReader(code))} {
+		lex := NewLexer(read, "TestTriviaInvalidUTF8")
+		lex.Trivia = true
+
+		toks, err := lex.All()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		text := ""
+		for _, tok := range toks {
+			text += tok.Text
+		}
+		if text != code {
+			t.Fatalf("Incorrect text from %T! Want %q but got %q!", read, code, text)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	cases := []struct {
+		Code string
+		Kind TokenKind
+		Raw  string
+	}{
+		{"123", TInt, "123"},
+		{"-1_000", TInt, "-1000"},
+		{"0x1F_ff", TInt, "0x1Fff"},
+		{"0b1010", TInt, "0b1010"},
+		{"0o17", TInt, "0o17"},
+		{"017", TInt, "017"},
+		{"0", TInt, "0"},
+		{"0_7", TInt, "07"},
+		{"0_000", TInt, "0000"},
+		{"-0_5", TInt, "-05"},
+		{"1.5", TFloat, "1.5"},
+		{"1e5", TFloat, "1e5"},
+		{"-1.5e-3", TFloat, "-1.5e-3"},
+		{"2E+10", TFloat, "2e+10"},
+		{"3f", TFloat, "3"},
+		{"0b11f", TFloat, "3"},
+		{"2.5f", TFloat, "2.5"},
+		{"7i", TInt, "7"},
+		{"65c", TChar, "A"},
+		{"0x41", TInt, "0x41"},
+		{"322c", TChar, "ł"},
+	}
+
+	for _, c := range cases {
+		lex := NewLexer(strings.NewReader(c.Code+" "), "TestNumber")
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lex.Err) > 0 {
+			t.Fatalf("Unexpected error for `%s`: %s", c.Code, lex.Err[0])
+		}
+		if tok.Kind != c.Kind || tok.Raw != c.Raw {
+			t.Fatalf("Incorrect token for `%s`! Want %s `%s` but got %s `%s`!", c.Code, c.Kind, c.Raw, tok.Kind, tok.Raw)
+		}
+	}
+}
+
+func TestBadNumber(t *testing.T) {
+	cases := []struct {
+		Code string
+		Col  uint
+	}{
+		{"1__2", 3},
+		{"12_", 3},
+		{"0__7", 3},
+		{"0_", 2},
+		{"0x", 3},
+		{"0b102", 5},
+		{"1.x", 3},
+		{"1.2.3", 4},
+		{"1e", 3},
+		{"1ez", 3},
+		{"12q", 3},
+		{"089", 2},
+		{"1.5c", 4},
+		{"-x", 2},
+		{"99999999999999999999", 1},
+		{"1114112c", 1},
+	}
+
+	for _, c := range cases {
+		lex := NewLexer(strings.NewReader(c.Code+" 1"), "TestBadNumber")
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lex.Err) != 1 {
+			t.Fatalf("Incorrect error count for `%s`! Want 1 but got %d!", c.Code, len(lex.Err))
+		}
+		want := fmt.Sprintf("TestBadNumber:1:%d", c.Col)
+		if !strings.Contains(fmt.Sprint(lex.Err[0].(*pe.PrettyError).Sections()), want) {
+			t.Fatalf("Incorrect error position for `%s`! Want %s in %v!", c.Code, want, lex.Err[0].(*pe.PrettyError).Sections())
+		}
+		if tok.Where.End.Col != uint(len(c.Code))+1 {
+			t.Fatalf("Lexer did not skip all of `%s`, stopped at %d!", c.Code, tok.Where.End.Col)
+		}
+		// the lexer should be able to continue after the error
+		tok, err = lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Kind != TInt || tok.Raw != "1" {
+			t.Fatalf("Incorrect token after `%s`! Got %s `%s`!", c.Code, tok.Kind, tok.Raw)
+		}
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	cases := []struct {
+		Code string
+		Raw  string
+	}{
+		{`"\0"`, "\x00"},
+		{`"\x41\x7e"`, "A~"},
+		{`"\xe9"`, "é"},
+		{`"\u{142}"`, "ł"},
+		{`"\u{1F642}!"`, "🙂!"},
+		{`"a\"b\\c\n"`, "a\"b\\c\n"},
+		{"`raw \\n \"string\"\n  on lines`", "raw \\n \"string\"\n  on lines"},
+		{"'\\u{65E5}'", "日"},
+		{"'\\0'", "\x00"},
+	}
+
+	for _, c := range cases {
+		lex := NewLexer(strings.NewReader(c.Code), "TestEscapes")
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lex.Err) > 0 {
+			t.Fatalf("Unexpected error for `%s`: %v", c.Code, lex.Err[0].(*pe.PrettyError).Sections())
+		}
+		if tok.Raw != c.Raw {
+			t.Fatalf("Incorrect string for `%s`! Want %q but got %q!", c.Code, c.Raw, tok.Raw)
+		}
+		if tok.Text != c.Code {
+			t.Fatalf("Incorrect text! Want `%s` but got `%s`!", c.Code, tok.Text)
+		}
+	}
+}
+
+func TestBadEscape(t *testing.T) {
+	cases := []struct {
+		Code string
+		Raw  string
+		Col  uint
+	}{
+		{`"ab\q"`, `ab\q`, 4},
+		{`"\x4"`, `\x4`, 2},
+		{`"\xZZ"`, `\xZZ`, 2},
+		{`"a\u142"`, `a\u142`, 3},
+		{`"\u{}"`, `\u{}`, 2},
+		{`"\u{110000}"`, `\u{110000}`, 2},
+		{`"\u{1234567}"`, `\u{1234567}`, 2},
+	}
+
+	for _, c := range cases {
+		lex := NewLexer(strings.NewReader(c.Code+" 1"), "TestBadEscape")
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lex.Err) != 1 {
+			t.Fatalf("Incorrect error count for `%s`! Want 1 but got %d!", c.Code, len(lex.Err))
+		}
+		want := fmt.Sprintf("TestBadEscape:1:%d", c.Col)
+		if !strings.Contains(fmt.Sprint(lex.Err[0].(*pe.PrettyError).Sections()), want) {
+			t.Fatalf("Incorrect error position for `%s`! Want %s in %v!", c.Code, want, lex.Err[0].(*pe.PrettyError).Sections())
+		}
+		if tok.Kind != TString || tok.Raw != c.Raw {
+			t.Fatalf("Incorrect token for `%s`! Want String `%s` but got %s `%s`!", c.Code, c.Raw, tok.Kind, tok.Raw)
+		}
+		tok, err = lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Kind != TInt {
+			t.Fatalf("Incorrect token after `%s`! Got %s `%s`!", c.Code, tok.Kind, tok.Raw)
+		}
+	}
+}
+
+// TestUnterminatedString ensures strings reaching the end of input are reported
+// at the quote that opened them, and the string read so far is still returned.
+func TestUnterminatedString(t *testing.T) {
+	cases := []struct {
+		Code string
+		Raw  string
+		At   string
+	}{
+		{"`abc", "abc", "1:1"},
+		{"%s: `ab\ncd", "ab\ncd", "1:5"},
+		{`"abc`, "abc", "1:1"},
+		{`%s: "ab\`, `ab\`, "1:5"},
+		{"\"a\nb", "a\nb", "1:1"},
+	}
+
+	for _, c := range cases {
+		lex := NewLexer(strings.NewReader(c.Code), "TestUnterminatedString")
+		var (
+			tok *Token
+			err error
+		)
+		for {
+			var next *Token
+			next, err = lex.Next()
+			if err != nil {
+				break
+			}
+			tok = next
+		}
+		if !errors.Is(err, io.EOF) {
+			t.Fatalf("Expected end of input for `%s` but got %v!", c.Code, err)
+		}
+		if tok == nil || tok.Kind != TString || tok.Raw != c.Raw {
+			t.Fatalf("Incorrect last token for `%s`! Want String `%s` but got %v!", c.Code, c.Raw, tok)
+		}
+		if len(lex.Err) != 1 {
+			t.Fatalf("Incorrect error count for `%s`! Want 1 but got %d!", c.Code, len(lex.Err))
+		}
+		perr := lex.Err[0].(*pe.PrettyError)
+		if perr.Code != pe.EUnterminatedString {
+			t.Fatalf("Incorrect error for `%s`! Want %d but got %d!", c.Code, pe.EUnterminatedString, perr.Code)
+		}
+		want := "TestUnterminatedString:" + c.At
+		if !strings.Contains(fmt.Sprint(perr.Sections()), want) {
+			t.Fatalf("Incorrect error position for `%s`! Want %s in %v!", c.Code, want, perr.Sections())
+		}
+	}
+}
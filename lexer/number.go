@@ -0,0 +1,267 @@
+package lexer
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/syzkrash/skol/common/pe"
+)
+
+// eof is returned by read at the end of input
+const eof rune = -1
+
+// read reads the next rune from the source, returning eof at the end of input
+func (l *Lexer) read() (c rune, err error) {
+	c, _, err = l.src.ReadRune()
+	if errors.Is(err, io.EOF) {
+		return eof, nil
+	}
+	if err != nil {
+		err = pe.New(pe.EBadInput).Cause(err)
+	}
+	return
+}
+
+// unread unreads the given rune, unless it is eof
+func (l *Lexer) unread(c rune) error {
+	if c == eof {
+		return nil
+	}
+	return l.src.UnreadRune()
+}
+
+// number holds the state of a numeric literal being read by nextConstant
+type number struct {
+	l    *Lexer
+	c    rune
+	base int
+	raw  strings.Builder
+	bad  bool
+}
+
+// next moves on to the next rune of the literal
+func (n *number) next() (err error) {
+	n.c, err = n.l.read()
+	return
+}
+
+// fail reports an error at the current rune of the literal
+func (n *number) fail(why string) {
+	n.failAt(n.c, n.l.src.Position, why)
+}
+
+// failAt reports an error at the given rune of the literal
+func (n *number) failAt(c rune, at Position, why string) {
+	n.bad = true
+	e := pe.New(pe.EInvalidNumber)
+	if c == eof {
+		e.Section("Caused by", "end of input at %s", n.l.src.End())
+	} else {
+		e.Section("Caused by", "'%c' at %s", c, at)
+	}
+	n.l.report(e.Section("Reason", why))
+}
+
+// digits reads a run of digits in the current base, which may be separated by
+// underscores. At least one digit is required, including the given amount of
+// digits of the run that have already been read.
+func (n *number) digits(count int) (err error) {
+	var (
+		under  bool
+		underC Position
+	)
+	for {
+		if n.c == '_' {
+			if count == 0 || under {
+				n.fail("Underscores are only allowed between digits")
+			}
+			under = true
+			underC = n.l.src.Position
+		} else if isDigitOf(n.c, n.base) {
+			n.raw.WriteRune(n.c)
+			count++
+			under = false
+		} else {
+			break
+		}
+		if err = n.next(); err != nil {
+			return
+		}
+	}
+	if count == 0 {
+		n.fail("Expected a digit")
+	} else if under {
+		n.failAt('_', underC, "Underscores are only allowed between digits")
+	}
+	return
+}
+
+// nextConstant reads a numeric literal. Integers may use the 0x, 0b or 0o
+// prefix, decimal numbers may have a fraction and an exponent, and any number
+// other than a hexadecimal one may end with a suffix specifying it's type: c
+// for a character, i for an integer or f for a float. Underscores may be used
+// to separate digits.
+func (l *Lexer) nextConstant(c rune) (tok *Token, err error) {
+	pos := l.src.Position
+	n := &number{l: l, c: c, base: 10}
+	kind := TInt
+
+	if n.c == '-' {
+		n.raw.WriteRune('-')
+		if err = n.next(); err != nil {
+			return
+		}
+	}
+
+	if n.c == '0' {
+		if err = n.next(); err != nil {
+			return
+		}
+		switch n.c {
+		case 'x', 'X':
+			n.base = 16
+		case 'b', 'B':
+			n.base = 2
+		case 'o', 'O':
+			n.base = 8
+		}
+		if n.base != 10 {
+			n.raw.WriteString("0" + strings.ToLower(string(n.c)))
+			if err = n.next(); err != nil {
+				return
+			}
+			if err = n.digits(0); err != nil {
+				return
+			}
+		} else {
+			// a leading zero without a prefix is still a digit
+			n.raw.WriteRune('0')
+			if n.c == '_' || isDigitOf(n.c, 10) {
+				if err = n.digits(1); err != nil {
+					return
+				}
+			}
+		}
+	} else if err = n.digits(0); err != nil {
+		return
+	}
+
+	if n.base == 10 && n.c == '.' {
+		kind = TFloat
+		n.raw.WriteRune('.')
+		if err = n.next(); err != nil {
+			return
+		}
+		if err = n.digits(0); err != nil {
+			return
+		}
+	}
+	if n.base == 10 && (n.c == 'e' || n.c == 'E') {
+		kind = TFloat
+		n.raw.WriteRune('e')
+		if err = n.next(); err != nil {
+			return
+		}
+		if n.c == '+' || n.c == '-' {
+			n.raw.WriteRune(n.c)
+			if err = n.next(); err != nil {
+				return
+			}
+		}
+		if err = n.digits(0); err != nil {
+			return
+		}
+	}
+
+	// a leading zero without a prefix makes an octal integer, like in C
+	if kind == TInt && n.base == 10 && !n.bad {
+		text := strings.TrimPrefix(l.src.Text(), "-")
+		if len(text) > 1 && text[0] == '0' {
+			for i, d := range text {
+				if d == '8' || d == '9' {
+					at := pos
+					at.Col += uint(i + len(l.src.Text()) - len(text))
+					at.Offset += uint(i + len(l.src.Text()) - len(text))
+					n.failAt(d, at, "Octal numbers may only use the digits 0-7")
+					break
+				}
+			}
+		}
+	}
+
+	suffix := eof
+	if n.base != 16 && (n.c == 'c' || n.c == 'i' || n.c == 'f') {
+		suffix = n.c
+		if kind == TFloat && suffix != 'f' {
+			n.fail("Only the f suffix is allowed after a float")
+		}
+		if err = n.next(); err != nil {
+			return
+		}
+	}
+
+	if n.bad {
+		// the error has already been reported
+	} else if n.base != 10 && isDigit(n.c) {
+		n.fail("Digit is not allowed in base " + strconv.Itoa(n.base))
+	} else if isIdentTail(n.c) || n.c == '.' {
+		n.fail("Unexpected character in number")
+	}
+
+	raw := n.raw.String()
+	if !n.bad {
+		switch suffix {
+		case 'c':
+			kind = TChar
+			i, perr := strconv.ParseInt(raw, 0, 32)
+			if perr != nil || !utf8.ValidRune(rune(i)) {
+				n.failAt(c, pos, "Number is not a valid character")
+				break
+			}
+			raw = string(rune(i))
+		case 'f':
+			if kind == TInt {
+				kind = TFloat
+				i, perr := strconv.ParseInt(raw, 0, 64)
+				if perr != nil {
+					n.failAt(c, pos, "Number is out of range")
+					break
+				}
+				raw = strconv.FormatInt(i, 10)
+			}
+		}
+	}
+	if !n.bad && kind == TInt {
+		if _, perr := strconv.ParseInt(raw, 0, 64); perr != nil {
+			n.failAt(c, pos, "Number is out of range")
+		}
+	}
+
+	if n.bad {
+		// skip the rest of the literal, and keep a valid value so parsing can
+		// continue
+		for isIdentTail(n.c) || n.c == '.' {
+			if err = n.next(); err != nil {
+				return
+			}
+		}
+		if kind == TChar {
+			raw = "\x00"
+		} else {
+			raw = "0"
+		}
+	}
+
+	if err = l.unread(n.c); err != nil {
+		return
+	}
+	tok = &Token{
+		Kind:  kind,
+		Where: l.span(pos),
+		Raw:   raw,
+	}
+	return
+}
@@ -2,14 +2,29 @@ package lexer
 
 import "fmt"
 
-// Position represents a location within a file.
+// Position represents a location within a file. Offset is the byte offset of
+// the location from the start of the file.
 type Position struct {
-	File string
-	Line uint
-	Col  uint
+	File   string
+	Line   uint
+	Col    uint
+	Offset uint
 }
 
 // String returns a formatted string of this Position
 func (p Position) String() string {
 	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
 }
+
+// Span represents a range of text within a file. Start points to the first
+// rune of the range and End points directly after the last rune of the range,
+// so End.Offset-Start.Offset is the length of the range in bytes.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// String returns a formatted string of this Span
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%d:%d", s.Start, s.End.Line, s.End.Col)
+}
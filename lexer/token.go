@@ -14,6 +14,17 @@ const (
 	TString
 	TChar
 	TPunct
+	// TError is a run of invalid input the lexer skipped over
+	TError
+	// TSpace and TComment are only produced if [Lexer.Trivia] is set
+	TSpace
+	TComment
+	// an interpolated string is split into segments around it's embedded
+	// values: TStringHead ends at the first embedded value, TStringMid lies
+	// between two of them and TStringTail ends the string after the last one
+	TStringHead
+	TStringMid
+	TStringTail
 )
 
 // used in (TokenKind).String()
@@ -24,6 +35,12 @@ var tokenKinds = []string{
 	"String",
 	"Char",
 	"Punct",
+	"Error",
+	"Space",
+	"Comment",
+	"StringHead",
+	"StringMid",
+	"StringTail",
 }
 
 // String returns the name of this kind of token
@@ -49,6 +66,9 @@ const (
 	PIf
 	PLoop
 	PExecute
+	PLBrace
+	PRBrace
+	PTry
 )
 
 var punctNames = []string{
@@ -66,6 +86,10 @@ var punctNames = []string{
 	"Return",
 	"If",
 	"Loop",
+	"Execute",
+	"Left Brace",
+	"Right Brace",
+	"Try",
 }
 
 func (p Punct) String() string {
@@ -74,8 +98,11 @@ func (p Punct) String() string {
 
 type Token struct {
 	Kind  TokenKind
-	Where Position
-	Raw   string
+	Where Span
+	// Raw is the value of the token, with escape sequences already replaced
+	Raw string
+	// Text is the exact text of the token as it appears in the source
+	Text string
 }
 
 func (t Token) Int() (int64, bool) {
@@ -100,10 +127,14 @@ func (t Token) Punct() (p Punct, ok bool) {
 	}
 	ok = true
 	switch t.Raw[0] {
-	case '(', '{':
+	case '(':
 		p = PLParen
-	case ')', '}':
+	case ')':
 		p = PRParen
+	case '{':
+		p = PLBrace
+	case '}':
+		p = PRBrace
 	case '[':
 		p = PLBrack
 	case ']':
@@ -128,6 +159,8 @@ func (t Token) Punct() (p Punct, ok bool) {
 		p = PLoop
 	case '!':
 		p = PExecute
+	case '^':
+		p = PTry
 	default:
 		p = PInvalid
 		ok = false
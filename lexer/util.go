@@ -1,26 +1,68 @@
 package lexer
 
+import (
+	"strings"
+	"unicode"
+)
+
 func isSpace(c rune) bool {
 	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
 }
 
+// isIdent checks if c can start an identifier: any Unicode letter or an
+// underscore
 func isIdent(c rune) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+	return unicode.IsLetter(c) || c == '_'
+}
+
+// isIdentTail checks if c can continue an identifier: anything that can start
+// an identifier and any Unicode digit
+func isIdentTail(c rune) bool {
+	return isIdent(c) || unicode.IsDigit(c)
+}
+
+// punctuators are the characters lexed as punctuators, including the slash
+// which is lexed separately due to comments
+const punctuators = "()[]{}$%:/>?*#@!^"
+
+// isPunct checks if c is any of the punctuators
+func isPunct(c rune) bool {
+	return strings.ContainsRune(punctuators, c)
 }
 
 func isDigit(c rune) bool {
-	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+	return c >= '0' && c <= '9'
+}
+
+// isDigitOf checks if c is a digit in the given base, which is one of 2, 8, 10
+// or 16
+func isDigitOf(c rune, base int) bool {
+	switch base {
+	case 2:
+		return c == '0' || c == '1'
+	case 8:
+		return c >= '0' && c <= '7'
+	case 16:
+		return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+	}
+	return isDigit(c)
 }
 
 func isNumberHead(c rune) bool {
 	return isDigit(c) || c == '-'
 }
 
-func isNumberTail(c rune) bool {
-	return isDigit(c) ||
-		c == '.' || // decimals
-		c == 'b' || c == 'o' || c == 'x' || // 0b-, 0o-, 0x-
-		c == '_' // digit separator
+// hexDigit returns the value of the given hexadecimal digit
+func hexDigit(c rune) (rune, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
 }
 
 func escapeSeq(e rune) (c rune, ok bool) {
@@ -28,6 +70,8 @@ func escapeSeq(e rune) (c rune, ok bool) {
 	switch e {
 	case '"', '\'':
 		c = e
+	case '0':
+		c = 0
 	case 'n':
 		c = '\n'
 	case 'r':
@@ -32,6 +32,12 @@ var builtins = map[string]builtin{
 	"at":     {ArgCount: 2},
 	"len":    {ArgCount: 1},
 
+	"get":    {ArgCount: 2},
+	"set":    {ArgCount: 3},
+	"delete": {ArgCount: 2},
+	"has":    {ArgCount: 2},
+	"keys":   {ArgCount: 1},
+
 	"str":  {ArgCount: 1},
 	"bool": {ArgCount: 1},
 
@@ -5,8 +5,10 @@ import (
 	"io"
 
 	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
 	"github.com/syzkrash/skol/debug"
 	"github.com/syzkrash/skol/lexer"
+	"github.com/syzkrash/skol/parser/values/types"
 )
 
 // parseIf parses an if condition and all of it's branches.
@@ -22,6 +24,9 @@ import (
 // With 1 else-if branch and an else branch:
 //
 //	?Condition!(Action!):?OtherCondition!(OtherAction!):(AnotherAction!)
+//
+// A second question mark begins a match statement instead, see
+// [Parser.parseMatch].
 func (p *Parser) parseIf() (n ast.Node, err error) {
 	var (
 		cond  ast.MetaNode
@@ -32,6 +37,15 @@ func (p *Parser) parseIf() (n ast.Node, err error) {
 		tok *lexer.Token
 	)
 
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); ok && pn == lexer.PIf {
+		return p.parseMatch()
+	}
+	p.rollback(tok)
+
 	cond, err = p.ParseValue()
 	if err != nil {
 		return
@@ -47,7 +61,7 @@ func (p *Parser) parseIf() (n ast.Node, err error) {
 	out.Main.Block = block
 
 	for {
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		if errors.Is(err, io.EOF) {
 			err = nil
 			break
@@ -56,10 +70,10 @@ func (p *Parser) parseIf() (n ast.Node, err error) {
 			return
 		}
 		if pn, ok := tok.Punct(); !ok || pn != lexer.PIs {
-			p.lexer.Rollback(tok)
+			p.rollback(tok)
 			break
 		}
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		if err != nil {
 			return
 		}
@@ -77,7 +91,7 @@ func (p *Parser) parseIf() (n ast.Node, err error) {
 				Block: block,
 			})
 		} else {
-			p.lexer.Rollback(tok)
+			p.rollback(tok)
 			out.Else, err = p.parseBlock()
 			if err != nil {
 				return
@@ -92,10 +106,41 @@ func (p *Parser) parseIf() (n ast.Node, err error) {
 	return
 }
 
-// parseWhile parses a while loop.
+// parseWhile parses a while loop. A loop punctuator followed by another
+// punctuator begins a for-each loop, see [Parser.parseForEach], or a break or
+// continue statement.
 //
 //	*Condition!(Action!)
+//
+// Break statement:
+//
+//	*>
+//
+// Continue statement:
+//
+//	*!
 func (p *Parser) parseWhile() (n ast.Node, err error) {
+	tok, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	switch pn, _ := tok.Punct(); pn {
+	case lexer.PVar:
+		return p.parseForEach()
+	case lexer.PReturn, lexer.PExecute:
+		if p.loops == 0 {
+			err = tokErr(pe.EOutsideLoop, tok)
+			return
+		}
+		if pn == lexer.PReturn {
+			n = ast.BreakNode{}
+		} else {
+			n = ast.ContinueNode{}
+		}
+		return
+	}
+	p.rollback(tok)
+
 	cond, err := p.ParseValue()
 	if err != nil {
 		return
@@ -103,6 +148,8 @@ func (p *Parser) parseWhile() (n ast.Node, err error) {
 
 	debug.Log(debug.AttrScope, "Entering new scope")
 	p.Scope = NewScope(p.Scope)
+	p.loops++
+	defer func() { p.loops-- }()
 	block, err := p.parseBlock()
 	if err != nil {
 		return
@@ -116,3 +163,334 @@ func (p *Parser) parseWhile() (n ast.Node, err error) {
 	}
 	return
 }
+
+// parseForEach parses a for-each loop, after the variable punctuator. The loop
+// binds every element of an array, or every character of a string, to the
+// element variable. If two names are given, the first one is bound to the
+// index of the element.
+//
+//	*%Elem: Values(Action!)
+//	*%Idx Elem: Values(Action!)
+func (p *Parser) parseForEach() (n ast.Node, err error) {
+	var (
+		out  ast.ForEachNode
+		tok  *lexer.Token
+		elem ast.Node
+	)
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if tok.Kind != lexer.TIdent {
+		err = tokErr(pe.EExpectedName, tok)
+		return
+	}
+	out.Elem = tok.Raw
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if tok.Kind == lexer.TIdent {
+		out.Index = out.Elem
+		out.Elem = tok.Raw
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PIs {
+		err = tokErr(pe.EExpectedColon, tok)
+		return
+	}
+
+	out.Iter, err = p.ParseValue()
+	if err != nil {
+		return
+	}
+	t, terr := p.TypeOf(out.Iter.Node)
+	switch {
+	case terr != nil:
+		// the types of builtin calls are only known to the typechecker, which
+		// also checks the element type
+		elem = ast.TypecastNode{Cast: types.Undefined}
+	case types.String.Equals(t):
+		elem = ast.CharNode{}
+	case t.Prim() == types.PArray:
+		var ok bool
+		if elem, ok = p.NodeOf(types.Unalias(t).(types.ArrayType).Element); !ok {
+			elem = ast.TypecastNode{Cast: types.Unalias(t).(types.ArrayType).Element}
+		}
+	default:
+		err = nodeErr(pe.ENotIterable, out.Iter).Section("Iterated type", "%s", t)
+		return
+	}
+
+	outer := p.Scope
+	defer func() { p.Scope = outer }()
+	debug.Log(debug.AttrScope, "Entering new scope")
+	p.Scope = NewScope(outer)
+	if out.Index != "" {
+		p.Scope.Vars[out.Index] = ast.IntNode{}
+	}
+	p.Scope.Vars[out.Elem] = elem
+
+	p.loops++
+	defer func() { p.loops-- }()
+	out.Block, err = p.parseBlock()
+	if err != nil {
+		return
+	}
+	debug.Log(debug.AttrScope, "Exiting scope")
+
+	n = out
+	return
+}
+
+// parseMatch parses a match statement, after both question marks. Each arm is
+// a pattern followed by a block, the default arm uses a colon instead of a
+// pattern. Names in patterns bind the matched value in the arm's block.
+//
+// Literal patterns:
+//
+//	??Sep(
+//	  ','(print! "comma")
+//	  '\n'(print! "newline")
+//	  :(print! "other")
+//	)
+//
+// Structure patterns, with a pattern for every field:
+//
+//	??Pos(
+//	  @Vec2i 0 0(print! "origin")
+//	  @Vec2i X 0(print! "on the X axis")
+//	  P(print! "somewhere else")
+//	)
+//
+// Variant patterns, with an optional pattern for the payload:
+//
+//	??Shape(
+//	  #Circle R(> mul! R R)
+//	  #Empty(> 0.0)
+//	)
+func (p *Parser) parseMatch() (n ast.Node, err error) {
+	var (
+		out ast.MatchNode
+		arm ast.MatchArm
+		t   types.Type
+		tok *lexer.Token
+	)
+
+	out.Value, err = p.ParseValue()
+	if err != nil {
+		return
+	}
+	t, err = p.TypeOf(out.Value.Node)
+	if err != nil {
+		return
+	}
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PLParen {
+		err = tokErr(pe.EExpectedLParen, tok)
+		return
+	}
+
+	outer := p.Scope
+	defer func() { p.Scope = outer }()
+
+	for {
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			break
+		}
+
+		debug.Log(debug.AttrScope, "Entering new scope")
+		p.Scope = NewScope(outer)
+		if pn, ok := tok.Punct(); ok && pn == lexer.PIs {
+			arm.Pattern = ast.Pattern{
+				Kind:  ast.PatBind,
+				Where: tok.Where,
+			}
+		} else {
+			arm.Pattern, err = p.parsePattern(tok, t)
+			if err != nil {
+				return
+			}
+		}
+		arm.Block, err = p.parseBlock()
+		if err != nil {
+			return
+		}
+		debug.Log(debug.AttrScope, "Exiting scope")
+		p.Scope = outer
+
+		out.Arms = append(out.Arms, arm)
+	}
+
+	n = out
+	return
+}
+
+// parsePattern parses a pattern starting with the given token, matching values
+// of the given type. See [Parser.parseMatch].
+func (p *Parser) parsePattern(tok *lexer.Token, t types.Type) (pat ast.Pattern, err error) {
+	start := tok
+
+	switch tok.Kind {
+	case lexer.TInt, lexer.TFloat, lexer.TString, lexer.TChar:
+		pat.Kind = ast.PatLiteral
+		pat.Value.Node, err = p.value(tok)
+	case lexer.TIdent:
+		// constants stand for their value, any other name binds the value
+		if c, ok := p.Scope.FindConst(tok.Raw); ok {
+			if !isLiteral(c) {
+				err = tokErr(pe.EBadPattern, tok)
+				return
+			}
+			pat.Kind = ast.PatLiteral
+			pat.Value.Node = c
+			break
+		}
+		falseVal, ok := p.NodeOf(t)
+		if !ok {
+			err = tokErr(pe.EBadPattern, tok).Section("Matched type", "%s", t)
+			return
+		}
+		p.Scope.Vars[tok.Raw] = falseVal
+		pat.Kind = ast.PatBind
+		pat.Bind = tok.Raw
+	case lexer.TPunct:
+		switch pn, _ := tok.Punct(); pn {
+		case lexer.PLoop, lexer.PType:
+			pat.Kind = ast.PatLiteral
+			pat.Value.Node, err = p.value(tok)
+		case lexer.PStruct:
+			pat, err = p.parseStructPattern(t)
+		case lexer.PField:
+			pat, err = p.parseVariantPattern(t)
+		default:
+			err = tokErr(pe.EBadPattern, tok)
+		}
+	default:
+		err = tokErr(pe.EBadPattern, tok)
+	}
+
+	if pat.Kind == ast.PatLiteral {
+		pat.Value.Where = p.span(start)
+	}
+	pat.Where = p.span(start)
+	return
+}
+
+// parseStructPattern parses a structure pattern, after the at sign. The type
+// arguments of generic structures are taken from the matched type.
+//
+//	@Vec2i X 0
+//	 ^^^^^^^^^
+func (p *Parser) parseStructPattern(t types.Type) (pat ast.Pattern, err error) {
+	tok, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	if tok.Kind != lexer.TIdent {
+		err = tokErr(pe.EExpectedName, tok)
+		return
+	}
+	st, ok := p.Scope.FindType(tok.Raw)
+	if !ok {
+		err = tokErr(pe.EUnknownType, tok)
+		return
+	}
+	s, ok := types.Unalias(st).(types.StructType)
+	if !ok {
+		err = tokErr(pe.EBadPattern, tok).Section("Matched type", "%s", st)
+		return
+	}
+	if ms, ok := types.Unalias(t).(types.StructType); ok && ms.Name == s.Name {
+		s = ms
+	}
+
+	pat.Kind = ast.PatStruct
+	pat.Type = s
+	pat.Fields = make([]ast.Pattern, len(s.Fields))
+	for i, f := range s.Fields {
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		pat.Fields[i], err = p.parsePattern(tok, f.Type)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseVariantPattern parses a tagged union variant pattern, after the hash.
+// The payload pattern may be left out, unless the variant is matched inside of
+// another pattern.
+//
+//	#Circle R
+//	 ^^^^^^^^
+func (p *Parser) parseVariantPattern(t types.Type) (pat ast.Pattern, err error) {
+	tok, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	if tok.Kind != lexer.TIdent {
+		err = tokErr(pe.EExpectedName, tok)
+		return
+	}
+	u, ok := types.Unalias(t).(types.UnionType)
+	if !ok {
+		err = tokErr(pe.EBadPattern, tok).Section("Matched type", "%s", t)
+		return
+	}
+	vt, ok := u.Variant(tok.Raw)
+	if !ok {
+		err = tokErr(pe.EUnknownVariant, tok).Section("Union", "%s", u)
+		return
+	}
+
+	pat.Kind = ast.PatVariant
+	pat.Type = u
+	pat.Variant = tok.Raw
+	pat.Fields = []ast.Pattern{}
+	if vt.Prim() == types.PNothing {
+		return
+	}
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); ok && pn == lexer.PLParen {
+		p.rollback(tok)
+		return
+	}
+	var payload ast.Pattern
+	payload, err = p.parsePattern(tok, vt)
+	if err != nil {
+		return
+	}
+	pat.Fields = append(pat.Fields, payload)
+	return
+}
+
+// isLiteral returns true if the given node is a literal of a primitive type.
+func isLiteral(n ast.Node) bool {
+	switch n.Kind() {
+	case ast.NBool, ast.NChar, ast.NInt, ast.NFloat, ast.NString:
+		return true
+	default:
+		return false
+	}
+}
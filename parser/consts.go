@@ -0,0 +1,530 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+)
+
+// evalConst evaluates the value of a constant at compile time. Calls to builtin
+// functions are folded into literals, so that constants never have to be
+// computed at runtime. Constants may only depend on literals, other constants
+// and builtin functions; constants are replaced by their value as they are
+// parsed, so they are literals by the time they get here.
+//
+//	#Size: mul! 4 1024
+//	        ^^^^^^^^^^ folded into 4096
+func (p *Parser) evalConst(mn ast.MetaNode) (n ast.Node, err error) {
+	switch v := mn.Node.(type) {
+	case ast.BoolNode, ast.CharNode, ast.IntNode, ast.FloatNode, ast.StringNode, ast.FuncRefNode:
+		return v, nil
+	case ast.StructNode:
+		v.Args, err = p.evalConsts(v.Args)
+		return v, err
+	case ast.ArrayNode:
+		v.Elems, err = p.evalConsts(v.Elems)
+		return v, err
+	case ast.MapNode:
+		if v.Keys, err = p.evalConsts(v.Keys); err != nil {
+			return
+		}
+		v.Values, err = p.evalConsts(v.Values)
+		return v, err
+	case ast.VariantNode:
+		if v.Value.Node != nil {
+			v.Value.Node, err = p.evalConst(v.Value)
+		}
+		return v, err
+	case ast.Selector:
+		err = nodeErr(pe.ENotConstant, mn).Section("Depends on", "variable %s", v.Path()[0].Name)
+		return
+	case ast.FuncCallNode:
+		return p.evalConstCall(mn)
+	case ast.InterpNode:
+		return p.evalConstInterp(mn)
+	}
+	err = nodeErr(pe.ENotConstant, mn)
+	return
+}
+
+// evalConsts evaluates every given value with [Parser.evalConst].
+func (p *Parser) evalConsts(mns []ast.MetaNode) ([]ast.MetaNode, error) {
+	vals := make([]ast.MetaNode, len(mns))
+	for i, mn := range mns {
+		n, err := p.evalConst(mn)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = ast.MetaNode{Node: n, Where: mn.Where}
+	}
+	return vals, nil
+}
+
+// evalConstCall evaluates a call to a builtin function with constant
+// arguments. The builtins follow the semantics the language defines for them
+// (see docs/std.md), which every engine implements at runtime, so the result is
+// the same whichever engine the program is compiled for.
+func (p *Parser) evalConstCall(mn ast.MetaNode) (n ast.Node, err error) {
+	fc := mn.Node.(ast.FuncCallNode)
+	if _, ok := p.Tree.Funcs[fc.Func]; ok {
+		err = nodeErr(pe.ENotConstant, mn).Section("Depends on", "function %s", fc.Func)
+		return
+	}
+	if _, ok := p.Tree.Exerns[fc.Func]; ok {
+		err = nodeErr(pe.ENotConstant, mn).Section("Depends on", "extern %s", fc.Func)
+		return
+	}
+	if _, ok := builtins[fc.Func]; !ok {
+		err = nodeErr(pe.ENotConstant, mn).Section("Depends on", "variable %s", fc.Func)
+		return
+	}
+	eval, ok := constBuiltins[fc.Func]
+	if !ok {
+		err = nodeErr(pe.EBadConstant, mn).Section("Details", "%s cannot be evaluated at compile time", fc.Func)
+		return
+	}
+
+	args, err := p.evalConsts(fc.Args)
+	if err != nil {
+		return
+	}
+	nodes := make([]ast.Node, len(args))
+	for i, a := range args {
+		nodes[i] = a.Node
+	}
+	n, cerr := eval(nodes)
+	if cerr != nil {
+		err = nodeErr(pe.EBadConstant, mn).Section("Details", "%s: %s", fc.Func, cerr)
+	}
+	return
+}
+
+// evalConstInterp folds an interpolated string with constant embedded values
+// into a string literal. The values are turned into strings like the str
+// builtin does.
+func (p *Parser) evalConstInterp(mn ast.MetaNode) (n ast.Node, err error) {
+	in := mn.Node.(ast.InterpNode)
+	vals, err := p.evalConsts(in.Values)
+	if err != nil {
+		return
+	}
+	var b strings.Builder
+	for i, part := range in.Parts {
+		b.WriteString(part)
+		if i >= len(vals) {
+			break
+		}
+		s, ok := strValue(vals[i].Node)
+		if !ok {
+			err = nodeErr(pe.EBadConstant, vals[i]).Section("Details", "str: %s", errArgs([]ast.Node{vals[i].Node}))
+			return
+		}
+		b.WriteString(s)
+	}
+	n = ast.StringNode{Value: b.String()}
+	return
+}
+
+// constBuiltin evaluates a builtin function with the given literal arguments.
+// The amount of arguments has already been ensured by the parser.
+type constBuiltin func(args []ast.Node) (ast.Node, error)
+
+var (
+	errDivZero  = errors.New("division by zero")
+	errOverflow = errors.New("result does not fit in 64 bits")
+	errRange    = errors.New("index out of range")
+)
+
+// errArgs creates an error for arguments that the builtin cannot be used with.
+func errArgs(args []ast.Node) error {
+	kinds := make([]string, len(args))
+	for i, a := range args {
+		kinds[i] = a.Kind().String()
+	}
+	return fmt.Errorf("cannot be used with %s", strings.Join(kinds, " and "))
+}
+
+// constMath creates an arithmetic builtin working on two integers or two
+// floats. Integers are computed without overflowing, so that results which
+// could not be represented are rejected instead of silently wrapping.
+func constMath(ints func(a, b *big.Int) (*big.Int, error), floats func(a, b float64) (float64, error)) constBuiltin {
+	return func(args []ast.Node) (ast.Node, error) {
+		switch a := args[0].(type) {
+		case ast.IntNode:
+			if b, ok := args[1].(ast.IntNode); ok && ints != nil {
+				r, err := ints(big.NewInt(a.Value), big.NewInt(b.Value))
+				if err != nil {
+					return nil, err
+				}
+				if !r.IsInt64() {
+					return nil, errOverflow
+				}
+				return ast.IntNode{Value: r.Int64()}, nil
+			}
+		case ast.FloatNode:
+			if b, ok := args[1].(ast.FloatNode); ok && floats != nil {
+				r, err := floats(a.Value, b.Value)
+				if err != nil {
+					return nil, err
+				}
+				if math.IsInf(r, 0) || math.IsNaN(r) {
+					return nil, errOverflow
+				}
+				return ast.FloatNode{Value: r}, nil
+			}
+		}
+		return nil, errArgs(args)
+	}
+}
+
+// floorDivMod divides a by b, rounding the quotient towards negative infinity.
+// The remainder has the same sign as b.
+func floorDivMod(a, b *big.Int) (q, m *big.Int, err error) {
+	if b.Sign() == 0 {
+		return nil, nil, errDivZero
+	}
+	q, m = new(big.Int).QuoRem(a, b, new(big.Int))
+	if m.Sign() != 0 && m.Sign() != b.Sign() {
+		q.Sub(q, big.NewInt(1))
+		m.Add(m, b)
+	}
+	return
+}
+
+// constNumber converts a numeric literal to a float for comparisons. Booleans
+// and characters are numbers at runtime, so they are compared as such.
+func constNumber(n ast.Node) (f float64, isInt bool, ok bool) {
+	switch v := n.(type) {
+	case ast.BoolNode:
+		if v.Value {
+			return 1, true, true
+		}
+		return 0, true, true
+	case ast.CharNode:
+		return float64(v.Value), true, true
+	case ast.IntNode:
+		return float64(v.Value), true, true
+	case ast.FloatNode:
+		return v.Value, false, true
+	}
+	return 0, false, false
+}
+
+// constInteger converts an integer, boolean or character literal to an int64.
+func constInteger(n ast.Node) int64 {
+	switch v := n.(type) {
+	case ast.BoolNode:
+		if v.Value {
+			return 1
+		}
+	case ast.CharNode:
+		return int64(v.Value)
+	case ast.IntNode:
+		return v.Value
+	}
+	return 0
+}
+
+// constCompare compares two literals, returning -1, 0 or 1.
+func constCompare(a, b ast.Node) (int, error) {
+	if as, ok := a.(ast.StringNode); ok {
+		if bs, ok := b.(ast.StringNode); ok {
+			return strings.Compare(as.Value, bs.Value), nil
+		}
+		return 0, errArgs([]ast.Node{a, b})
+	}
+	af, aInt, aok := constNumber(a)
+	bf, bInt, bok := constNumber(b)
+	if !aok || !bok {
+		return 0, errArgs([]ast.Node{a, b})
+	}
+	// compare integers exactly, as they may not fit in a float
+	if aInt && bInt {
+		ai, bi := constInteger(a), constInteger(b)
+		switch {
+		case ai < bi:
+			return -1, nil
+		case ai > bi:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	switch {
+	case af < bf:
+		return -1, nil
+	case af > bf:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// constSequence returns the elements of a string or an array literal. The
+// characters of a string are returned as character literals.
+func constSequence(n ast.Node) ([]ast.Node, bool) {
+	switch v := n.(type) {
+	case ast.StringNode:
+		var elems []ast.Node
+		for _, c := range v.Value {
+			elems = append(elems, ast.CharNode{Value: c})
+		}
+		return elems, true
+	case ast.ArrayNode:
+		elems := make([]ast.Node, len(v.Elems))
+		for i, e := range v.Elems {
+			elems[i] = e.Node
+		}
+		return elems, true
+	}
+	return nil, false
+}
+
+// constWithElems creates a literal of the same kind as like with the given
+// elements.
+func constWithElems(like ast.Node, elems []ast.Node) ast.Node {
+	if a, ok := like.(ast.ArrayNode); ok {
+		a.Elems = make([]ast.MetaNode, len(elems))
+		for i, e := range elems {
+			a.Elems[i] = ast.MetaNode{Node: e}
+		}
+		return a
+	}
+	var s strings.Builder
+	for _, e := range elems {
+		s.WriteRune(e.(ast.CharNode).Value)
+	}
+	return ast.StringNode{Value: s.String()}
+}
+
+// seqIndex normalizes an index into a sequence: negative indices count from the
+// end of the sequence.
+func seqIndex(i int64, length int) int64 {
+	if i < 0 {
+		i += int64(length)
+	}
+	return i
+}
+
+// seqClamp normalizes the given slice bound with [seqIndex] and limits it to the
+// bounds of a sequence.
+func seqClamp(i int64, length int) int {
+	i = seqIndex(i, length)
+	switch {
+	case i < 0:
+		return 0
+	case i > int64(length):
+		return length
+	}
+	return int(i)
+}
+
+// strValue formats a literal like the str builtin does. Characters are numbers,
+// so they are formatted as one.
+func strValue(n ast.Node) (string, bool) {
+	switch v := n.(type) {
+	case ast.BoolNode:
+		if v.Value {
+			return "True", true
+		}
+		return "False", true
+	case ast.CharNode:
+		return strconv.Itoa(int(v.Value)), true
+	case ast.IntNode:
+		return strconv.FormatInt(v.Value, 10), true
+	case ast.FloatNode:
+		// scientific notation is used for exponents outside of [-4, 16), and a
+		// decimal point is always included otherwise
+		e := strconv.FormatFloat(v.Value, 'e', -1, 64)
+		if exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:]); exp < -4 || exp >= 16 {
+			return e, true
+		}
+		s := strconv.FormatFloat(v.Value, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, true
+	case ast.StringNode:
+		return v.Value, true
+	}
+	return "", false
+}
+
+var constBuiltins = map[string]constBuiltin{
+	"add": func(args []ast.Node) (ast.Node, error) {
+		if a, ok := args[0].(ast.StringNode); ok {
+			if b, ok := args[1].(ast.StringNode); ok {
+				return ast.StringNode{Value: a.Value + b.Value}, nil
+			}
+		}
+		return constMath(
+			func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Add(a, b), nil },
+			func(a, b float64) (float64, error) { return a + b, nil },
+		)(args)
+	},
+	"sub": constMath(
+		func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Sub(a, b), nil },
+		func(a, b float64) (float64, error) { return a - b, nil },
+	),
+	"mul": constMath(
+		func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Mul(a, b), nil },
+		func(a, b float64) (float64, error) { return a * b, nil },
+	),
+	"div": constMath(
+		func(a, b *big.Int) (*big.Int, error) {
+			q, _, err := floorDivMod(a, b)
+			return q, err
+		},
+		func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errDivZero
+			}
+			return a / b, nil
+		},
+	),
+	"pow": constMath(
+		func(a, b *big.Int) (*big.Int, error) {
+			if b.Sign() < 0 {
+				return nil, errors.New("negative exponent")
+			}
+			// anything but -1, 0 and 1 overflows long before this
+			if a.CmpAbs(big.NewInt(1)) > 0 && b.Cmp(big.NewInt(64)) > 0 {
+				return nil, errOverflow
+			}
+			return new(big.Int).Exp(a, b, nil), nil
+		},
+		func(a, b float64) (float64, error) { return math.Pow(a, b), nil },
+	),
+	"mod": constMath(
+		func(a, b *big.Int) (*big.Int, error) {
+			_, m, err := floorDivMod(a, b)
+			return m, err
+		},
+		nil,
+	),
+
+	"eq": func(args []ast.Node) (ast.Node, error) {
+		_, aStr := args[0].(ast.StringNode)
+		_, bStr := args[1].(ast.StringNode)
+		if aStr != bStr {
+			return ast.BoolNode{Value: false}, nil
+		}
+		c, err := constCompare(args[0], args[1])
+		return ast.BoolNode{Value: c == 0}, err
+	},
+	"gt": func(args []ast.Node) (ast.Node, error) {
+		c, err := constCompare(args[0], args[1])
+		return ast.BoolNode{Value: c > 0}, err
+	},
+	"lt": func(args []ast.Node) (ast.Node, error) {
+		c, err := constCompare(args[0], args[1])
+		return ast.BoolNode{Value: c < 0}, err
+	},
+
+	"not": func(args []ast.Node) (ast.Node, error) {
+		if a, ok := args[0].(ast.BoolNode); ok {
+			return ast.BoolNode{Value: !a.Value}, nil
+		}
+		return nil, errArgs(args)
+	},
+	"and": func(args []ast.Node) (ast.Node, error) {
+		a, aok := args[0].(ast.BoolNode)
+		b, bok := args[1].(ast.BoolNode)
+		if !aok || !bok {
+			return nil, errArgs(args)
+		}
+		return ast.BoolNode{Value: a.Value && b.Value}, nil
+	},
+	"or": func(args []ast.Node) (ast.Node, error) {
+		a, aok := args[0].(ast.BoolNode)
+		b, bok := args[1].(ast.BoolNode)
+		if !aok || !bok {
+			return nil, errArgs(args)
+		}
+		return ast.BoolNode{Value: a.Value || b.Value}, nil
+	},
+
+	"append": func(args []ast.Node) (ast.Node, error) {
+		elems, ok := constSequence(args[0])
+		if _, isStr := args[0].(ast.StringNode); !ok || isStr && args[1].Kind() != ast.NChar {
+			return nil, errArgs(args)
+		}
+		return constWithElems(args[0], append(elems, args[1])), nil
+	},
+	"concat": func(args []ast.Node) (ast.Node, error) {
+		a, aok := constSequence(args[0])
+		b, bok := constSequence(args[1])
+		if !aok || !bok || args[0].Kind() != args[1].Kind() {
+			return nil, errArgs(args)
+		}
+		return constWithElems(args[0], append(a, b...)), nil
+	},
+	"slice": func(args []ast.Node) (ast.Node, error) {
+		elems, ok := constSequence(args[0])
+		start, sok := args[1].(ast.IntNode)
+		end, eok := args[2].(ast.IntNode)
+		if !ok || !sok || !eok {
+			return nil, errArgs(args)
+		}
+		lo, hi := seqClamp(start.Value, len(elems)), len(elems)
+		if end.Value >= 0 {
+			hi = seqClamp(end.Value, len(elems))
+		}
+		if hi < lo {
+			hi = lo
+		}
+		return constWithElems(args[0], elems[lo:hi]), nil
+	},
+	"at": func(args []ast.Node) (ast.Node, error) {
+		elems, ok := constSequence(args[0])
+		i, iok := args[1].(ast.IntNode)
+		if !ok || !iok {
+			return nil, errArgs(args)
+		}
+		idx := seqIndex(i.Value, len(elems))
+		if idx < 0 || idx >= int64(len(elems)) {
+			return nil, errRange
+		}
+		return elems[idx], nil
+	},
+	"len": func(args []ast.Node) (ast.Node, error) {
+		if m, ok := args[0].(ast.MapNode); ok {
+			// keys may repeat in a literal, but the map only holds them once
+			keys := make(map[ast.Node]bool)
+			for _, k := range m.Keys {
+				keys[k.Node] = true
+			}
+			return ast.IntNode{Value: int64(len(keys))}, nil
+		}
+		elems, ok := constSequence(args[0])
+		if !ok {
+			return nil, errArgs(args)
+		}
+		return ast.IntNode{Value: int64(len(elems))}, nil
+	},
+
+	"str": func(args []ast.Node) (ast.Node, error) {
+		s, ok := strValue(args[0])
+		if !ok {
+			return nil, errArgs(args)
+		}
+		return ast.StringNode{Value: s}, nil
+	},
+	"bool": func(args []ast.Node) (ast.Node, error) {
+		if f, _, ok := constNumber(args[0]); ok {
+			return ast.BoolNode{Value: f != 0}, nil
+		}
+		if m, ok := args[0].(ast.MapNode); ok {
+			return ast.BoolNode{Value: len(m.Keys) > 0}, nil
+		}
+		if elems, ok := constSequence(args[0]); ok {
+			return ast.BoolNode{Value: len(elems) > 0}, nil
+		}
+		// every other value is an object, which is always true
+		return ast.BoolNode{Value: true}, nil
+	},
+}
@@ -23,6 +23,11 @@ import (
 // Both:
 //
 //	%name/string: "Joe"
+//
+// Structure field or array element assignment:
+//
+//	%person#name: "Joe"
+//	%names#[i]: "Joe"
 func (p *Parser) parseVar() (n ast.Node, err error) {
 	var (
 		name string
@@ -36,29 +41,38 @@ func (p *Parser) parseVar() (n ast.Node, err error) {
 		tok *lexer.Token
 	)
 
-	tok, err = p.lexer.Next()
+	tok, err = p.nextToken()
 	if err != nil {
 		return
 	}
 
+	if pn, ok := tok.Punct(); ok && pn == lexer.PLParen {
+		return p.parseDestructure(tok)
+	}
 	if tok.Kind != lexer.TIdent {
 		err = tokErr(pe.EExpectedName, tok)
 		return
 	}
 	name = tok.Raw
+	nameTok := tok
 
-	tok, err = p.lexer.Next()
+	tok, err = p.nextToken()
 	if err != nil {
 		return
 	}
 
+	if pn, ok := tok.Punct(); ok && pn == lexer.PField {
+		p.rollback(tok)
+		return p.parseSelectorSet(nameTok)
+	}
+
 	if pn, ok := tok.Punct(); ok && pn == lexer.PType {
 		typed = true
 		vtype, err = p.parseType()
 		if err != nil {
 			return
 		}
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		if errors.Is(err, io.EOF) {
 			err = nil
 			goto final
@@ -74,7 +88,7 @@ func (p *Parser) parseVar() (n ast.Node, err error) {
 			return
 		}
 	} else if typed {
-		p.lexer.Rollback(tok)
+		p.rollback(tok)
 	}
 
 final:
@@ -88,7 +102,9 @@ final:
 			Var:  name,
 			Type: vtype,
 		}
-		p.Scope.SetVar(name, nil)
+		// keep a placeholder value around, so the variable's type is known
+		zero, _ := p.NodeOf(vtype)
+		p.Scope.SetVar(name, zero)
 	} else if !typed && valued {
 		n = ast.VarSetNode{
 			Var:   name,
@@ -101,16 +117,57 @@ final:
 			Type:  vtype,
 			Value: value,
 		}
-		p.Scope.SetVar(name, value.Node)
+		// the declared type is the variable's type, even if the type of the value
+		// can't be known yet
+		if zero, ok := p.NodeOf(vtype); ok {
+			p.Scope.SetVar(name, zero)
+		} else {
+			p.Scope.SetVar(name, value.Node)
+		}
 	}
 	return
 }
 
-// parseConst parses a constant definition.
+// parseSelectorSet parses an assignment to a structure field or an array
+// element of the given variable, after the variable's name. See
+// [Parser.parseVar].
+func (p *Parser) parseSelectorSet(name *lexer.Token) (n ast.Node, err error) {
+	if _, ok := p.Scope.FindVar(name.Raw); !ok {
+		err = tokErr(pe.EUnknownVariable, name)
+		return
+	}
+	target, err := p.parseSelector(name)
+	if err != nil {
+		return
+	}
+
+	tok, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PIs {
+		err = tokErr(pe.EExpectedColon, tok)
+		return
+	}
+	value, err := p.ParseValue()
+	if err != nil {
+		return
+	}
+
+	n = ast.SelectorSetNode{
+		Target: target.(ast.Selector),
+		Value:  value,
+	}
+	return
+}
+
+// parseConst parses a constant definition. The value of the constant is
+// evaluated at compile time, see [Parser.evalConst].
 //
 //	#name: "Joe"
+//	#size: mul! 4 1024
 func (p *Parser) parseConst() (err error) {
-	nameToken, err := p.lexer.Next()
+	nameToken, err := p.nextToken()
 	if err != nil {
 		return
 	}
@@ -119,7 +176,7 @@ func (p *Parser) parseConst() (err error) {
 		return
 	}
 
-	sept, err := p.lexer.Next()
+	sept, err := p.nextToken()
 	if err != nil {
 		return err
 	}
@@ -132,8 +189,12 @@ func (p *Parser) parseConst() (err error) {
 	if err != nil {
 		return err
 	}
+	v, err := p.evalConst(n)
+	if err != nil {
+		return err
+	}
 
-	if !p.Scope.SetConst(nameToken.Raw, n.Node) {
+	if !p.Scope.SetConst(nameToken.Raw, v) {
 		return tokErr(pe.EConstantRedefined, nameToken)
 	}
 	return nil
@@ -159,21 +220,184 @@ func (p *Parser) parseConst() (err error) {
 // Function shorthand:
 //
 //	$Add1/int n/int: add_i! n 1
+//
+// Method definition, see [Parser.checkReceiver]:
+//
+//	$Vec2i#Len/int V/Vec2i: add! V#x V#y
+//
+// Functions may also be defined inside of another function, see
+// [Parser.defineNested]. Their shorthand bodies are turned into full bodies.
 func (p *Parser) parseFunc() (n ast.Node, err error) {
 	var (
-		name          string
-		ret           types.Type
-		args          []types.Descriptor
 		body          ast.Block
 		shorthandBody ast.MetaNode
+	)
+
+	// leave the scope of the type parameters, if there are any
+	outer := p.Scope
+	defer func() { p.Scope = outer }()
+	// loops outside of the function cannot be left from inside of it
+	loops := p.loops
+	defer func() { p.loops = loops }()
+	p.loops = 0
+	nested := p.funcs > 0
+	p.funcs++
+	defer func() { p.funcs-- }()
+
+	start, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	p.rollback(start)
+	name, recv, params, ret, args, tok, err := p.parsePrototype()
+	if err != nil {
+		return
+	}
+	if nested {
+		if err = p.defineNested(start, tok, name, recv, params, ret, args); err != nil {
+			return
+		}
+	}
 
+	switch pn, _ := tok.Punct(); pn {
+	case lexer.PIf:
+		if recv != "" {
+			err = tokErr(pe.ENeedBodyOrExtern, tok)
+			return
+		}
+		n = ast.FuncExternNode{
+			Alias: name,
+			Proto: args,
+			Ret:   ret,
+			Name:  name,
+		}
+	case lexer.PLParen:
+		p.rollback(tok)
+		p.Scope = &Scope{
+			Parent: p.Scope,
+			Vars:   make(map[string]ast.Node),
+			Consts: make(map[string]ast.Node),
+			Types:  make(map[string]types.Type),
+		}
+		for _, a := range args {
+			var falseVal, ok = p.NodeOf(a.Type)
+			if !ok {
+				err = tokErr(pe.EBadFuncArgType, tok)
+				return
+			}
+			p.Scope.Vars[a.Name] = falseVal
+		}
+		body, err = p.parseBlock()
+		if err != nil {
+			return
+		}
+		p.Scope = p.Scope.Parent
+		n = ast.FuncDefNode{
+			Name:   name,
+			Recv:   recv,
+			Params: params,
+			Proto:  args,
+			Ret:    ret,
+			Body:   body,
+		}
+	case lexer.PIs:
+		p.Scope = &Scope{
+			Parent: p.Scope,
+			Vars:   make(map[string]ast.Node),
+			Consts: make(map[string]ast.Node),
+			Types:  make(map[string]types.Type),
+		}
+		for _, a := range args {
+			var falseVal, ok = p.NodeOf(a.Type)
+			if !ok {
+				err = tokErr(pe.EBadFuncArgType, tok)
+				return
+			}
+			p.Scope.Vars[a.Name] = falseVal
+		}
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		// ensure that @ always means structure instatiation inside of a
+		// shorthand (struct definitions are not allowed in functions anyways)
+		if pn, ok := tok.Punct(); ok && pn == lexer.PStruct {
+			p.rollback(tok)
+			shorthandBody, err = p.ParseValue()
+		} else {
+			shorthandBody, _, err = p.next(tok)
+		}
+		if err != nil {
+			return
+		}
+		p.Scope = p.Scope.Parent
+		n = ast.FuncShorthandNode{
+			Name:   name,
+			Recv:   recv,
+			Params: params,
+			Proto:  args,
+			Ret:    ret,
+			Body:   shorthandBody,
+		}
+		if nested {
+			n = ast.FuncDefNode{
+				Name:  name,
+				Proto: args,
+				Ret:   ret,
+				Body:  shorthandBlock(shorthandBody),
+			}
+		}
+	}
+	return
+}
+
+// defineNested declares a function defined inside of another function as a
+// variable of the enclosing function. This happens before the body is parsed,
+// so that the function can call itself. The body can use the variables of the
+// enclosing function like an anonymous function can. Nested functions cannot
+// be methods, generic or externs, and cannot have the name of a named or
+// built-in function, as calls would never reach them.
+//
+//	$Main(
+//	  %Base: 10
+//	  $Add/int N/int: add! N Base
+//	  print! str! Add! 5
+//	)
+func (p *Parser) defineNested(start, end *lexer.Token, name, recv string, params []string, ret types.Type, args []types.Descriptor) error {
+	if pn, _ := end.Punct(); recv != "" || len(params) > 0 || pn == lexer.PIf {
+		return tokErr(pe.EBadNestedFunc, start)
+	}
+	_, isFunc := p.Tree.Funcs[name]
+	_, isBuiltin := builtins[name]
+	if isFunc || isBuiltin {
+		return tokErr(pe.EShadowedFunc, start).Section("Function", "%s", name)
+	}
+	p.Scope.Vars[name] = ast.LambdaNode{
+		Proto: args,
+		Ret:   ret,
+	}
+	return nil
+}
+
+// parsePrototype parses the name, type parameters, return type and arguments of
+// a function, up to and including the token that ends the prototype: a `?` for
+// an extern, a `(` for a function body or a `:` for a shorthand body. If the
+// function has type parameters, their scope is left for the caller to leave.
+// The name of a method is preceded by the name of its structure, which is
+// returned as recv.
+//
+//	$Add1/int n/int
+//	$First[T]/T Arr/[T]
+//	$Vec2i#Len/int V/Vec2i
+func (p *Parser) parsePrototype() (name, recv string, params []string, ret types.Type, args []types.Descriptor, end *lexer.Token, err error) {
+	var (
 		argName string
 		argType types.Type
 
-		tok *lexer.Token
+		tok, nameTok, recvTok *lexer.Token
 	)
 
-	tok, err = p.lexer.Next()
+	tok, err = p.nextToken()
 	if err != nil {
 		return
 	}
@@ -183,97 +407,56 @@ func (p *Parser) parseFunc() (n ast.Node, err error) {
 	}
 
 	name = tok.Raw
+	nameTok = tok
 
-	tok, err = p.lexer.Next()
+	tok, err = p.nextToken()
 	if err != nil {
 		return
 	}
-	if pn, ok := tok.Punct(); ok && pn == lexer.PType {
-		ret, err = p.parseType()
+	if pn, ok := tok.Punct(); ok && pn == lexer.PField {
+		recv, recvTok = name, nameTok
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if tok.Kind != lexer.TIdent {
+			err = tokErr(pe.EExpectedName, tok)
+			return
+		}
+		name, nameTok = tok.Raw, tok
+		tok, err = p.nextToken()
 		if err != nil {
 			return
 		}
-	} else {
-		p.lexer.Rollback(tok)
+	}
+	if pn, ok := tok.Punct(); ok && pn == lexer.PLBrack {
+		params, err = p.parseTypeParams()
+		if err != nil {
+			return
+		}
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+	}
+	p.rollback(tok)
+	ret, err = p.parseRet()
+	if err != nil {
+		return
 	}
 
 	for {
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
 
 		if pn, ok := tok.Punct(); ok {
 			switch pn {
-			case lexer.PIf:
-				n = ast.FuncExternNode{
-					Alias: name,
-					Proto: args,
-					Ret:   ret,
-					Name:  name,
-				}
-				return
-			case lexer.PLParen:
-				p.lexer.Rollback(tok)
-				p.Scope = &Scope{
-					Parent: p.Scope,
-					Vars:   make(map[string]ast.Node),
-					Consts: make(map[string]ast.Node),
-					Types:  make(map[string]types.Type),
-				}
-				for _, a := range args {
-					var falseVal, ok = p.NodeOf(a.Type)
-					if !ok {
-						err = tokErr(pe.EBadFuncArgType, tok)
-						return
-					}
-					p.Scope.Vars[a.Name] = falseVal
-				}
-				body, err = p.parseBlock()
-				if err != nil {
-					return
-				}
-				p.Scope = p.Scope.Parent
-				n = ast.FuncDefNode{
-					Name:  name,
-					Proto: args,
-					Ret:   ret,
-					Body:  body,
-				}
-				return
-			case lexer.PIs:
-				p.Scope = &Scope{
-					Parent: p.Scope,
-					Vars:   make(map[string]ast.Node),
-					Consts: make(map[string]ast.Node),
-					Types:  make(map[string]types.Type),
-				}
-				for _, a := range args {
-					var falseVal, ok = p.NodeOf(a.Type)
-					if !ok {
-						err = tokErr(pe.EBadFuncArgType, tok)
-						return
-					}
-					p.Scope.Vars[a.Name] = falseVal
-				}
-				tok, err = p.lexer.Next()
-				if err != nil {
-					return
-				}
-				// ensure that @ always means structure instatiation inside of a
-				// shorthand (struct definitions are not allowed in functions anyways)
-				if pn, ok := tok.Punct(); ok && pn == lexer.PStruct {
-					p.lexer.Rollback(tok)
-					shorthandBody, err = p.ParseValue()
-				} else {
-					shorthandBody, _, err = p.next(tok)
-				}
-				if err != nil {
-					return
-				}
-				p.Scope = p.Scope.Parent
-				n = ast.FuncShorthandNode{
-					Name:  name,
-					Proto: args,
-					Ret:   ret,
-					Body:  shorthandBody,
+			case lexer.PIf, lexer.PLParen, lexer.PIs:
+				end = tok
+				if recvTok != nil {
+					err = p.checkReceiver(recvTok, nameTok, args)
 				}
 				return
 			}
@@ -285,7 +468,7 @@ func (p *Parser) parseFunc() (n ast.Node, err error) {
 
 		argName = tok.Raw
 
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		if err != nil {
 			return
 		}
@@ -304,12 +487,50 @@ func (p *Parser) parseFunc() (n ast.Node, err error) {
 	}
 }
 
-// parseStruct parses a structure type definition.
+// checkReceiver ensures a method is defined on an existing structure, takes a
+// value of that structure as it's first argument and is not named after one of
+// the structure's fields.
+func (p *Parser) checkReceiver(recv, name *lexer.Token, args []types.Descriptor) error {
+	t, ok := p.Scope.FindType(recv.Raw)
+	if !ok {
+		return tokErr(pe.EUnknownType, recv)
+	}
+	s, ok := t.(types.StructType)
+	if !ok {
+		return tokErr(pe.EBadReceiver, recv)
+	}
+	if len(args) == 0 {
+		return tokErr(pe.EBadReceiver, name)
+	}
+	if at, ok := types.Unalias(args[0].Type).(types.StructType); !ok || at.Name != s.Name {
+		return tokErr(pe.EBadReceiver, name).Section("Receiver type", "%s", args[0].Type)
+	}
+	if _, ok := s.FieldType(name.Raw); ok {
+		return tokErr(pe.EMethodIsField, name)
+	}
+	return nil
+}
+
+// parseStruct parses a structure or tagged union type definition.
 //
 //	@Vec2i(x/int y/int)
+//
+// Generic structure definition:
+//
+//	@Box[T](Value/T)
+//
+// Tagged union definition, see [Parser.parseUnion]:
+//
+//	@Shape?(Circle/float Rect/Vec2f Empty)
+//	@Option[T]?(Some/T None)
+//
+// Type alias definition, see [Parser.parseAlias]:
+//
+//	@Lines: [str]
 func (p *Parser) parseStruct() (n ast.Node, err error) {
 	var (
 		name      string
+		params    []string
 		fieldName string
 		fieldType types.Type
 		fields    []types.Descriptor
@@ -317,7 +538,10 @@ func (p *Parser) parseStruct() (n ast.Node, err error) {
 		tok *lexer.Token
 	)
 
-	tok, err = p.lexer.Next()
+	outer := p.Scope
+	defer func() { p.Scope = outer }()
+
+	tok, err = p.nextToken()
 	if err != nil {
 		return
 	}
@@ -328,18 +552,41 @@ func (p *Parser) parseStruct() (n ast.Node, err error) {
 	}
 	name = tok.Raw
 
-	tok, err = p.lexer.Next()
+	tok, err = p.nextToken()
 	if err != nil {
 		return nil, err
 	}
 
+	if pn, ok := tok.Punct(); ok && pn == lexer.PLBrack {
+		params, err = p.parseTypeParams()
+		if err != nil {
+			return
+		}
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+	}
+
+	if pn, ok := tok.Punct(); ok && pn == lexer.PIf {
+		return p.parseUnion(outer, name, params)
+	}
+
+	if pn, ok := tok.Punct(); ok && pn == lexer.PIs {
+		if params != nil {
+			err = tokErr(pe.EUnexpectedToken, tok).Section("Reason", "Type aliases cannot have type parameters")
+			return
+		}
+		return p.parseAlias(outer, name)
+	}
+
 	if pn, ok := tok.Punct(); !ok || pn != lexer.PLParen {
 		err = tokErr(pe.EExpectedLParen, tok)
 		return
 	}
 
 	for {
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		if err != nil {
 			return
 		}
@@ -353,7 +600,7 @@ func (p *Parser) parseStruct() (n ast.Node, err error) {
 		}
 		fieldName = tok.Raw
 
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		if err != nil {
 			return
 		}
@@ -371,13 +618,33 @@ func (p *Parser) parseStruct() (n ast.Node, err error) {
 		fields = append(fields, types.Descriptor{Name: fieldName, Type: fieldType})
 	}
 
-	p.Scope.Types[name] = types.StructType{
+	outer.Types[name] = types.StructType{
 		Name:   name,
+		Params: params,
 		Fields: fields,
 	}
 	n = ast.StructDefNode{
 		Name:   name,
+		Params: params,
 		Fields: fields,
 	}
 	return
 }
+
+// parseAlias parses the aliased type of a type alias definition, after the
+// colon following its name. The alias is registered in the given scope.
+//
+//	@Offset: int
+//	        ^^^^
+func (p *Parser) parseAlias(scope *Scope, name string) (n ast.Node, err error) {
+	t, err := p.parseType()
+	if err != nil {
+		return
+	}
+	scope.Types[name] = types.AliasType{Name: name, Type: t}
+	n = ast.AliasDefNode{
+		Name: name,
+		Type: t,
+	}
+	return
+}
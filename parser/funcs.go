@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"errors"
+	"io"
+
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// funcType returns the type of the given function when it is used as a value.
+func funcType(f ast.Func) types.FuncType {
+	t := types.FuncType{
+		Args: make([]types.Type, len(f.Args)),
+		Ret:  f.Ret,
+	}
+	for i, a := range f.Args {
+		t.Args[i] = a.Type
+	}
+	return t
+}
+
+// argCount determines the amount of arguments taken by the function with the
+// given name. Functions take priority over builtins, which take priority over
+// variables holding a function.
+func (p *Parser) argCount(name *lexer.Token) (argc int, err error) {
+	if f, ok := p.Tree.Funcs[name.Raw]; ok {
+		return len(f.Args), nil
+	}
+	if bf, ok := builtins[name.Raw]; ok {
+		return bf.ArgCount, nil
+	}
+	if v, ok := p.Scope.FindVar(name.Raw); ok && v != nil {
+		if t, terr := p.TypeOf(v); terr == nil && t.Prim() == types.PFunc {
+			return len(types.Unalias(t).(types.FuncType).Args), nil
+		}
+	}
+	err = tokErr(pe.EUnknownFunction, name)
+	return
+}
+
+// parseMethodCall parses a call to a method if the given selector is followed
+// by an exclamation mark, otherwise the selector is returned as-is. The last
+// element of the selector names the method and the rest of it is the receiver,
+// whose structure type determines the method being called.
+//
+//	Reader#GetChar!
+//	       ^^^^^^^^
+func (p *Parser) parseMethodCall(start *lexer.Token, sel ast.Node) (n ast.Node, err error) {
+	n = sel
+	recv := ast.MetaNode{Where: p.span(start)}
+	tok, err := p.nextToken()
+	if errors.Is(err, io.EOF) {
+		return n, nil
+	}
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PExecute {
+		p.rollback(tok)
+		return
+	}
+
+	s, ok := sel.(ast.SelectorNode)
+	if !ok || s.Parent == nil {
+		err = tokErr(pe.EUnexpectedToken, tok)
+		return
+	}
+	recv.Node = s.Parent
+	t, terr := p.TypeOf(s.Parent)
+	st, ok := types.Unalias(t).(types.StructType)
+	if terr != nil || !ok {
+		err = tokErr(pe.EBadSelectorParent, tok).Section("Method", "%s", s.Child)
+		return
+	}
+	m, ok := p.Tree.Methods[st.Name][s.Child]
+	if !ok {
+		err = tokErr(pe.EUnknownMethod, tok).Section("Method", "%s", s.Child).Section("Receiver type", "%s", st)
+		return
+	}
+
+	args := make([]ast.MetaNode, len(m.Args)-1)
+	for i := range args {
+		args[i], err = p.ParseValue()
+		if err != nil {
+			return
+		}
+	}
+	n = ast.MethodCallNode{
+		Recv:   recv,
+		Type:   st.Name,
+		Method: s.Child,
+		Args:   args,
+	}
+	return
+}
+
+// parseFuncType parses the arguments and return type of a function type, after
+// the opening parenthesis. Function types without a return type do not return
+// anything.
+//
+//	fn(int int)/int
+//	   ^^^^^^^^^^^^
+func (p *Parser) parseFuncType() (t types.FuncType, err error) {
+	t.Args = []types.Type{}
+	for {
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			break
+		}
+		p.rollback(tok)
+		var a types.Type
+		a, err = p.parseType()
+		if err != nil {
+			return
+		}
+		t.Args = append(t.Args, a)
+	}
+	t.Ret, err = p.parseRet()
+	return
+}
+
+// parseRet parses an optional return type, returning [types.Nothing] if there
+// is none.
+func (p *Parser) parseRet() (ret types.Type, err error) {
+	tok, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); ok && pn == lexer.PType {
+		return p.parseType()
+	}
+	p.rollback(tok)
+	return types.Nothing, nil
+}
+
+// parseFuncRef parses a reference to a named function, after the dollar sign.
+// Generic functions cannot be referenced, as their type arguments could not be
+// determined.
+//
+//	$Add
+//	 ^^^
+func (p *Parser) parseFuncRef(name *lexer.Token) (n ast.Node, err error) {
+	f, ok := p.Tree.Funcs[name.Raw]
+	if !ok {
+		err = tokErr(pe.EUnknownFunction, name)
+		return
+	}
+	if len(f.Params) > 0 {
+		err = tokErr(pe.EGenericFuncRef, name)
+		return
+	}
+	n = ast.FuncRefNode{
+		Func: name.Raw,
+	}
+	return
+}
+
+// parseLambda parses an anonymous function, after the opening parenthesis of
+// its arguments. Like named functions, it can have a full body or a shorthand
+// body. The body can use the variables of the enclosing scope.
+//
+//	$(A/int B/int)/int(> add! A B)
+//	$(A/int B/int)/int: add! A B
+//	 ^^^^^^^^^^^^^^^^^^^^^^^^^^^
+func (p *Parser) parseLambda() (n ast.Node, err error) {
+	var (
+		args []types.Descriptor
+		ret  types.Type
+		body ast.Block
+		tok  *lexer.Token
+	)
+
+	outer := p.Scope
+	defer func() { p.Scope = outer }()
+	loops := p.loops
+	defer func() { p.loops = loops }()
+	p.loops = 0
+	p.funcs++
+	defer func() { p.funcs-- }()
+
+	for {
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			break
+		}
+		if tok.Kind != lexer.TIdent {
+			err = tokErr(pe.EExpectedName, tok)
+			return
+		}
+		name := tok.Raw
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); !ok || pn != lexer.PType {
+			err = tokErr(pe.EExpectedType, tok)
+			return
+		}
+		var t types.Type
+		t, err = p.parseType()
+		if err != nil {
+			return
+		}
+		args = append(args, types.Descriptor{Name: name, Type: t})
+	}
+
+	ret, err = p.parseRet()
+	if err != nil {
+		return
+	}
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+
+	p.Scope = NewScope(outer)
+	for _, a := range args {
+		falseVal, ok := p.NodeOf(a.Type)
+		if !ok {
+			err = tokErr(pe.EBadFuncArgType, tok)
+			return
+		}
+		p.Scope.Vars[a.Name] = falseVal
+	}
+
+	switch pn, _ := tok.Punct(); pn {
+	case lexer.PLParen:
+		p.rollback(tok)
+		body, err = p.parseBlock()
+		if err != nil {
+			return
+		}
+	case lexer.PIs:
+		var v ast.MetaNode
+		v, err = p.ParseValue()
+		if err != nil {
+			return
+		}
+		body = ast.Block{v}
+		if ret.Prim() != types.PNothing {
+			body[0].Node = ast.ReturnNode{Value: v}
+		}
+	default:
+		err = tokErr(pe.EExpectedLParen, tok)
+		return
+	}
+
+	n = ast.LambdaNode{
+		Proto: args,
+		Ret:   ret,
+		Body:  body,
+	}
+	return
+}
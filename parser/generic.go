@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// parseTypeParams parses the type parameters of a generic function or
+// structure definition, after the opening bracket. A new scope is entered, in
+// which the parameters can be used as types. The caller is responsible for
+// leaving it.
+//
+//	$First[T]/T Arr/[T]
+//	@Box[T](Value/T)
+//	      ^^
+func (p *Parser) parseTypeParams() (params []string, err error) {
+	scope := NewScope(p.Scope)
+	for {
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRBrack {
+			break
+		}
+		if tok.Kind != lexer.TIdent {
+			err = tokErr(pe.EExpectedName, tok)
+			return
+		}
+		params = append(params, tok.Raw)
+		scope.Types[tok.Raw] = types.ParamType{Name: tok.Raw}
+	}
+	if len(params) == 0 {
+		err = pe.New(pe.EExpectedName).Section("Reason", "Type parameter lists cannot be empty")
+		return
+	}
+	p.Scope = scope
+	return
+}
+
+// parseTypeArgs parses the type arguments of a generic structure or union, after
+// the opening bracket. The amount of arguments must match the given type
+// parameters.
+//
+//	Box[int]
+//	    ^^^^
+func (p *Parser) parseTypeArgs(params []string, name *lexer.Token) (args []types.Type, err error) {
+	for {
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRBrack {
+			break
+		}
+		p.rollback(tok)
+		var t types.Type
+		t, err = p.parseType()
+		if err != nil {
+			return
+		}
+		args = append(args, t)
+	}
+	if len(args) != len(params) {
+		err = typeArgCount(name, len(params), len(args))
+	}
+	return
+}
+
+// inferStruct determines the type arguments of a generic structure from the
+// values given to its fields. If the type of some values cannot be determined
+// by the parser, e.g. because they are results of builtin functions, the
+// structure is left generic and the type arguments are inferred by the
+// typechecker instead.
+func (p *Parser) inferStruct(s types.StructType, values []ast.MetaNode, name *lexer.Token) (inst types.StructType, err error) {
+	bound := make(map[string]types.Type)
+	for i, f := range s.Fields {
+		t, terr := p.TypeOf(values[i].Node)
+		if terr != nil || isUninferred(t) {
+			// the value's type is unknown, so the other fields have to be enough
+			continue
+		}
+		if !types.Infer(f.Type, t, bound) {
+			err = nodeErr(pe.ECannotInferType, values[i]).
+				Section("Field", "%s of %s", f.Name, s)
+			return
+		}
+	}
+	args := make([]types.Type, len(s.Params))
+	for i, param := range s.Params {
+		t, ok := bound[param]
+		if !ok {
+			return s, nil
+		}
+		args[i] = t
+	}
+	inst = types.Instantiate(s, args)
+	return
+}
+
+// isUninferred checks if the given type is a generic structure or union whose
+// type arguments the parser could not infer. The typechecker infers these
+// later, so they cannot be used to infer an enclosing literal's type arguments.
+func isUninferred(t types.Type) bool {
+	switch t := types.Unalias(t).(type) {
+	case types.StructType:
+		return t.IsGeneric()
+	case types.UnionType:
+		return t.IsGeneric()
+	}
+	return false
+}
+
+// instantiateCall determines the return type of a call to a generic function
+// from the types of the arguments. Any type parameters that cannot be inferred
+// are kept in the returned type.
+func (p *Parser) instantiateCall(f ast.Func, args []ast.MetaNode) types.Type {
+	bound := make(map[string]types.Type)
+	for i, a := range args {
+		if i >= len(f.Args) {
+			break
+		}
+		if t, err := p.TypeOf(a.Node); err == nil {
+			types.Infer(f.Args[i].Type, t, bound)
+		}
+	}
+	return types.Subst(f.Ret, bound)
+}
+
+func typeArgCount(cause *lexer.Token, want, got int) *pe.PrettyError {
+	return tokErr(pe.ETypeArgCount, cause).Section("Details", "Wanted %d type arguments, got %d", want, got)
+}
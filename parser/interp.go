@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+)
+
+// parseInterp parses an interpolated string literal, starting with the segment
+// before the first embedded value. The lexer returns the text following every
+// embedded value as another segment, up to the next embedded value or the end
+// of the string.
+//
+//	"Hello \{Name}, you are \{Age}!"
+func (p *Parser) parseInterp(head *lexer.Token) (n ast.Node, err error) {
+	in := ast.InterpNode{
+		Parts: []string{head.Raw},
+	}
+	for {
+		var v ast.MetaNode
+		v, err = p.ParseValue()
+		if err != nil {
+			return
+		}
+		in.Values = append(in.Values, v)
+
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if tok.Kind != lexer.TStringMid && tok.Kind != lexer.TStringTail {
+			// only one value can be embedded at a time
+			err = tokErr(pe.EExpectedRBrace, tok)
+			return
+		}
+		in.Parts = append(in.Parts, tok.Raw)
+		if tok.Kind == lexer.TStringTail {
+			break
+		}
+	}
+	n = in
+	return
+}
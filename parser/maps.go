@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// parseMapType parses the key and value types of a map type, after the opening
+// brace.
+//
+//	{str:int}
+//	 ^^^^^^^^
+func (p *Parser) parseMapType() (t types.MapType, err error) {
+	start, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	p.rollback(start)
+	t.Key, err = p.parseType()
+	if err != nil {
+		return
+	}
+	if !types.IsKey(t.Key) {
+		err = tokErr(pe.EBadMapKey, start).Section("Key type", "%s", t.Key)
+		return
+	}
+	tok, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PIs {
+		err = tokErr(pe.EExpectedColon, tok)
+		return
+	}
+	t.Value, err = p.parseType()
+	if err != nil {
+		return
+	}
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PRBrace {
+		err = tokErr(pe.EExpectedRBrace, tok)
+	}
+	return
+}
+
+// parseMap parses a map literal, after the opening brace. Like with arrays, the
+// type may be left out if the map is not empty, in which case it is determined
+// from the first key and value.
+//
+//	{str:int}("one": 1 "two": 2)
+//	{}('a': "A")
+//	{int:str}()
+func (p *Parser) parseMap(begin *lexer.Token) (n ast.Node, err error) {
+	var (
+		out   ast.MapNode
+		known bool
+		tok   *lexer.Token
+	)
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PRBrace {
+		p.rollback(tok)
+		out.Type, err = p.parseMapType()
+		if err != nil {
+			return
+		}
+		known = true
+	}
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PLParen {
+		err = tokErr(pe.EExpectedLParen, tok)
+		return
+	}
+
+	out.Keys = []ast.MetaNode{}
+	out.Values = []ast.MetaNode{}
+	for {
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			break
+		}
+		p.rollback(tok)
+
+		var k, v ast.MetaNode
+		k, err = p.ParseValue()
+		if err != nil {
+			return
+		}
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); !ok || pn != lexer.PIs {
+			err = tokErr(pe.EExpectedColon, tok)
+			return
+		}
+		v, err = p.ParseValue()
+		if err != nil {
+			return
+		}
+
+		if !known {
+			out.Type.Key, err = p.TypeOf(k.Node)
+			if err != nil {
+				return
+			}
+			if !types.IsKey(out.Type.Key) {
+				err = nodeErr(pe.EBadMapKey, k).Section("Key type", "%s", out.Type.Key)
+				return
+			}
+			out.Type.Value, err = p.TypeOf(v.Node)
+			if err != nil {
+				return
+			}
+			known = true
+		}
+		out.Keys = append(out.Keys, k)
+		out.Values = append(out.Values, v)
+	}
+
+	if !known {
+		err = tokErr(pe.ENeedTypeOrValue, begin)
+		return
+	}
+	n = out
+	return
+}
@@ -16,30 +16,90 @@ import (
 // them.
 type Parser struct {
 	lexer  *lexer.Lexer
+	src    io.RuneScanner
+	file   string
+	lexErr int
 	errs   chan error
 	Tree   ast.AST
 	Engine string
 	Scope  *Scope
+	// MaxErrors is the amount of errors reported before the parser gives up, or
+	// 0 to never give up. Defaults to [DefaultMaxErrors].
+	MaxErrors int
+
+	// depth is the amount of currently open parentheses
+	depth int
+	// loops is the amount of loops enclosing the current statement, within the
+	// current function
+	loops int
+	// funcs is the amount of functions enclosing the current statement,
+	// including anonymous functions
+	funcs    int
+	errCount int
+	gaveUp   bool
 }
 
 // NewParser creates a new parser for the given engine, creating a [Lexer] with
 // the given input stream.
 func NewParser(fn string, src io.RuneScanner, eng string, errOut chan error) *Parser {
+	scope := NewScope(nil)
+	// the built-in Result structure can be shadowed like any other type
+	scope.Types[types.ResultStruct.Name] = types.ResultStruct
 	return &Parser{
-		lexer:  lexer.NewLexer(src, fn),
-		errs:   errOut,
-		Tree:   ast.NewAST(),
-		Engine: eng,
-		Scope:  NewScope(nil),
+		lexer:     lexer.NewLexer(src, fn),
+		src:       src,
+		file:      fn,
+		errs:      errOut,
+		Tree:      ast.NewAST(),
+		Engine:    eng,
+		Scope:     scope,
+		MaxErrors: DefaultMaxErrors,
 	}
 }
 
+// nextToken returns the next token from the lexer, reporting any errors the
+// lexer recovered from in the process. Tokens of invalid input are skipped, as
+// the lexer has already reported them. After the parser gives up, this always
+// returns an end of input error.
+func (p *Parser) nextToken() (tok *lexer.Token, err error) {
+	for {
+		if p.gaveUp {
+			err = pe.New(pe.EBadInput).Cause(io.EOF)
+			return
+		}
+		tok, err = p.lexer.Next()
+		for _, lerr := range p.lexer.Err[p.lexErr:] {
+			p.report(lerr)
+		}
+		p.lexErr = len(p.lexer.Err)
+		if err != nil || tok.Kind != lexer.TError {
+			break
+		}
+	}
+	if err == nil {
+		if pn, ok := tok.Punct(); ok {
+			switch pn {
+			case lexer.PLParen:
+				p.depth++
+			case lexer.PRParen:
+				p.depth--
+			}
+		}
+	}
+	return
+}
+
 // Parse constructs nodes using the internal lexer's tokens and compiles them
-// into an [ast.AST].
+// into an [ast.AST]. After an error, the parser skips to the next top-level
+// statement, so the returned AST contains everything that could be parsed.
+// Statements of function bodies that could not be parsed are replaced with an
+// [ast.BadNode]. Functions and structures may be used before they are defined,
+// see [Parser.collectPrototypes].
 func (p *Parser) Parse() ast.AST {
 	var (
 		n    ast.MetaNode
 		skip bool
+		root = p.Scope
 	)
 
 	p.Tree = ast.AST{
@@ -48,15 +108,23 @@ func (p *Parser) Parse() ast.AST {
 		Funcs:    make(map[string]ast.Func),
 		Exerns:   make(map[string]ast.Extern),
 		Structs:  make(map[string]ast.Structure),
+		Unions:   make(map[string]ast.Union),
+		Methods:  make(map[string]map[string]ast.Func),
+		Aliases:  make(map[string]ast.Alias),
+	}
+
+	if err := p.collectPrototypes(); err != nil {
+		p.report(err)
+		return p.Tree
 	}
 
 	for {
-		tok, err := p.lexer.Next()
+		tok, err := p.nextToken()
 		if errors.Is(err, io.EOF) {
 			break
 		}
 		if err != nil {
-			p.errs <- err
+			p.report(err)
 			continue
 		}
 
@@ -65,14 +133,17 @@ func (p *Parser) Parse() ast.AST {
 			continue
 		}
 		if err != nil {
-			debug.Log(debug.AttrParser, "Error %s", err)
-		} else {
-			debug.Log(debug.AttrParser, "%s node at %s", n.Node.Kind(), n.Where)
-		}
-		if err != nil {
-			p.errs <- err
+			if p.gaveUp {
+				break
+			}
+			p.report(err)
+			p.Scope = root
+			if err = p.syncTopLevel(); err != nil {
+				break
+			}
 			continue
 		}
+		debug.Log(debug.AttrParser, "%s node at %s", n.Node.Kind(), n.Where)
 
 		switch n.Node.Kind() {
 		case ast.NVarSet:
@@ -99,30 +170,26 @@ func (p *Parser) Parse() ast.AST {
 			}
 		case ast.NFuncDef:
 			nfd := n.Node.(ast.FuncDefNode)
-			p.Tree.Funcs[nfd.Name] = ast.Func{
-				Name: nfd.Name,
-				Args: nfd.Proto,
-				Ret:  nfd.Ret,
-				Body: nfd.Body,
-				Node: n,
-			}
-			delete(p.Tree.Exerns, nfd.Name)
+			p.defineFunc(ast.Func{
+				Name:   nfd.Name,
+				Recv:   nfd.Recv,
+				Params: nfd.Params,
+				Args:   nfd.Proto,
+				Ret:    nfd.Ret,
+				Body:   nfd.Body,
+				Node:   n,
+			})
 		case ast.NFuncShorthand:
 			nfs := n.Node.(ast.FuncShorthandNode)
-			body := ast.Block{{Where: nfs.Body.Where}}
-			if nfs.Body.Node.Kind().IsValue() {
-				body[0].Node = ast.ReturnNode{Value: nfs.Body}
-			} else {
-				body[0].Node = nfs.Body.Node
-			}
-			p.Tree.Funcs[nfs.Name] = ast.Func{
-				Name: nfs.Name,
-				Args: nfs.Proto,
-				Ret:  nfs.Ret,
-				Body: body,
-				Node: n,
-			}
-			delete(p.Tree.Exerns, nfs.Name)
+			p.defineFunc(ast.Func{
+				Name:   nfs.Name,
+				Recv:   nfs.Recv,
+				Params: nfs.Params,
+				Args:   nfs.Proto,
+				Ret:    nfs.Ret,
+				Body:   shorthandBlock(nfs.Body),
+				Node:   n,
+			})
 		case ast.NFuncExtern:
 			nfe := n.Node.(ast.FuncExternNode)
 			p.Tree.Exerns[nfe.Alias] = ast.Extern{
@@ -136,11 +203,27 @@ func (p *Parser) Parse() ast.AST {
 			nsd := n.Node.(ast.StructDefNode)
 			p.Tree.Structs[nsd.Name] = ast.Structure{
 				Name:   nsd.Name,
+				Params: nsd.Params,
 				Fields: nsd.Fields,
 				Node:   n,
 			}
+		case ast.NUnionDef:
+			nud := n.Node.(ast.UnionDefNode)
+			p.Tree.Unions[nud.Name] = ast.Union{
+				Name:     nud.Name,
+				Params:   nud.Params,
+				Variants: nud.Variants,
+				Node:     n,
+			}
+		case ast.NAliasDef:
+			nad := n.Node.(ast.AliasDefNode)
+			p.Tree.Aliases[nad.Name] = ast.Alias{
+				Name: nad.Name,
+				Type: nad.Type,
+				Node: n,
+			}
 		default:
-			p.errs <- nodeErr(pe.EIllegalTopLevelNode, n)
+			p.report(nodeErr(pe.EIllegalTopLevelNode, n))
 			continue
 		}
 	}
@@ -148,14 +231,40 @@ func (p *Parser) Parse() ast.AST {
 	return p.Tree
 }
 
+// shorthandBlock turns the body of a function shorthand into a full body. A
+// value is returned from the function, anything else is kept as-is.
+func shorthandBlock(body ast.MetaNode) ast.Block {
+	block := ast.Block{{Where: body.Where}}
+	if body.Node.Kind().IsValue() {
+		block[0].Node = ast.ReturnNode{Value: body}
+	} else {
+		block[0].Node = body.Node
+	}
+	return block
+}
+
+// defineFunc registers the given function in the tree, or in the method set of
+// it's structure if it is a method.
+func (p *Parser) defineFunc(f ast.Func) {
+	if f.Recv == "" {
+		p.Tree.Funcs[f.Name] = f
+		delete(p.Tree.Exerns, f.Name)
+		return
+	}
+	if p.Tree.Methods[f.Recv] == nil {
+		p.Tree.Methods[f.Recv] = make(map[string]ast.Func)
+	}
+	p.Tree.Methods[f.Recv][f.Name] = f
+}
+
 // TopLevel parses a top-level statement. One of:
 //   - Function/Extern definition
 //   - Variable defintion and/or assignment
 //   - Structure type definition
 func (p *Parser) TopLevel() (mn ast.MetaNode) {
-	tok, err := p.lexer.Next()
+	tok, err := p.nextToken()
 	if err != nil {
-		p.errs <- err
+		p.report(err)
 		return
 	}
 
@@ -163,7 +272,7 @@ func (p *Parser) TopLevel() (mn ast.MetaNode) {
 	for {
 		mn, skip, err = p.next(tok)
 		if err != nil {
-			p.errs <- err
+			p.report(err)
 			return
 		}
 		if !skip {
@@ -203,40 +312,49 @@ func (p *Parser) next(tok *lexer.Token) (mn ast.MetaNode, skip bool, err error)
 				return
 			}
 			skip = true
+		case lexer.PTry:
+			// a propagated result can only be a statement if it is a call
+			n, err = p.parseTry()
+			if err == nil {
+				if k := n.(ast.TryNode).Value.Node.Kind(); k != ast.NFuncCall && k != ast.NMethodCall {
+					err = tokErr(pe.EUnexpectedToken, tok)
+				}
+			}
 		default:
 			err = tokErr(pe.EUnexpectedToken, tok)
 		}
 	case lexer.TIdent:
 		var maybeBang *lexer.Token
-		maybeBang, err = p.lexer.Next()
+		maybeBang, err = p.nextToken()
 		if err != nil {
 			return
 		}
+		// a selector can only be a statement if it ends with a method call
+		if pn, ok := maybeBang.Punct(); ok && pn == lexer.PField {
+			p.rollback(maybeBang)
+			n, err = p.value(tok)
+			if err == nil && n.Kind() != ast.NMethodCall {
+				err = tokErr(pe.EUnexpectedToken, tok)
+			}
+			break
+		}
 		if pn, ok := maybeBang.Punct(); !ok || pn != lexer.PExecute {
-			p.lexer.Rollback(maybeBang)
+			p.rollback(maybeBang)
 			err = tokErr(pe.EUnexpectedToken, tok)
 			return
 		}
-		fnm := tok.Raw
 		var argc int
-		f, ok := p.Tree.Funcs[fnm]
-		if !ok {
-			bf, ok := builtins[fnm]
-			if !ok {
-				err = tokErr(pe.EUnknownFunction, tok)
-				return
-			}
-			argc = bf.ArgCount
-		} else {
-			argc = len(f.Args)
+		argc, err = p.argCount(tok)
+		if err != nil {
+			return
 		}
-		n, err = p.parseCall(fnm, argc, tok.Where)
+		n, err = p.parseCall(tok.Raw, argc, tok.Where)
 	default:
 		err = tokErr(pe.EUnexpectedToken, tok)
 	}
 
 	mn.Node = n
-	mn.Where = tok.Where
+	mn.Where = p.span(tok)
 
 	return
 }
@@ -245,7 +363,7 @@ func (p *Parser) next(tok *lexer.Token) (mn ast.MetaNode, skip bool, err error)
 // count be known before the call can be parsed.
 //
 //	print! concat! "Hello " World
-func (p *Parser) parseCall(fn string, argc int, pos lexer.Position) (n ast.Node, err error) {
+func (p *Parser) parseCall(fn string, argc int, pos lexer.Span) (n ast.Node, err error) {
 	args := make([]ast.MetaNode, argc)
 	for i := 0; i < len(args); i++ {
 		v, err := p.ParseValue()
@@ -294,7 +412,7 @@ func (p *Parser) parseSelector(start *lexer.Token) (n ast.Node, err error) {
 	var tok *lexer.Token
 	for {
 		// first, consume the #
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		// the selector *could* be the last thing in a file, so we just return
 		// on EOF
 		if errors.Is(err, io.EOF) {
@@ -309,12 +427,12 @@ func (p *Parser) parseSelector(start *lexer.Token) (n ast.Node, err error) {
 		// we have just consumed an element of the selector, so if we don't have
 		// another # that means that is the end of the selector
 		if pn, ok := tok.Punct(); !ok || pn != lexer.PField {
-			p.lexer.Rollback(tok)
+			p.rollback(tok)
 			return
 		}
 
 		// now, we consume the actual selector element
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		if err != nil {
 			return
 		}
@@ -362,7 +480,7 @@ func (p *Parser) parseSelector(start *lexer.Token) (n ast.Node, err error) {
 				}
 			case lexer.PLBrack:
 				// get the token starting the index
-				tok, err = p.lexer.Next()
+				tok, err = p.nextToken()
 				if err != nil {
 					return
 				}
@@ -375,7 +493,7 @@ func (p *Parser) parseSelector(start *lexer.Token) (n ast.Node, err error) {
 				}
 
 				// get the closing bracket
-				tok, err = p.lexer.Next()
+				tok, err = p.nextToken()
 				if err != nil {
 					return
 				}
@@ -428,7 +546,7 @@ func (p *Parser) parseBlock() (block ast.Block, err error) {
 		tok  *lexer.Token
 	)
 
-	tok, err = p.lexer.Next()
+	tok, err = p.nextToken()
 	if err != nil {
 		return
 	}
@@ -437,9 +555,10 @@ func (p *Parser) parseBlock() (block ast.Block, err error) {
 		err = tokErr(pe.EExpectedLParen, tok)
 		return
 	}
+	depth := p.depth
 
 	for {
-		tok, err = p.lexer.Next()
+		tok, err = p.nextToken()
 		if err != nil {
 			return
 		}
@@ -450,7 +569,22 @@ func (p *Parser) parseBlock() (block ast.Block, err error) {
 
 		n, skip, err = p.next(tok)
 		if err != nil {
-			return
+			if p.fatal(err) {
+				return
+			}
+			// report the error and replace the broken statement with a
+			// placeholder, so the rest of the block can still be parsed
+			p.report(err)
+			var closed bool
+			n, closed, err = p.syncBlock(tok, depth)
+			if err != nil {
+				return
+			}
+			block = append(block, n)
+			if closed {
+				break
+			}
+			continue
 		}
 		if skip {
 			continue
@@ -462,6 +596,15 @@ func (p *Parser) parseBlock() (block ast.Block, err error) {
 	return
 }
 
+// span returns the span of source code from the start of the given token to the
+// end of the last consumed token.
+func (p *Parser) span(start *lexer.Token) lexer.Span {
+	return lexer.Span{
+		Start: start.Where.Start,
+		End:   p.lexer.End(),
+	}
+}
+
 func tokErr(c pe.ErrorCode, cause *lexer.Token) *pe.PrettyError {
 	return pe.New(c).Section("Caused by", "%s \"%s\" at %s", cause.Kind, cause.Raw, cause.Where)
 }
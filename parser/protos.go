@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+)
+
+// collectPrototypes reads the rest of the input and registers every top-level
+// structure type and function prototype in it before anything else is parsed,
+// so that functions can be called before they are defined and may call each
+// other. The parser then continues with a fresh lexer over the same input.
+//
+// Only statements starting at the beginning of a line and outside of any
+// parentheses are considered top-level. Errors are ignored here, as they are
+// reported once the input is actually parsed.
+func (p *Parser) collectPrototypes() error {
+	var code strings.Builder
+	for {
+		c, _, err := p.src.ReadRune()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return pe.New(pe.EBadInput).Cause(err)
+		}
+		code.WriteRune(c)
+	}
+
+	p.lexer = lexer.NewLexer(strings.NewReader(code.String()), p.file)
+	p.lexErr = 0
+
+	// structures first, as function prototypes may refer to them
+	p.prescan(code.String(), lexer.PStruct)
+	p.prescan(code.String(), lexer.PFunc)
+	return nil
+}
+
+// prescan looks for top-level statements starting with the given punctuator,
+// which is either [lexer.PStruct] or [lexer.PFunc], and registers the types or
+// function prototypes they define.
+func (p *Parser) prescan(code string, kind lexer.Punct) {
+	pre := &Parser{
+		lexer:  lexer.NewLexer(strings.NewReader(code), p.file),
+		Tree:   p.Tree,
+		Engine: p.Engine,
+		Scope:  p.Scope,
+	}
+
+	for {
+		tok, err := pre.nextToken()
+		if err != nil {
+			return
+		}
+		if pre.depth < 0 {
+			pre.depth = 0
+		}
+		if pre.depth > 0 || tok.Where.Start.Col != 1 {
+			continue
+		}
+		if pn, ok := tok.Punct(); !ok || pn != kind {
+			continue
+		}
+
+		switch kind {
+		case lexer.PStruct:
+			// this also registers the type in the scope
+			pre.parseStruct()
+		case lexer.PFunc:
+			name, recv, params, ret, args, end, err := pre.parsePrototype()
+			pre.Scope = p.Scope
+			if err != nil {
+				continue
+			}
+			if pn, _ := end.Punct(); pn == lexer.PIf {
+				// externs are not callable
+				continue
+			}
+			p.defineFunc(ast.Func{
+				Name:   name,
+				Recv:   recv,
+				Params: params,
+				Args:   args,
+				Ret:    ret,
+			})
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"errors"
+	"io"
+
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/debug"
+	"github.com/syzkrash/skol/lexer"
+)
+
+// DefaultMaxErrors is the amount of errors a [Parser] reports before giving up,
+// unless changed with [Parser.MaxErrors].
+const DefaultMaxErrors = 50
+
+// report sends the given error to the error channel, if there is one. Once
+// [Parser.MaxErrors] errors have been reported, the parser gives up: a final
+// error is reported and the parser acts as if it had reached the end of input.
+func (p *Parser) report(err error) {
+	if p.gaveUp || p.errs == nil {
+		return
+	}
+	debug.Log(debug.AttrParser, "Error %s", err)
+	p.errs <- err
+	p.errCount++
+	if p.MaxErrors > 0 && p.errCount >= p.MaxErrors {
+		p.gaveUp = true
+		p.errs <- pe.New(pe.ETooManyErrors).Section("Limit", "%d errors", p.MaxErrors)
+	}
+}
+
+// rollback rolls the given token back into the lexer, keeping track of the
+// parenthesis depth.
+func (p *Parser) rollback(tok *lexer.Token) {
+	if pn, ok := tok.Punct(); ok {
+		switch pn {
+		case lexer.PLParen:
+			p.depth--
+		case lexer.PRParen:
+			p.depth++
+		}
+	}
+	p.lexer.Rollback(tok)
+}
+
+// fatal checks if parsing cannot continue after the given error, which is the
+// case at the end of input or after giving up.
+func (p *Parser) fatal(err error) bool {
+	return p.gaveUp || errors.Is(err, io.EOF)
+}
+
+// syncTopLevel skips tokens after an error in a top-level statement, until a
+// token that may start a new top-level statement: a `$`, `%`, `@` or `#` at
+// the start of a line which is not inside any parentheses.
+func (p *Parser) syncTopLevel() (err error) {
+	for {
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if p.depth > 0 || tok.Where.Start.Col != 1 {
+			continue
+		}
+		if pn, ok := tok.Punct(); ok {
+			switch pn {
+			case lexer.PFunc, lexer.PVar, lexer.PStruct, lexer.PField:
+				p.rollback(tok)
+				p.depth = 0
+				return
+			}
+		}
+	}
+}
+
+// syncBlock skips tokens after an error in a statement of a block, until the
+// first token on a new line that is directly within the block, or the end of
+// the block. The skipped code is returned as an [ast.BadNode]. The depth is the
+// parenthesis depth directly within the block.
+func (p *Parser) syncBlock(start *lexer.Token, depth int) (mn ast.MetaNode, closed bool, err error) {
+	mn.Node = ast.BadNode{}
+	if p.depth < depth {
+		// the broken statement already consumed the end of the block
+		mn.Where = p.span(start)
+		closed = true
+		return
+	}
+	for {
+		end := p.lexer.End()
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if p.depth < depth {
+			// this was the closing parenthesis of the block, which is not part of
+			// the broken statement
+			p.rollback(tok)
+			mn.Where = p.span(start)
+			p.nextToken()
+			closed = true
+			return
+		}
+		if p.depth == depth && tok.Where.Start.Line > end.Line {
+			p.rollback(tok)
+			mn.Where = p.span(start)
+			return
+		}
+	}
+}
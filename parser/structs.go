@@ -0,0 +1,196 @@
+package parser
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// parseNamedStruct parses a structure literal with named fields, after the
+// opening parenthesis. Fields may be given in any order, and omitted fields are
+// set to their zero value. The type arguments of a generic structure are
+// inferred from the fields, unless they were given explicitly.
+//
+//	@Reader(RowSep: '\n' Off: 0)
+//	        ^^^^^^^^^^^^^^^^^^^^
+func (p *Parser) parseNamedStruct(s types.StructType, name *lexer.Token, explicit bool) (n ast.Node, err error) {
+	fields, values, err := p.parseFields(s)
+	if err != nil {
+		return
+	}
+	given := make(map[string]ast.MetaNode, len(fields))
+	for i, f := range fields {
+		given[f] = values[i]
+	}
+
+	args := make([]ast.MetaNode, len(s.Fields))
+	for i, f := range s.Fields {
+		if v, ok := given[f.Name]; ok {
+			args[i] = v
+			continue
+		}
+		args[i].Where = name.Where
+		var ok bool
+		if args[i].Node, ok = p.zeroValue(f.Type); !ok {
+			err = tokErr(pe.ENoZeroValue, name).Section("Field", "%s of %s", f.Name, f.Type)
+			return
+		}
+	}
+
+	if s.IsGeneric() && !explicit {
+		s, err = p.inferStruct(s, args, name)
+		if err != nil {
+			return
+		}
+	}
+	n = ast.StructNode{
+		Type: s,
+		Args: args,
+	}
+	return
+}
+
+// isUpdate checks whether the given first value of a positional structure
+// literal is followed by the changed fields of a structure update, consuming the
+// opening parenthesis if it is. If the type of the value is known, it must be
+// the structure's type, as the parenthesis could start a block or a tuple
+// instead. For a structure with a single field, the type has to be known.
+//
+//	@Reader R (Off: 0)
+//	          ^
+func (p *Parser) isUpdate(s types.StructType, first ast.MetaNode) bool {
+	tok, err := p.nextToken()
+	if err != nil {
+		return false
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PLParen {
+		p.rollback(tok)
+		return false
+	}
+	if t, err := p.TypeOf(first.Node); err == nil {
+		if types.Infer(s, t, map[string]types.Type{}) {
+			return true
+		}
+	} else if len(s.Fields) > 1 {
+		return true
+	}
+	p.rollback(tok)
+	return false
+}
+
+// parseStructUpdate parses the changed fields of a structure update, after the
+// opening parenthesis. The update copies the base value, changing only the
+// given fields. A generic structure takes its type arguments from the base
+// value.
+//
+//	@Reader R (Off: add! R#Off 1)
+//	           ^^^^^^^^^^^^^^^^^^
+func (p *Parser) parseStructUpdate(s types.StructType, base ast.MetaNode) (n ast.Node, err error) {
+	fields, values, err := p.parseFields(s)
+	if err != nil {
+		return
+	}
+	if s.IsGeneric() {
+		if t, terr := p.TypeOf(base.Node); terr == nil {
+			if bs, ok := types.Unalias(t).(types.StructType); ok && bs.Name == s.Name {
+				s = bs
+			}
+		}
+	}
+	n = ast.StructUpdateNode{
+		Type:   s,
+		Base:   base,
+		Fields: fields,
+		Values: values,
+	}
+	return
+}
+
+// parseFields parses field names and their values up to and including the
+// closing parenthesis. Every field must belong to the given structure and may
+// only be given once.
+//
+//	@Vec(x: 1 y: 2)
+//	     ^^^^^^^^^^
+func (p *Parser) parseFields(s types.StructType) (fields []string, values []ast.MetaNode, err error) {
+	seen := make(map[string]bool)
+	for {
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			return
+		}
+		if tok.Kind != lexer.TIdent {
+			err = tokErr(pe.EExpectedName, tok)
+			return
+		}
+		if _, ok := s.FieldType(tok.Raw); !ok {
+			err = tokErr(pe.EUnknownField, tok).Section("Structure", "%s", s)
+			return
+		}
+		if seen[tok.Raw] {
+			err = tokErr(pe.EDuplicateField, tok)
+			return
+		}
+		seen[tok.Raw] = true
+		fields = append(fields, tok.Raw)
+
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); !ok || pn != lexer.PIs {
+			err = tokErr(pe.EExpectedColon, tok)
+			return
+		}
+
+		var v ast.MetaNode
+		v, err = p.ParseValue()
+		if err != nil {
+			return
+		}
+		values = append(values, v)
+	}
+}
+
+// zeroValue creates the zero value of the given type, which omitted fields of a
+// structure literal are set to. Unlike the nodes created by [Parser.NodeOf],
+// these can be used like any parsed node. Functions, unions and type parameters
+// have no zero value.
+func (p *Parser) zeroValue(t types.Type) (n ast.Node, ok bool) {
+	n, ok = p.NodeOf(t)
+	if !ok {
+		return
+	}
+	switch z := n.(type) {
+	case ast.StructNode:
+		z.Args = make([]ast.MetaNode, len(z.Type.Fields))
+		for i, f := range z.Type.Fields {
+			if z.Args[i].Node, ok = p.zeroValue(f.Type); !ok {
+				return
+			}
+		}
+		n = z
+	case ast.TupleNode:
+		for i, e := range types.Unalias(t).(types.TupleType).Elems {
+			if z.Elems[i].Node, ok = p.zeroValue(e); !ok {
+				return
+			}
+		}
+		n = z
+	case ast.ArrayNode:
+		z.Elems = []ast.MetaNode{}
+		n = z
+	case ast.MapNode:
+		z.Keys = []ast.MetaNode{}
+		z.Values = []ast.MetaNode{}
+		n = z
+	case ast.VariantNode, ast.TypecastNode:
+		ok = false
+	}
+	return
+}
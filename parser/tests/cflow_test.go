@@ -329,3 +329,141 @@ func TestWhile(t *testing.T) {
 		}},
 	})
 }
+
+func TestMatch(t *testing.T) {
+	p, src := makeParser(t, "Match")
+
+	vec := types.StructType{
+		Name: "Vec",
+		Fields: []types.Descriptor{
+			{Name: "X", Type: types.Int},
+			{Name: "Y", Type: types.Int},
+		},
+	}
+	shape := types.UnionType{
+		Name: "Shape",
+		Variants: []types.Descriptor{
+			{Name: "Circle", Type: types.Float},
+			{Name: "Square", Type: vec},
+			{Name: "Empty", Type: types.Nothing},
+		},
+	}
+	p.Scope.Types["Vec"] = vec
+	p.Scope.Types["Shape"] = shape
+	p.Scope.Vars["c"] = ast.CharNode{}
+	p.Scope.Vars["v"] = ast.StructNode{Type: vec}
+	p.Scope.Vars["s"] = ast.VariantNode{Type: shape}
+	p.Scope.Consts["Zero"] = ast.IntNode{Value: 0}
+
+	ret := func(n ast.Node) ast.Block {
+		return ast.Block{{Node: ast.ReturnNode{Value: ast.MetaNode{Node: n}}}}
+	}
+	lit := func(n ast.Node) ast.Pattern {
+		return ast.Pattern{Kind: ast.PatLiteral, Value: ast.MetaNode{Node: n}}
+	}
+	bind := func(name string) ast.Pattern {
+		return ast.Pattern{Kind: ast.PatBind, Bind: name}
+	}
+
+	expectAll(t, p, src, []testCase{{
+		Code: "??c('a'(>1) 'b'(>2) :(>3))",
+		Result: ast.MatchNode{
+			Value: ast.MetaNode{Node: ast.SelectorNode{Child: "c"}},
+			Arms: []ast.MatchArm{
+				{Pattern: lit(ast.CharNode{Value: 'a'}), Block: ret(ast.IntNode{Value: 1})},
+				{Pattern: lit(ast.CharNode{Value: 'b'}), Block: ret(ast.IntNode{Value: 2})},
+				{Pattern: bind(""), Block: ret(ast.IntNode{Value: 3})},
+			},
+		}}, {
+		Code: "??v(@Vec Zero Zero(>1) @Vec X Zero(>X) P(>2))",
+		Result: ast.MatchNode{
+			Value: ast.MetaNode{Node: ast.SelectorNode{Child: "v"}},
+			Arms: []ast.MatchArm{
+				{
+					Pattern: ast.Pattern{Kind: ast.PatStruct, Type: vec, Fields: []ast.Pattern{
+						lit(ast.IntNode{Value: 0}),
+						lit(ast.IntNode{Value: 0}),
+					}},
+					Block: ret(ast.IntNode{Value: 1}),
+				},
+				{
+					Pattern: ast.Pattern{Kind: ast.PatStruct, Type: vec, Fields: []ast.Pattern{
+						bind("X"),
+						lit(ast.IntNode{Value: 0}),
+					}},
+					Block: ret(ast.SelectorNode{Child: "X"}),
+				},
+				{Pattern: bind("P"), Block: ret(ast.IntNode{Value: 2})},
+			},
+		}}, {
+		Code: "??s(#Circle R(>R) #Square @Vec X Y(>X) #Square(>0) #Empty(>1))",
+		Result: ast.MatchNode{
+			Value: ast.MetaNode{Node: ast.SelectorNode{Child: "s"}},
+			Arms: []ast.MatchArm{
+				{
+					Pattern: ast.Pattern{Kind: ast.PatVariant, Type: shape, Variant: "Circle", Fields: []ast.Pattern{bind("R")}},
+					Block:   ret(ast.SelectorNode{Child: "R"}),
+				},
+				{
+					Pattern: ast.Pattern{Kind: ast.PatVariant, Type: shape, Variant: "Square", Fields: []ast.Pattern{
+						{Kind: ast.PatStruct, Type: vec, Fields: []ast.Pattern{bind("X"), bind("Y")}},
+					}},
+					Block: ret(ast.SelectorNode{Child: "X"}),
+				},
+				{
+					Pattern: ast.Pattern{Kind: ast.PatVariant, Type: shape, Variant: "Square"},
+					Block:   ret(ast.IntNode{Value: 0}),
+				},
+				{
+					Pattern: ast.Pattern{Kind: ast.PatVariant, Type: shape, Variant: "Empty"},
+					Block:   ret(ast.IntNode{Value: 1}),
+				},
+			},
+		}},
+	})
+}
+
+func TestForEach(t *testing.T) {
+	p, src := makeParser(t, "ForEach")
+
+	p.Scope.Vars["Xs"] = ast.ArrayNode{Type: types.ArrayType{Element: types.Int}}
+	p.Scope.Vars["S"] = ast.StringNode{}
+	p.Tree.Funcs["Use"] = ast.Func{
+		Name: "Use",
+		Args: []types.Descriptor{{Name: "what", Type: types.Int}},
+		Ret:  types.Nothing,
+	}
+
+	expectAll(t, p, src, []testCase{{
+		Code: "*%X: Xs(Use! X)",
+		Result: ast.ForEachNode{
+			Elem: "X",
+			Iter: ast.MetaNode{Node: ast.SelectorNode{Child: "Xs"}},
+			Block: ast.Block{
+				{Node: ast.FuncCallNode{
+					Func: "Use",
+					Args: []ast.MetaNode{{Node: ast.SelectorNode{Child: "X"}}},
+				}},
+			},
+		}}, {
+		Code: "*%I C: S(Use! I *! *>)",
+		Result: ast.ForEachNode{
+			Index: "I",
+			Elem:  "C",
+			Iter:  ast.MetaNode{Node: ast.SelectorNode{Child: "S"}},
+			Block: ast.Block{
+				{Node: ast.FuncCallNode{
+					Func: "Use",
+					Args: []ast.MetaNode{{Node: ast.SelectorNode{Child: "I"}}},
+				}},
+				{Node: ast.ContinueNode{}},
+				{Node: ast.BreakNode{}},
+			},
+		}}, {
+		Code: "**(*>)",
+		Result: ast.WhileNode{
+			Cond:  ast.MetaNode{Node: ast.BoolNode{Value: true}},
+			Block: ast.Block{{Node: ast.BreakNode{}}},
+		}},
+	})
+}
@@ -222,6 +222,19 @@ func compare(t *testing.T, note string, mexp, mgot ast.MetaNode) {
 		for i, ea := range efc.Args {
 			compare(t, note+": arguments", ea, gfc.Args[i])
 		}
+	case ast.NMethodCall:
+		emc := exp.(ast.MethodCallNode)
+		gmc := got.(ast.MethodCallNode)
+		if emc.Type != gmc.Type || emc.Method != gmc.Method {
+			t.Fatalf("%s: expected `%s#%s` method, got `%s#%s`", note, emc.Type, emc.Method, gmc.Type, gmc.Method)
+		}
+		compare(t, note+": receiver", emc.Recv, gmc.Recv)
+		if len(emc.Args) != len(gmc.Args) {
+			t.Fatalf("%s: expected %d arguments, got %d", note, len(emc.Args), len(gmc.Args))
+		}
+		for i, ea := range emc.Args {
+			compare(t, note+": arguments", ea, gmc.Args[i])
+		}
 	case ast.NWhile:
 		ew := exp.(ast.WhileNode)
 		gw := exp.(ast.WhileNode)
@@ -245,6 +258,18 @@ func compare(t *testing.T, note string, mexp, mgot ast.MetaNode) {
 			t.Fatalf("%s: expected `%s` variable, got `%s`", note, ev.Var, gv.Var)
 		}
 		compare(t, note+": variable value", ev.Value, gv.Value)
+	case ast.NDestructure:
+		ed := exp.(ast.DestructureNode)
+		gd := got.(ast.DestructureNode)
+		if !reflect.DeepEqual(ed.Vars, gd.Vars) {
+			t.Fatalf("%s: expected variables %v, got %v", note, ed.Vars, gd.Vars)
+		}
+		compare(t, note+": destructured value", ed.Value, gd.Value)
+	case ast.NSelectorSet:
+		es := exp.(ast.SelectorSetNode)
+		gs := got.(ast.SelectorSetNode)
+		compare(t, note+": target", ast.MetaNode{Node: es.Target}, ast.MetaNode{Node: gs.Target})
+		compare(t, note+": value", es.Value, gs.Value)
 	case ast.NVarSetTyped:
 		ev := exp.(ast.VarSetTypedNode)
 		gv := got.(ast.VarSetTypedNode)
@@ -257,7 +282,7 @@ func compare(t *testing.T, note string, mexp, mgot ast.MetaNode) {
 		compare(t, note+": variable value", ev.Value, gv.Value)
 	case ast.NFuncDef:
 		ef := exp.(ast.FuncDefNode)
-		gf := exp.(ast.FuncDefNode)
+		gf := got.(ast.FuncDefNode)
 		if ef.Name != gf.Name {
 			t.Fatalf("%s: expected `%s` function, got `%s`", note, ef.Name, gf.Name)
 		}
@@ -270,7 +295,7 @@ func compare(t *testing.T, note string, mexp, mgot ast.MetaNode) {
 		}
 	case ast.NFuncShorthand:
 		ef := exp.(ast.FuncShorthandNode)
-		gf := exp.(ast.FuncShorthandNode)
+		gf := got.(ast.FuncShorthandNode)
 		if ef.Name != gf.Name {
 			t.Fatalf("%s: expected `%s` function, got `%s`", note, ef.Name, gf.Name)
 		}
@@ -328,11 +353,143 @@ func compare(t *testing.T, note string, mexp, mgot ast.MetaNode) {
 			ga := gs.Args[i]
 			compare(t, fmt.Sprintf("%s: argument %d", note, i), ea, ga)
 		}
+	case ast.NStructUpdate:
+		eu := exp.(ast.StructUpdateNode)
+		gu := got.(ast.StructUpdateNode)
+		if !eu.Type.Equals(gu.Type) {
+			t.Fatalf("%s: expected %s, got %s", note, eu.Type, gu.Type)
+		}
+		compare(t, note+": base", eu.Base, gu.Base)
+		if !reflect.DeepEqual(eu.Fields, gu.Fields) {
+			t.Fatalf("%s: expected fields %v, got %v", note, eu.Fields, gu.Fields)
+		}
+		for i, ev := range eu.Values {
+			compare(t, fmt.Sprintf("%s: field %s", note, eu.Fields[i]), ev, gu.Values[i])
+		}
+	case ast.NInterp:
+		ei := exp.(ast.InterpNode)
+		gi := got.(ast.InterpNode)
+		if !reflect.DeepEqual(ei.Parts, gi.Parts) {
+			t.Fatalf("%s: expected parts %q, got %q", note, ei.Parts, gi.Parts)
+		}
+		if len(ei.Values) != len(gi.Values) {
+			t.Fatalf("%s: expected %d embedded values, got %d", note, len(ei.Values), len(gi.Values))
+		}
+		for i, ev := range ei.Values {
+			compare(t, fmt.Sprintf("%s: embedded value %d", note, i), ev, gi.Values[i])
+		}
+	case ast.NTuple:
+		et := exp.(ast.TupleNode)
+		gt := got.(ast.TupleNode)
+		if len(et.Elems) != len(gt.Elems) {
+			t.Fatalf("%s: expected %d elements, got %d", note, len(et.Elems), len(gt.Elems))
+		}
+		for i, ee := range et.Elems {
+			compare(t, fmt.Sprintf("%s: element %d", note, i), ee, gt.Elems[i])
+		}
+	case ast.NTry:
+		compare(t, note+": tried value", exp.(ast.TryNode).Value, got.(ast.TryNode).Value)
+	case ast.NMap:
+		em := exp.(ast.MapNode)
+		gm := got.(ast.MapNode)
+		if !em.Type.Equals(gm.Type) {
+			t.Fatalf("%s: expected %s, got %s", note, em.Type, gm.Type)
+		}
+		if len(em.Keys) != len(gm.Keys) || len(em.Values) != len(gm.Values) {
+			t.Fatalf("%s: expected %d pairs, got %d", note, len(em.Keys), len(gm.Keys))
+		}
+		for i, ek := range em.Keys {
+			compare(t, fmt.Sprintf("%s: key %d", note, i), ek, gm.Keys[i])
+			compare(t, fmt.Sprintf("%s: value %d", note, i), em.Values[i], gm.Values[i])
+		}
+	case ast.NFuncRef:
+		ef := exp.(ast.FuncRefNode)
+		gf := got.(ast.FuncRefNode)
+		if ef.Func != gf.Func {
+			t.Fatalf("%s: expected `%s` function, got `%s`", note, ef.Func, gf.Func)
+		}
+	case ast.NLambda:
+		el := exp.(ast.LambdaNode)
+		gl := got.(ast.LambdaNode)
+		if len(el.Proto) != len(gl.Proto) {
+			t.Fatalf("%s: expected %d arguments, got %d", note, len(el.Proto), len(gl.Proto))
+		}
+		for i, ea := range el.Proto {
+			ga := gl.Proto[i]
+			if ea.Name != ga.Name || !ea.Type.Equals(ga.Type) {
+				t.Fatalf("%s: expected argument %s/%s, got %s/%s", note, ea.Name, ea.Type, ga.Name, ga.Type)
+			}
+		}
+		if el.Ret.Prim() != gl.Ret.Prim() {
+			t.Fatalf("%s: expected %s return type, got %s", note, el.Ret, gl.Ret)
+		}
+		if len(el.Body) != len(gl.Body) {
+			t.Fatalf("%s: expected %d body nodes, got %d", note, len(el.Body), len(gl.Body))
+		}
+		for i, en := range el.Body {
+			compare(t, fmt.Sprintf("%s: body node %d", note, i), en, gl.Body[i])
+		}
+	case ast.NForEach:
+		ef := exp.(ast.ForEachNode)
+		gf := got.(ast.ForEachNode)
+		if ef.Index != gf.Index || ef.Elem != gf.Elem {
+			t.Fatalf("%s: expected `%s` `%s` variables, got `%s` `%s`", note, ef.Index, ef.Elem, gf.Index, gf.Elem)
+		}
+		compare(t, note+": Iter", ef.Iter, gf.Iter)
+		if len(ef.Block) != len(gf.Block) {
+			t.Fatalf("%s: expected %d body nodes, got %d", note, len(ef.Block), len(gf.Block))
+		}
+		for i, en := range ef.Block {
+			compare(t, note+": Body", en, gf.Block[i])
+		}
+	case ast.NBreak, ast.NContinue:
+		// nothing to compare
+	case ast.NMatch:
+		em := exp.(ast.MatchNode)
+		gm := got.(ast.MatchNode)
+		compare(t, note+": Value", em.Value, gm.Value)
+		if len(em.Arms) != len(gm.Arms) {
+			t.Fatalf("%s: expected %d arms, got %d", note, len(em.Arms), len(gm.Arms))
+		}
+		for i, ea := range em.Arms {
+			ga := gm.Arms[i]
+			comparePattern(t, fmt.Sprintf("%s: arm %d", note, i), ea.Pattern, ga.Pattern)
+			if len(ea.Block) != len(ga.Block) {
+				t.Fatalf("%s: arm %d: expected %d nodes, got %d", note, i, len(ea.Block), len(ga.Block))
+			}
+			for j, en := range ea.Block {
+				compare(t, fmt.Sprintf("%s: arm %d", note, i), en, ga.Block[j])
+			}
+		}
 	default:
 		panic(fmt.Sprintf("compare() call on unexpected node: %s", exp.Kind()))
 	}
 }
 
+func comparePattern(t *testing.T, note string, exp, got ast.Pattern) {
+	if exp.Kind != got.Kind {
+		t.Fatalf("%s: expected pattern kind %d, got %d", note, exp.Kind, got.Kind)
+	}
+	if exp.Bind != got.Bind {
+		t.Fatalf("%s: expected `%s` binding, got `%s`", note, exp.Bind, got.Bind)
+	}
+	if exp.Variant != got.Variant {
+		t.Fatalf("%s: expected `%s` variant, got `%s`", note, exp.Variant, got.Variant)
+	}
+	if exp.Kind == ast.PatLiteral {
+		compareLiteral(t, note+": literal", exp.Value, got.Value)
+	}
+	if exp.Type != nil && !exp.Type.Equals(got.Type) {
+		t.Fatalf("%s: expected pattern type %s, got %s", note, exp.Type, got.Type)
+	}
+	if len(exp.Fields) != len(got.Fields) {
+		t.Fatalf("%s: expected %d sub-patterns, got %d", note, len(exp.Fields), len(got.Fields))
+	}
+	for i, ef := range exp.Fields {
+		comparePattern(t, fmt.Sprintf("%s: sub-pattern %d", note, i), ef, got.Fields[i])
+	}
+}
+
 func randRange(min, max int) int {
 	return min + rand.Intn(max-min)
 }
@@ -344,7 +501,7 @@ func arrOf(element types.Type, elements ...any) ast.ArrayNode {
 		case bool:
 			enodes = append(enodes, ast.MetaNode{Node: ast.BoolNode{Value: e}})
 		case rune:
-			enodes = append(enodes, ast.MetaNode{Node: ast.CharNode{Value: byte(e)}})
+			enodes = append(enodes, ast.MetaNode{Node: ast.CharNode{Value: e}})
 		case int:
 			enodes = append(enodes, ast.MetaNode{Node: ast.IntNode{Value: int64(e)}})
 		case float64:
@@ -1,9 +1,13 @@
 package parser_test
 
 import (
+	"errors"
+	"math"
+	"reflect"
 	"testing"
 
 	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
 	"github.com/syzkrash/skol/parser/values/types"
 )
 
@@ -108,6 +112,32 @@ func TestVarSetTyped(t *testing.T) {
 	})
 }
 
+func TestSelectorSet(t *testing.T) {
+	p, src := makeParser(t, "SelectorSet")
+
+	p.Scope.Vars["P"] = ast.StructNode{Type: types.MakeStruct("Point", "X", types.Int, "Y", types.Int).(types.StructType)}
+	p.Scope.Vars["Xs"] = ast.ArrayNode{Type: types.ArrayType{Element: types.Int}}
+	p.Scope.Vars["I"] = ast.IntNode{}
+
+	expectAll(t, p, src, []testCase{{
+		Code: "%P#X: 1",
+		Result: ast.SelectorSetNode{
+			Target: ast.SelectorNode{Parent: ast.SelectorNode{Child: "P"}, Child: "X"},
+			Value:  ast.MetaNode{Node: ast.IntNode{Value: 1}},
+		}}, {
+		Code: "%Xs#0: 2",
+		Result: ast.SelectorSetNode{
+			Target: ast.IndexConstNode{Parent: ast.SelectorNode{Child: "Xs"}, Idx: 0},
+			Value:  ast.MetaNode{Node: ast.IntNode{Value: 2}},
+		}}, {
+		Code: "%Xs#[I]: P#Y",
+		Result: ast.SelectorSetNode{
+			Target: ast.IndexSelectorNode{Parent: ast.SelectorNode{Child: "Xs"}, Idx: ast.SelectorNode{Child: "I"}},
+			Value:  ast.MetaNode{Node: ast.SelectorNode{Parent: ast.SelectorNode{Child: "P"}, Child: "Y"}},
+		}},
+	})
+}
+
 func TestFuncDef(t *testing.T) {
 	p, src := makeParser(t, "FuncDef")
 
@@ -350,3 +380,562 @@ func TestStructDef(t *testing.T) {
 		}},
 	})
 }
+
+func TestForwardReference(t *testing.T) {
+	p, src := makeParser(t, "ForwardReference")
+
+	src.Reset(`$Main(
+  Greet! "Joe" @Point 1 2
+)
+
+$Greet Name/str At/Point(
+  print! Name
+)
+
+@Point(x/i y/i)
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	main, ok := tree.Funcs["Main"]
+	if !ok {
+		t.Fatal("expected function Main")
+	}
+	compare(t, "Main", ast.MetaNode{Node: ast.FuncCallNode{
+		Func: "Greet",
+		Args: []ast.MetaNode{
+			{Node: ast.StringNode{Value: "Joe"}},
+			{Node: ast.StructNode{}},
+		},
+	}}, main.Body[0])
+	if _, ok := tree.Funcs["Greet"]; !ok {
+		t.Fatal("expected function Greet")
+	}
+}
+
+func TestMutualRecursion(t *testing.T) {
+	p, src := makeParser(t, "MutualRecursion")
+
+	src.Reset(`$IsEven/bool N/int(
+  ?eq! N 0 (> *)
+  > IsOdd! sub! N 1
+)
+
+$IsOdd/bool N/int(
+  ?eq! N 0 (> /)
+  > IsEven! sub! N 1
+)
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	for name, other := range map[string]string{"IsEven": "IsOdd", "IsOdd": "IsEven"} {
+		f, ok := tree.Funcs[name]
+		if !ok {
+			t.Fatalf("expected function %s", name)
+		}
+		if len(f.Body) != 2 {
+			t.Fatalf("%s: expected 2 body nodes, got %d", name, len(f.Body))
+		}
+		ret := f.Body[1].Node.(ast.ReturnNode)
+		call, ok := ret.Value.Node.(ast.FuncCallNode)
+		if !ok || call.Func != other {
+			t.Fatalf("%s: expected a call to %s, got %+v", name, other, ret.Value.Node)
+		}
+	}
+}
+
+func TestGenericStruct(t *testing.T) {
+	p, src := makeParser(t, "GenericStruct")
+
+	src.Reset(`@Box[T](
+  Ok/bool
+  Value/T
+)
+
+%A: @Box * 123
+%B: @Box[str] / ""
+%C/Box[[float]]: @Box / [float]()
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	box := tree.Structs["Box"]
+	if !reflect.DeepEqual(box.Params, []string{"T"}) {
+		t.Fatalf("expected type parameter T, got %v", box.Params)
+	}
+	if !box.Fields[1].Type.Equals(types.ParamType{Name: "T"}) {
+		t.Fatalf("expected field of type T, got %s", box.Fields[1].Type)
+	}
+
+	for name, want := range map[string]types.Type{
+		"A": types.Int,
+		"B": types.String,
+		"C": types.ArrayType{Element: types.Float},
+	} {
+		s := tree.Vars[name].Value.Node.(ast.StructNode).Type
+		if len(s.Args) != 1 || !s.Args[0].Equals(want) {
+			t.Fatalf("%s: expected Box[%s], got %s", name, want, s)
+		}
+		if vt, _ := s.FieldType("Value"); !vt.Equals(want) {
+			t.Fatalf("%s: expected Value field of type %s, got %s", name, want, vt)
+		}
+	}
+}
+
+func TestGenericFunc(t *testing.T) {
+	p, src := makeParser(t, "GenericFunc")
+
+	src.Reset(`$First[T]/T Arr/[T] Default/T(
+  %r: Arr#0
+  ?r#ok(
+    >r#value
+  )
+  >Default
+)
+
+$Pick[T U]/U A/T B/U(>B)
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	first := tree.Funcs["First"]
+	if !reflect.DeepEqual(first.Params, []string{"T"}) {
+		t.Fatalf("expected type parameter T, got %v", first.Params)
+	}
+	if want := (types.ArrayType{Element: types.ParamType{Name: "T"}}); !first.Args[0].Type.Equals(want) {
+		t.Fatalf("expected argument of type %s, got %s", want, first.Args[0].Type)
+	}
+	if !first.Ret.Equals(types.ParamType{Name: "T"}) {
+		t.Fatalf("expected return type T, got %s", first.Ret)
+	}
+
+	pick := tree.Funcs["Pick"]
+	if !reflect.DeepEqual(pick.Params, []string{"T", "U"}) {
+		t.Fatalf("expected type parameters T U, got %v", pick.Params)
+	}
+	if !pick.Ret.Equals(types.ParamType{Name: "U"}) {
+		t.Fatalf("expected return type U, got %s", pick.Ret)
+	}
+}
+
+func TestMethod(t *testing.T) {
+	p, src := makeParser(t, "Method")
+
+	src.Reset(`@Vec(X/int Y/int)
+
+$Vec#Sum/int V/Vec: add! V#X V#Y
+
+$Vec#Scale/Vec V/Vec N/int(
+  >@Vec mul! V#X N mul! V#Y N
+)
+
+$Use V/Vec(
+  V#Scale! 2
+  %s: V#Sum!
+)
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	if _, ok := tree.Funcs["Sum"]; ok {
+		t.Fatal("expected method Sum not to be a function")
+	}
+	for name, argc := range map[string]int{"Sum": 1, "Scale": 2} {
+		m, ok := tree.Methods["Vec"][name]
+		if !ok {
+			t.Fatalf("expected method Vec#%s", name)
+		}
+		if m.Recv != "Vec" {
+			t.Fatalf("%s: expected receiver Vec, got %s", name, m.Recv)
+		}
+		if len(m.Args) != argc {
+			t.Fatalf("%s: expected %d arguments, got %d", name, argc, len(m.Args))
+		}
+	}
+
+	recv := ast.MetaNode{Node: ast.SelectorNode{Child: "V"}}
+	body := tree.Funcs["Use"].Body
+	if len(body) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(body))
+	}
+	compare(t, "statement", ast.MetaNode{Node: ast.MethodCallNode{
+		Recv:   recv,
+		Type:   "Vec",
+		Method: "Scale",
+		Args:   []ast.MetaNode{{Node: ast.IntNode{Value: 2}}},
+	}}, body[0])
+	compare(t, "value", ast.MetaNode{Node: ast.VarSetNode{
+		Var: "s",
+		Value: ast.MetaNode{Node: ast.MethodCallNode{
+			Recv:   recv,
+			Type:   "Vec",
+			Method: "Sum",
+			Args:   []ast.MetaNode{},
+		}},
+	}}, body[1])
+}
+
+func TestUnion(t *testing.T) {
+	p, src := makeParser(t, "Union")
+
+	src.Reset(`@Shape?(
+  Circle/float
+  Empty
+)
+
+@Option[T]?(Some/T None)
+
+%A: @Shape#Circle 1.5
+%B: @Shape#Empty
+%C: @Option#Some "hi"
+%D: @Option[int]#None
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	shape, ok := tree.Unions["Shape"]
+	if !ok {
+		t.Fatal("expected union Shape")
+	}
+	want := []types.Descriptor{{Name: "Circle", Type: types.Float}, {Name: "Empty", Type: types.Nothing}}
+	if len(shape.Variants) != len(want) {
+		t.Fatalf("expected %d variants, got %d", len(want), len(shape.Variants))
+	}
+	for i, v := range want {
+		got := shape.Variants[i]
+		if got.Name != v.Name || got.Type.Prim() != v.Type.Prim() {
+			t.Fatalf("expected variant %s/%s, got %s/%s", v.Name, v.Type, got.Name, got.Type)
+		}
+	}
+	if !reflect.DeepEqual(tree.Unions["Option"].Params, []string{"T"}) {
+		t.Fatalf("expected type parameter T, got %v", tree.Unions["Option"].Params)
+	}
+
+	for name, c := range map[string]struct {
+		variant string
+		payload bool
+		args    []types.Type
+	}{
+		"A": {"Circle", true, nil},
+		"B": {"Empty", false, nil},
+		"C": {"Some", true, []types.Type{types.String}},
+		"D": {"None", false, []types.Type{types.Int}},
+	} {
+		v, ok := tree.Vars[name].Value.Node.(ast.VariantNode)
+		if !ok {
+			t.Fatalf("%s: expected a variant, got %s", name, tree.Vars[name].Value.Node.Kind())
+		}
+		if v.Variant != c.variant {
+			t.Fatalf("%s: expected variant %s, got %s", name, c.variant, v.Variant)
+		}
+		if (v.Value.Node != nil) != c.payload {
+			t.Fatalf("%s: expected payload: %v, got %+v", name, c.payload, v.Value.Node)
+		}
+		if len(v.Type.Args) != len(c.args) {
+			t.Fatalf("%s: expected %d type arguments, got %s", name, len(c.args), v.Type)
+		}
+		for i, a := range c.args {
+			if !v.Type.Args[i].Equals(a) {
+				t.Fatalf("%s: expected type argument %s, got %s", name, a, v.Type.Args[i])
+			}
+		}
+	}
+}
+
+func TestAlias(t *testing.T) {
+	p, src := makeParser(t, "Alias")
+
+	src.Reset(`@Offset: int
+@Lines: [str]
+@Vec(X/int Y/int)
+@Pos: Vec
+
+$Get/str L/Lines At/Offset: at! L At
+$Left/Pos P/Pos: @Vec 0 P#Y
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	want := map[string]types.Type{
+		"Offset": types.Int,
+		"Lines":  types.ArrayType{Element: types.String},
+	}
+	for name, typ := range want {
+		a, ok := tree.Aliases[name]
+		if !ok {
+			t.Fatalf("expected alias %s", name)
+		}
+		if !reflect.DeepEqual(a.Type, typ) {
+			t.Fatalf("%s: expected %s, got %s", name, typ, a.Type)
+		}
+	}
+
+	get := tree.Funcs["Get"]
+	offset := types.AliasType{Name: "Offset", Type: types.Int}
+	if !reflect.DeepEqual(get.Args[1].Type, offset) {
+		t.Fatalf("expected argument of type %s, got %s", offset, get.Args[1].Type)
+	}
+	// aliases are transparent
+	if !offset.Equals(types.Int) || !types.Int.Equals(offset) {
+		t.Fatal("expected Offset to be compatible with Int")
+	}
+	if offset.Equals(types.String) {
+		t.Fatal("expected Offset not to be compatible with String")
+	}
+	pos := tree.Funcs["Left"].Ret
+	if pos.Prim() != types.PStruct || !pos.Equals(tree.Funcs["Left"].Args[0].Type) {
+		t.Fatalf("expected Pos to be a structure, got %s", pos)
+	}
+}
+
+func TestConstEval(t *testing.T) {
+	tree, errs := parseAll(t, `#KB: 1024
+#Size: mul! 4 KB
+#Name: concat! "sk" "ol"
+#Big: gt! Size 4000
+#Title: "\{Name} \{Size}"
+%A: Size
+%B: Name
+%C: Big
+%E: Title
+%D: 0
+`, 0)
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d", len(errs))
+	}
+	want := map[string]ast.Node{
+		"A": ast.IntNode{Value: 4096},
+		"B": ast.StringNode{Value: "skol"},
+		"C": ast.BoolNode{Value: true},
+		"E": ast.StringNode{Value: "skol 4096"},
+	}
+	for name, exp := range want {
+		v, ok := tree.Vars[name]
+		if !ok {
+			t.Fatalf("expected variable %s", name)
+		}
+		if !reflect.DeepEqual(v.Value.Node, exp) {
+			t.Fatalf("expected %s to be %#v, got %#v", name, exp, v.Value.Node)
+		}
+	}
+}
+
+// TestConstBuiltins checks the compile time evaluation of builtins against the
+// semantics documented for them.
+func TestConstBuiltins(t *testing.T) {
+	cases := []struct {
+		Code string
+		// Want is the value of the constant, or nil if it is an error
+		Want ast.Node
+	}{
+		// results must fit in 64 bits
+		{"add! 9223372036854775806 1", ast.IntNode{Value: math.MaxInt64}},
+		{"add! 9223372036854775807 1", nil},
+		{"sub! -9223372036854775807 1", ast.IntNode{Value: math.MinInt64}},
+		{"sub! -9223372036854775807 2", nil},
+		{"mul! 4294967296 4294967296", nil},
+		{"mul! 1e308 10.0", nil},
+
+		{"pow! 2 62", ast.IntNode{Value: 1 << 62}},
+		{"pow! 2 63", nil},
+		{"pow! -1 101", ast.IntNode{Value: -1}},
+		{"pow! 2 -1", nil},
+		{"pow! 2.0 -1.0", ast.FloatNode{Value: 0.5}},
+
+		{"div! -7 2", ast.IntNode{Value: -4}},
+		{"div! 7 -2", ast.IntNode{Value: -4}},
+		{"div! -7 -2", ast.IntNode{Value: 3}},
+		{"div! -7.0 2.0", ast.FloatNode{Value: -3.5}},
+		{"div! 1 0", nil},
+		{"div! 1.0 0.0", nil},
+		{"mod! -7 2", ast.IntNode{Value: 1}},
+		{"mod! 7 -2", ast.IntNode{Value: -1}},
+		{"mod! -7 -2", ast.IntNode{Value: -1}},
+		{"mod! 1 0", nil},
+
+		{`slice! "skol" -2 -1`, ast.StringNode{Value: "ol"}},
+		{`slice! "skol" -10 2`, ast.StringNode{Value: "sk"}},
+		{`slice! "skol" 1 -3`, ast.StringNode{Value: "kol"}},
+		{`slice! "skol" 2 10`, ast.StringNode{Value: "ol"}},
+		{`slice! "skol" 3 1`, ast.StringNode{Value: ""}},
+		{`at! "skol" -1`, ast.CharNode{Value: 'l'}},
+		{`at! "skol" 4`, nil},
+
+		{"str! 1e16", ast.StringNode{Value: "1e+16"}},
+		{"str! 1e15", ast.StringNode{Value: "1000000000000000.0"}},
+		{"str! 1e-5", ast.StringNode{Value: "1e-05"}},
+		{"str! 0.0001", ast.StringNode{Value: "0.0001"}},
+		{"str! 2.0", ast.StringNode{Value: "2.0"}},
+		{"str! 'A'", ast.StringNode{Value: "65"}},
+		{"str! *", ast.StringNode{Value: "True"}},
+		{`bool! ""`, ast.BoolNode{Value: false}},
+	}
+	for _, c := range cases {
+		if c.Want == nil {
+			_, errs := parseAll(t, "#A: "+c.Code+"\n", 0)
+			var perr *pe.PrettyError
+			if len(errs) != 1 || !errors.As(errs[0], &perr) || perr.Code != pe.EBadConstant {
+				t.Fatalf("expected error %d for %q, got %v", pe.EBadConstant, c.Code, errs)
+			}
+			continue
+		}
+		tree, errs := parseAll(t, "#A: "+c.Code+"\n%V: A\n%D: 0\n", 0)
+		if len(errs) != 0 {
+			t.Fatalf("expected no errors for %q, got %v", c.Code, errs[0])
+		}
+		if got := tree.Vars["V"].Value.Node; !reflect.DeepEqual(got, c.Want) {
+			t.Fatalf("expected %q to be %#v, got %#v", c.Code, c.Want, got)
+		}
+	}
+}
+
+func TestConstEvalErrors(t *testing.T) {
+	cases := []struct {
+		Code string
+		Err  pe.ErrorCode
+	}{
+		{"%v: 1\n#A: add! v 1\n", pe.ENotConstant},
+		{"$f/int x/int(>x)\n#A: f! 1\n", pe.ENotConstant},
+		{"#A: div! 1 0\n", pe.EBadConstant},
+		{"#A: print! \"hi\"\n", pe.EBadConstant},
+	}
+	for _, c := range cases {
+		_, errs := parseAll(t, c.Code, 0)
+		if len(errs) != 1 {
+			t.Fatalf("expected 1 error for %q, got %d", c.Code, len(errs))
+		}
+		var perr *pe.PrettyError
+		if !errors.As(errs[0], &perr) || perr.Code != c.Err {
+			t.Fatalf("expected error %d for %q, got %v", c.Err, c.Code, errs[0])
+		}
+	}
+}
+
+func TestTupleDestructure(t *testing.T) {
+	p, src := makeParser(t, "TupleDestructure")
+
+	src.Reset(`$DivMod/(int int) A/int B/int(>(div! A B mod! A B))
+$Main(
+  %(Q R): DivMod! 7 2
+  %Sum: add! Q R
+)
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	want := types.TupleType{Elems: []types.Type{types.Int, types.Int}}
+	if got := tree.Funcs["DivMod"].Ret; !want.Equals(got) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	body := tree.Funcs["Main"].Body
+	compare(t, "destructure", ast.MetaNode{Node: ast.DestructureNode{
+		Vars: []string{"Q", "R"},
+		Value: ast.MetaNode{Node: ast.FuncCallNode{
+			Func: "DivMod",
+			Args: []ast.MetaNode{
+				{Node: ast.IntNode{Value: 7}},
+				{Node: ast.IntNode{Value: 2}},
+			},
+		}},
+	}}, body[0])
+	// the destructured variables take the types of the tuple's elements
+	q, ok := p.Scope.FindVar("Q")
+	if !ok {
+		t.Fatal("expected Q to be defined")
+	}
+	if typ, err := p.TypeOf(q); err != nil || !types.Int.Equals(typ) {
+		t.Fatalf("expected Q to be Int, got %v (%v)", typ, err)
+	}
+
+	for _, code := range []string{"%v: (1)\n", "%(A): (1 2)\n", "$f/(int) x/int(>x)\n"} {
+		_, errs := parseAll(t, code, 0)
+		if len(errs) != 1 {
+			t.Fatalf("expected 1 error for %q, got %d", code, len(errs))
+		}
+		var perr *pe.PrettyError
+		if !errors.As(errs[0], &perr) || perr.Code != pe.ETupleTooShort {
+			t.Fatalf("expected error %d for %q, got %v", pe.ETupleTooShort, code, errs[0])
+		}
+	}
+}
+
+func TestNestedFunc(t *testing.T) {
+	tree, errs := parseAll(t, `$Main(
+  %Base: 10
+  $Add/int N/int: add! N Base
+  $Count/int N/int(
+    ?eq! N 0(>0)
+    >add! 1 Count! sub! N 1
+  )
+  %Sum: Add! Count! 3
+)
+`, 0)
+	if len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+	if _, ok := tree.Funcs["Add"]; ok {
+		t.Fatal("expected nested function not to be global")
+	}
+
+	body := tree.Funcs["Main"].Body
+	// shorthand bodies of nested functions become full bodies
+	compare(t, "nested shorthand", ast.MetaNode{Node: ast.FuncDefNode{
+		Name: "Add",
+		Body: ast.Block{{Node: ast.ReturnNode{Value: ast.MetaNode{Node: ast.FuncCallNode{
+			Func: "add",
+			Args: []ast.MetaNode{
+				{Node: ast.SelectorNode{Child: "N"}},
+				{Node: ast.SelectorNode{Child: "Base"}},
+			},
+		}}}}},
+	}}, body[1])
+	compare(t, "call", ast.MetaNode{Node: ast.VarSetNode{
+		Var: "Sum",
+		Value: ast.MetaNode{Node: ast.FuncCallNode{
+			Func: "Add",
+			Args: []ast.MetaNode{{Node: ast.FuncCallNode{
+				Func: "Count",
+				Args: []ast.MetaNode{{Node: ast.IntNode{Value: 3}}},
+			}}},
+		}},
+	}}, body[3])
+
+	cases := []struct {
+		Code string
+		Err  pe.ErrorCode
+	}{
+		{"$Main(\n  $Id[T]/T X/T: X\n)\n", pe.EBadNestedFunc},
+		{"$Main(\n  $Exit S/int?\n)\n", pe.EBadNestedFunc},
+		{"@V(X/int)\n$Main(\n  $V#Len/int S/V: S#X\n)\n", pe.EBadNestedFunc},
+		{"$Main(\n  $add/int X/int: X\n)\n", pe.EShadowedFunc},
+		{"$Helper(print! \"x\")\n$Main(\n  $Helper/int X/int: X\n)\n", pe.EShadowedFunc},
+	}
+	for _, c := range cases {
+		_, errs := parseAll(t, c.Code, 0)
+		if len(errs) != 1 {
+			t.Fatalf("expected 1 error for %q, got %d", c.Code, len(errs))
+		}
+		var perr *pe.PrettyError
+		if !errors.As(errs[0], &perr) || perr.Code != c.Err {
+			t.Fatalf("expected error %d for %q, got %v", c.Err, c.Code, errs[0])
+		}
+	}
+}
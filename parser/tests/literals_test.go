@@ -43,13 +43,28 @@ func TestLiteralChar(t *testing.T) {
 	}, {
 		Code:   "'\\t'",
 		Result: ast.CharNode{Value: '\t'},
+	}, {
+		Code:   "'ł'",
+		Result: ast.CharNode{Value: 'ł'},
+	}, {
+		Code:   "'日'",
+		Result: ast.CharNode{Value: '日'},
+	}, {
+		Code:   "'🙂'",
+		Result: ast.CharNode{Value: '🙂'},
+	}, {
+		Code:   "65c",
+		Result: ast.CharNode{Value: 'A'},
+	}, {
+		Code:   "0o502c",
+		Result: ast.CharNode{Value: 'ł'},
 	}}
 	// add the entirety of printable ASCII to test cases
 	for c := byte(0x20); c < byte(0x7F); c++ {
 		if c != '\\' && c != '\'' {
 			cases = append(cases, testCase{
 				Code:   fmt.Sprintf("'%c'", c),
-				Result: ast.CharNode{Value: c},
+				Result: ast.CharNode{Value: rune(c)},
 			})
 		}
 	}
@@ -87,6 +102,9 @@ func TestLiteralInt(t *testing.T) {
 	}, {
 		Code:   "1_2",
 		Result: ast.IntNode{Value: 12},
+	}, {
+		Code:   "42i",
+		Result: ast.IntNode{Value: 42},
 	}}
 	// generate a bunch of completely randomised integers to make sure no
 	// weirdness happens for example due to large numbers
@@ -119,6 +137,18 @@ func TestLiteralFloat(t *testing.T) {
 	}, {
 		Code:   "0.0",
 		Result: ast.FloatNode{Value: 0.0},
+	}, {
+		Code:   "1e5",
+		Result: ast.FloatNode{Value: 1e5},
+	}, {
+		Code:   "-1.5e-3",
+		Result: ast.FloatNode{Value: -1.5e-3},
+	}, {
+		Code:   "2.5E+2",
+		Result: ast.FloatNode{Value: 2.5e+2},
+	}, {
+		Code:   "3f",
+		Result: ast.FloatNode{Value: 3},
 	}}
 	for i := 0; i < 20; i++ {
 		num := rand.Float64()
@@ -164,6 +194,31 @@ func TestLiteralString(t *testing.T) {
 	expectAllValues(t, p, src, cases)
 }
 
+func TestLiteralInterp(t *testing.T) {
+	p, src := makeParser(t, "LiteralInterp")
+
+	p.Scope.Vars["Name"] = ast.StringNode{}
+
+	expectAllValues(t, p, src, []testCase{{
+		Code: "\"Hi \\{Name}!\"",
+		Result: ast.InterpNode{
+			Parts:  []string{"Hi ", "!"},
+			Values: []ast.MetaNode{{Node: ast.SelectorNode{Child: "Name"}}},
+		}}, {
+		Code: "\"\\{1}\\{\"\\{2}\"}\"",
+		Result: ast.InterpNode{
+			Parts: []string{"", "", ""},
+			Values: []ast.MetaNode{
+				{Node: ast.IntNode{Value: 1}},
+				{Node: ast.InterpNode{
+					Parts:  []string{"", ""},
+					Values: []ast.MetaNode{{Node: ast.IntNode{Value: 2}}},
+				}},
+			},
+		}},
+	})
+}
+
 func TestLiteralArray(t *testing.T) {
 	p, src := makeParser(t, "LiteralArray")
 
@@ -212,5 +267,54 @@ func TestLiteralArray(t *testing.T) {
 	}, {
 		Code:   "[](\"foo\" \"bar\")",
 		Result: arrOf(types.String, "foo", "bar"),
+	}, {
+		Code:   "[[int]]()",
+		Result: arrOf(types.ArrayType{Element: types.Int}),
+	}, {
+		Code:   "[{str:int}]()",
+		Result: arrOf(types.MapType{Key: types.String, Value: types.Int}),
+	}, {
+		Code:   "[(int str)]()",
+		Result: arrOf(types.TupleType{Elems: []types.Type{types.Int, types.String}}),
+	}, {
+		Code:   "[fn(int)/bool]()",
+		Result: arrOf(types.FuncType{Args: []types.Type{types.Int}, Ret: types.Bool}),
+	}})
+}
+
+func TestLiteralMap(t *testing.T) {
+	p, src := makeParser(t, "LiteralMap")
+
+	lit := func(v any) ast.MetaNode {
+		return arrOf(types.Any, v).Elems[0]
+	}
+	mapOf := func(key, value types.Type, pairs ...any) ast.MapNode {
+		m := ast.MapNode{
+			Type:   types.MapType{Key: key, Value: value},
+			Keys:   []ast.MetaNode{},
+			Values: []ast.MetaNode{},
+		}
+		for i := 0; i < len(pairs); i += 2 {
+			m.Keys = append(m.Keys, lit(pairs[i]))
+			m.Values = append(m.Values, lit(pairs[i+1]))
+		}
+		return m
+	}
+
+	expectAllValues(t, p, src, []testCase{{
+		Code:   "{str:int}()",
+		Result: mapOf(types.String, types.Int),
+	}, {
+		Code:   "{char:[float]}()",
+		Result: mapOf(types.Char, types.ArrayType{Element: types.Float}),
+	}, {
+		Code:   "{s:i}(\"one\": 1 \"two\": 2)",
+		Result: mapOf(types.String, types.Int, "one", 1, "two", 2),
+	}, {
+		Code:   "{}('a': \"A\" 'b': \"B\")",
+		Result: mapOf(types.Char, types.String, 'a', "A", 'b', "B"),
+	}, {
+		Code:   "{}(1: *)",
+		Result: mapOf(types.Int, types.Bool, 1, true),
 	}})
 }
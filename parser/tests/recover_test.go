@@ -0,0 +1,97 @@
+package parser_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/parser"
+)
+
+// parseAll parses the given code, collecting every reported error
+func parseAll(t *testing.T, code string, max int) (ast.AST, []error) {
+	errs := make(chan error)
+	done := make(chan struct{})
+	var got []error
+	go func() {
+		for err := range errs {
+			got = append(got, err)
+		}
+		close(done)
+	}()
+	p := parser.NewParser("TestRecover", strings.NewReader(code), "test", errs)
+	p.MaxErrors = max
+	tree := p.Parse()
+	close(errs)
+	<-done
+	for _, err := range got {
+		t.Log(err)
+	}
+	return tree, got
+}
+
+func TestRecoverBlock(t *testing.T) {
+	tree, errs := parseAll(t, `$Main(
+	%A: 1
+	%B: $ 1
+	%C: 2
+)
+%After: 3
+`, 0)
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+	f, ok := tree.Funcs["Main"]
+	if !ok {
+		t.Fatal("expected function Main to be kept")
+	}
+	if len(f.Body) != 3 {
+		t.Fatalf("expected 3 body nodes, got %d", len(f.Body))
+	}
+	if k := f.Body[1].Node.Kind(); k != ast.NBad {
+		t.Fatalf("expected Bad node, got %s", k)
+	}
+	if l := f.Body[1].Where.Start.Line; l != 3 {
+		t.Fatalf("expected Bad node on line 3, got line %d", l)
+	}
+	if k := f.Body[2].Node.Kind(); k != ast.NVarSet {
+		t.Fatalf("expected VarSet node, got %s", k)
+	}
+	if _, ok := tree.Vars["After"]; !ok {
+		t.Fatal("expected variable After to be kept")
+	}
+}
+
+func TestRecoverTopLevel(t *testing.T) {
+	tree, errs := parseAll(t, `%A: (1 2
+  %NotTopLevel: 3)
+%B: 2
+%C: )
+%D: 4
+`, 0)
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d", len(errs))
+	}
+	for _, v := range []string{"B", "D"} {
+		if _, ok := tree.Vars[v]; !ok {
+			t.Fatalf("expected variable %s to be kept", v)
+		}
+	}
+	if _, ok := tree.Vars["NotTopLevel"]; ok {
+		t.Fatal("expected variable NotTopLevel to be skipped")
+	}
+}
+
+func TestTooManyErrors(t *testing.T) {
+	code := strings.Repeat("%A: )\n", 10)
+	_, errs := parseAll(t, code, 3)
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 errors, got %d", len(errs))
+	}
+	var perr *pe.PrettyError
+	if !errors.As(errs[3], &perr) || perr.Code != pe.ETooManyErrors {
+		t.Fatalf("expected too many errors, got %s", errs[3])
+	}
+}
@@ -2,6 +2,7 @@ package parser_test
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/syzkrash/skol/ast"
@@ -158,6 +159,107 @@ func TestStruct(t *testing.T) {
 	})
 }
 
+func TestStructNamed(t *testing.T) {
+	p, src := makeParser(t, "StructNamed")
+
+	V2I := types.MakeStruct("V2I",
+		"x", types.Int,
+		"y", types.Int).(types.StructType)
+	Line := types.MakeStruct("Line",
+		"name", types.String,
+		"from", V2I,
+		"to", V2I,
+		"tags", types.ArrayType{Element: types.String}).(types.StructType)
+
+	p.Scope.Types["V2I"] = V2I
+	p.Scope.Types["Line"] = Line
+
+	src.Reset(`@Line(to: @V2I(y: 5) name: "diagonal")`)
+	mn, err := p.ParseValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, ok := mn.Node.(ast.StructNode)
+	if !ok {
+		t.Fatalf("expected Struct node, got %s", mn.Node.Kind())
+	}
+	if len(n.Args) != 4 {
+		t.Fatalf("expected 4 arguments, got %d", len(n.Args))
+	}
+	if s, ok := n.Args[0].Node.(ast.StringNode); !ok || s.Value != "diagonal" {
+		t.Fatalf("expected name to be \"diagonal\", got %+v", n.Args[0].Node)
+	}
+	zero := ast.StructNode{Type: V2I, Args: []ast.MetaNode{
+		{Node: ast.IntNode{}},
+		{Node: ast.IntNode{}},
+	}}
+	if !reflect.DeepEqual(n.Args[1].Node, zero) {
+		t.Fatalf("expected from to be zero, got %+v", n.Args[1].Node)
+	}
+	to, ok := n.Args[2].Node.(ast.StructNode)
+	if !ok || len(to.Args) != 2 {
+		t.Fatalf("expected to to be a V2I, got %+v", n.Args[2].Node)
+	}
+	if !reflect.DeepEqual(to.Args[0].Node, ast.IntNode{}) || !reflect.DeepEqual(to.Args[1].Node, ast.IntNode{Value: 5}) {
+		t.Fatalf("expected to to be 0 5, got %+v", to.Args)
+	}
+	if a, ok := n.Args[3].Node.(ast.ArrayNode); !ok || len(a.Elems) != 0 {
+		t.Fatalf("expected tags to be empty, got %+v", n.Args[3].Node)
+	}
+}
+
+func TestStructUpdate(t *testing.T) {
+	p, src := makeParser(t, "StructUpdate")
+
+	V2I := types.MakeStruct("V2I",
+		"x", types.Int,
+		"y", types.Int).(types.StructType)
+	One := types.MakeStruct("One",
+		"v", types.Int).(types.StructType)
+
+	p.Scope.Types["V2I"] = V2I
+	p.Scope.Types["One"] = One
+	p.Scope.Vars["a"] = ast.StructNode{Type: V2I}
+	p.Scope.Vars["o"] = ast.StructNode{Type: One}
+
+	expectAllValues(t, p, src, []testCase{{
+		Code: "@V2I a (y: 1)",
+		Result: ast.StructUpdateNode{
+			Type:   V2I,
+			Base:   ast.MetaNode{Node: ast.SelectorNode{Child: "a"}},
+			Fields: []string{"y"},
+			Values: []ast.MetaNode{{Node: ast.IntNode{Value: 1}}},
+		}}, {
+		Code: "@V2I a (y: 2 x: 3)",
+		Result: ast.StructUpdateNode{
+			Type:   V2I,
+			Base:   ast.MetaNode{Node: ast.SelectorNode{Child: "a"}},
+			Fields: []string{"y", "x"},
+			Values: []ast.MetaNode{
+				{Node: ast.IntNode{Value: 2}},
+				{Node: ast.IntNode{Value: 3}},
+			},
+		}}, {
+		Code: "@One o (v: 4)",
+		Result: ast.StructUpdateNode{
+			Type:   One,
+			Base:   ast.MetaNode{Node: ast.SelectorNode{Child: "o"}},
+			Fields: []string{"v"},
+			Values: []ast.MetaNode{{Node: ast.IntNode{Value: 4}}},
+		}},
+	})
+
+	// a single field structure literal followed by a block
+	src.Reset("@One 1 (")
+	mn, err := p.ParseValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mn.Node.Kind() != ast.NStruct {
+		t.Fatalf("expected Struct node, got %s", mn.Node.Kind())
+	}
+}
+
 func TestSelector(t *testing.T) {
 	p, src := makeParser(t, "Selector")
 
@@ -263,3 +365,212 @@ func TestSelector(t *testing.T) {
 		}
 	}
 }
+
+func TestFuncValues(t *testing.T) {
+	p, src := makeParser(t, "FuncValues")
+
+	src.Reset(`$Double/int N/int: mul! N 2
+
+$Apply/int F/fn(int)/int A/int: F! A
+
+$main (
+  %Base: 10
+  %A: Apply! $Double 1
+  %B: Apply! $(X/int)/int: add! X Base 2
+  %Say/fn(str): $(S/str)(print! S)
+  Say! "hi"
+)
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	apply := tree.Funcs["Apply"]
+	want := types.FuncType{Args: []types.Type{types.Int}, Ret: types.Int}
+	if !apply.Args[0].Type.Equals(want) {
+		t.Fatalf("expected argument of type %s, got %s", want, apply.Args[0].Type)
+	}
+
+	body := tree.Funcs["main"].Body
+	if len(body) != 5 {
+		t.Fatalf("expected 5 body nodes, got %d", len(body))
+	}
+	compare(t, "reference", ast.MetaNode{Node: ast.VarSetNode{
+		Var: "A",
+		Value: ast.MetaNode{Node: ast.FuncCallNode{
+			Func: "Apply",
+			Args: []ast.MetaNode{
+				{Node: ast.FuncRefNode{Func: "Double"}},
+				{Node: ast.IntNode{Value: 1}},
+			}}},
+	}}, body[1])
+	compare(t, "lambda", ast.MetaNode{Node: ast.VarSetNode{
+		Var: "B",
+		Value: ast.MetaNode{Node: ast.FuncCallNode{
+			Func: "Apply",
+			Args: []ast.MetaNode{
+				{Node: ast.LambdaNode{
+					Proto: []types.Descriptor{{Name: "X", Type: types.Int}},
+					Ret:   types.Int,
+					Body: ast.Block{
+						{Node: ast.ReturnNode{Value: ast.MetaNode{Node: ast.FuncCallNode{
+							Func: "add",
+							Args: []ast.MetaNode{
+								{Node: ast.SelectorNode{Child: "X"}},
+								{Node: ast.SelectorNode{Child: "Base"}},
+							}}}}},
+					}}},
+				{Node: ast.IntNode{Value: 2}},
+			}}},
+	}}, body[2])
+	compare(t, "variable call", ast.MetaNode{Node: ast.FuncCallNode{
+		Func: "Say",
+		Args: []ast.MetaNode{
+			{Node: ast.StringNode{Value: "hi"}},
+		}}}, body[4])
+}
+
+// TestFuncNoReturn ensures that functions declared without a return type can
+// be used as values of function types that return nothing
+func TestFuncNoReturn(t *testing.T) {
+	p, src := makeParser(t, "FuncNoReturn")
+
+	src.Reset(`$Hi(print! "hi")
+
+$main (
+  %Say/fn(): $Hi
+  Say!
+)
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	if got := tree.Funcs["Hi"].Ret; got == nil || got.Prim() != types.PNothing {
+		t.Fatalf("expected Hi to return nothing, got %v", got)
+	}
+	compare(t, "reference", ast.MetaNode{Node: ast.VarSetTypedNode{
+		Var:   "Say",
+		Type:  types.FuncType{Args: []types.Type{}, Ret: types.Nothing},
+		Value: ast.MetaNode{Node: ast.FuncRefNode{Func: "Hi"}},
+	}}, tree.Funcs["main"].Body[0])
+}
+
+// TestFuncVariables ensures that variables declared with a function type can
+// be called even if the type of their value is not known
+func TestFuncVariables(t *testing.T) {
+	p, src := makeParser(t, "FuncVariables")
+
+	src.Reset(`$Run/int All/[fn()/int](
+  %Fs/[fn()/int]: slice! All 1 -1
+  %K/fn()/int: at! All 0
+  %A: K!
+  *%F: Fs(
+    %B: F!
+  )
+  >A
+)
+`)
+	tree := p.Parse()
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	body := tree.Funcs["Run"].Body
+	if len(body) != 5 {
+		t.Fatalf("expected 5 body nodes, got %d", len(body))
+	}
+	compare(t, "typed variable call", ast.MetaNode{Node: ast.VarSetNode{
+		Var:   "A",
+		Value: ast.MetaNode{Node: ast.FuncCallNode{Func: "K", Args: []ast.MetaNode{}}},
+	}}, body[2])
+	compare(t, "element call", ast.MetaNode{Node: ast.ForEachNode{
+		Elem: "F",
+		Iter: ast.MetaNode{Node: ast.SelectorNode{Child: "Fs"}},
+		Block: ast.Block{
+			{Node: ast.VarSetNode{
+				Var:   "B",
+				Value: ast.MetaNode{Node: ast.FuncCallNode{Func: "F", Args: []ast.MetaNode{}}},
+			}},
+		},
+	}}, body[3])
+}
+
+func TestTry(t *testing.T) {
+	p, src := makeParser(t, "Try")
+
+	p.Scope.Vars["r"] = ast.StructNode{Type: types.Result(types.Int).(types.StructType)}
+	p.Scope.Vars["s"] = ast.StringNode{}
+
+	expectAllValues(t, p, src, []testCase{{
+		Code: "^r",
+		Result: ast.TryNode{
+			Value: ast.MetaNode{Node: ast.SelectorNode{Child: "r"}},
+		}}, {
+		Code: "^int! s",
+		Result: ast.TryNode{
+			Value: ast.MetaNode{Node: ast.FuncCallNode{
+				Func: "int",
+				Args: []ast.MetaNode{{Node: ast.SelectorNode{Child: "s"}}},
+			}},
+		}},
+	})
+
+	// the built-in Result structure infers it's type argument like any other
+	src.Reset("@Result * 5")
+	mn, err := p.ParseValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, ok := mn.Node.(ast.StructNode)
+	if !ok {
+		t.Fatalf("expected Struct node, got %s", mn.Node.Kind())
+	}
+	if !n.Type.Equals(types.Result(types.Int)) {
+		t.Fatalf("expected %s, got %s", types.Result(types.Int), n.Type)
+	}
+	if vt, err := p.TypeOf(ast.TryNode{Value: mn}); err != nil || !types.Int.Equals(vt) {
+		t.Fatalf("expected propagated Int, got %v (%v)", vt, err)
+	}
+}
+
+func TestTuple(t *testing.T) {
+	p, src := makeParser(t, "Tuple")
+
+	p.Scope.Vars["s"] = ast.StringNode{}
+
+	expectAllValues(t, p, src, []testCase{{
+		Code: "(1 s)",
+		Result: ast.TupleNode{Elems: []ast.MetaNode{
+			{Node: ast.IntNode{Value: 1}},
+			{Node: ast.SelectorNode{Child: "s"}},
+		}}}, {
+		Code: "(add! 1 2 * 'c')",
+		Result: ast.TupleNode{Elems: []ast.MetaNode{
+			{Node: ast.FuncCallNode{
+				Func: "add",
+				Args: []ast.MetaNode{
+					{Node: ast.IntNode{Value: 1}},
+					{Node: ast.IntNode{Value: 2}},
+				},
+			}},
+			{Node: ast.BoolNode{Value: true}},
+			{Node: ast.CharNode{Value: 'c'}},
+		}}},
+	})
+
+	src.Reset("(1 s)")
+	mn, err := p.ParseValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.TupleType{Elems: []types.Type{types.Int, types.String}}
+	if typ, err := p.TypeOf(mn.Node); err != nil || !want.Equals(typ) {
+		t.Fatalf("expected %s, got %v (%v)", want, typ, err)
+	}
+	if want.Equals(types.TupleType{Elems: []types.Type{types.String, types.Int}}) {
+		t.Fatal("expected element order to matter")
+	}
+}
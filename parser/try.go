@@ -0,0 +1,22 @@
+package parser
+
+import (
+	"github.com/syzkrash/skol/ast"
+)
+
+// parseTry parses the value of a propagated result, after the caret. Whether
+// the value is a result, and whether the enclosing function returns one, is
+// left for the typechecker.
+//
+//	^int! S
+//	 ^^^^^^
+func (p *Parser) parseTry() (n ast.Node, err error) {
+	v, err := p.ParseValue()
+	if err != nil {
+		return
+	}
+	n = ast.TryNode{
+		Value: v,
+	}
+	return
+}
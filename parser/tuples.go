@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// parseTuple parses a tuple literal, after the opening parenthesis.
+//
+//	(State * Row)
+//	 ^^^^^^^^^^^^
+func (p *Parser) parseTuple(start *lexer.Token) (n ast.Node, err error) {
+	elems := []ast.MetaNode{}
+	for {
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			break
+		}
+		p.rollback(tok)
+		var e ast.MetaNode
+		e, err = p.ParseValue()
+		if err != nil {
+			return
+		}
+		elems = append(elems, e)
+	}
+	if len(elems) < 2 {
+		err = tokErr(pe.ETupleTooShort, start)
+		return
+	}
+	n = ast.TupleNode{
+		Elems: elems,
+	}
+	return
+}
+
+// parseTupleType parses the element types of a tuple type, after the opening
+// parenthesis.
+//
+//	(Reader [str])
+//	 ^^^^^^^^^^^^^
+func (p *Parser) parseTupleType(start *lexer.Token) (t types.Type, err error) {
+	tt := types.TupleType{}
+	for {
+		var tok *lexer.Token
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			break
+		}
+		p.rollback(tok)
+		var e types.Type
+		e, err = p.parseType()
+		if err != nil {
+			return
+		}
+		tt.Elems = append(tt.Elems, e)
+	}
+	if len(tt.Elems) < 2 {
+		err = tokErr(pe.ETupleTooShort, start)
+		return
+	}
+	t = tt
+	return
+}
+
+// parseDestructure parses a destructuring assignment, after the opening
+// parenthesis. Every element of the tuple is assigned to the variable at the
+// same position.
+//
+//	%(State Row): ReadRow! R
+//	  ^^^^^^^^^^^^^^^^^^^^^^
+func (p *Parser) parseDestructure(start *lexer.Token) (n ast.Node, err error) {
+	var (
+		vars []string
+		tok  *lexer.Token
+	)
+	for {
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			break
+		}
+		if tok.Kind != lexer.TIdent {
+			err = tokErr(pe.EExpectedName, tok)
+			return
+		}
+		vars = append(vars, tok.Raw)
+	}
+	if len(vars) < 2 {
+		err = tokErr(pe.ETupleTooShort, start)
+		return
+	}
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PIs {
+		err = tokErr(pe.EExpectedColon, tok)
+		return
+	}
+	value, err := p.ParseValue()
+	if err != nil {
+		return
+	}
+
+	for i, v := range p.destructured(value.Node, len(vars)) {
+		p.Scope.SetVar(vars[i], v)
+	}
+	n = ast.DestructureNode{
+		Vars:  vars,
+		Value: value,
+	}
+	return
+}
+
+// destructured returns the values of the given amount of variables assigned by
+// destructuring the given tuple. The values of variables whose type cannot be
+// determined are left nil, the typechecker reports any errors.
+func (p *Parser) destructured(v ast.Node, count int) []ast.Node {
+	vals := make([]ast.Node, count)
+	if tn, ok := v.(ast.TupleNode); ok && len(tn.Elems) == count {
+		for i, e := range tn.Elems {
+			vals[i] = e.Node
+		}
+		return vals
+	}
+	t, err := p.TypeOf(v)
+	if err != nil {
+		return vals
+	}
+	tt, ok := types.Unalias(t).(types.TupleType)
+	if !ok || len(tt.Elems) != count {
+		return vals
+	}
+	for i, e := range tt.Elems {
+		vals[i], _ = p.NodeOf(e)
+	}
+	return vals
+}
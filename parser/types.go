@@ -48,34 +48,61 @@ func (p *Parser) typeByName(name string) (t types.Type, ok bool) {
 //
 //	Vec2i
 //
+// Tagged union type (assuming its name is Shape):
+//
+//	Shape
+//
+// Instance of a generic structure or union type (assuming its name is Box):
+//
+//	Box[int]
+//	Box[[str]]
+//
+// Function type, with or without a return type:
+//
+//	fn(int int)/int
+//	fn(str)
+//
 // Array type:
 //
 //	[integer]
 //	[Vec2i]
+//
+// Map type:
+//
+//	{str:int}
+//	[{char:Vec2i}]
+//
+// Tuple type:
+//
+//	(int str)
+//	[(Reader bool)]
 func (p *Parser) parseType() (t types.Type, err error) {
-	tk, err := p.lexer.Next()
+	tk, err := p.nextToken()
 	if err != nil {
 		return
 	}
 	isArray := false
 	if pn, ok := tk.Punct(); ok && pn == lexer.PLBrack {
 		isArray = true
-		tk, err = p.lexer.Next()
+		tk, err = p.nextToken()
 		if err != nil {
 			return
 		}
 	}
-	if tk.Kind != lexer.TIdent {
+	if pn, ok := tk.Punct(); ok && pn == lexer.PLBrace {
+		t, err = p.parseMapType()
+	} else if pn, ok := tk.Punct(); ok && pn == lexer.PLParen {
+		t, err = p.parseTupleType(tk)
+	} else if tk.Kind != lexer.TIdent {
 		err = tokErr(pe.EExpectedName, tk)
-		return
+	} else {
+		t, err = p.namedType(tk)
 	}
-	t, ok := p.typeByName(tk.Raw)
-	if !ok {
-		err = tokErr(pe.EUnknownType, tk)
+	if err != nil {
 		return
 	}
 	if isArray {
-		tk, err = p.lexer.Next()
+		tk, err = p.nextToken()
 		if err != nil {
 			return
 		}
@@ -88,6 +115,61 @@ func (p *Parser) parseType() (t types.Type, err error) {
 	return
 }
 
+// namedType parses the type starting with the given name, which may be a
+// function type or an instance of a generic structure or union type.
+func (p *Parser) namedType(tk *lexer.Token) (t types.Type, err error) {
+	if strings.ToLower(tk.Raw) == "fn" {
+		var lp *lexer.Token
+		lp, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := lp.Punct(); ok && pn == lexer.PLParen {
+			return p.parseFuncType()
+		}
+		p.rollback(lp)
+	}
+	t, ok := p.typeByName(tk.Raw)
+	if !ok {
+		err = tokErr(pe.EUnknownType, tk)
+		return
+	}
+	var params []string
+	switch t := t.(type) {
+	case types.StructType:
+		if t.IsGeneric() {
+			params = t.Params
+		}
+	case types.UnionType:
+		if t.IsGeneric() {
+			params = t.Params
+		}
+	}
+	if params == nil {
+		return
+	}
+	name := tk
+	tk, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tk.Punct(); !ok || pn != lexer.PLBrack {
+		p.rollback(tk)
+		err = typeArgCount(name, len(params), 0)
+		return
+	}
+	args, err := p.parseTypeArgs(params, name)
+	if err != nil {
+		return
+	}
+	if s, ok := t.(types.StructType); ok {
+		t = types.Instantiate(s, args)
+	} else {
+		t = types.InstantiateUnion(t.(types.UnionType), args)
+	}
+	return
+}
+
 // TypeOf determines the type of the value denoted by the given function in
 // the parser's current scope.
 func (p *Parser) TypeOf(n ast.Node) (t types.Type, err error) {
@@ -100,18 +182,76 @@ func (p *Parser) TypeOf(n ast.Node) (t types.Type, err error) {
 		t = types.Float
 	case ast.NChar:
 		t = types.Char
-	case ast.NString:
+	case ast.NString, ast.NInterp:
 		t = types.String
+	case ast.NTuple:
+		tt := types.TupleType{}
+		for _, e := range n.(ast.TupleNode).Elems {
+			var et types.Type
+			et, err = p.TypeOf(e.Node)
+			if err != nil {
+				return
+			}
+			tt.Elems = append(tt.Elems, et)
+		}
+		t = tt
 	case ast.NStruct:
 		t = n.(ast.StructNode).Type
+	case ast.NStructUpdate:
+		t = n.(ast.StructUpdateNode).Type
+	case ast.NVariant:
+		t = n.(ast.VariantNode).Type
+	case ast.NTry:
+		var rt types.Type
+		rt, err = p.TypeOf(n.(ast.TryNode).Value.Node)
+		if err != nil {
+			return
+		}
+		var ok bool
+		if t, ok = types.IsResult(rt); !ok {
+			err = fmt.Errorf("can only propagate results (you are propagating %s)", rt)
+		}
 	case ast.NFuncCall:
-		fn := n.(ast.FuncCallNode).Func
-		f, ok := p.Tree.Funcs[fn]
+		fc := n.(ast.FuncCallNode)
+		f, ok := p.Tree.Funcs[fc.Func]
 		if !ok {
-			err = fmt.Errorf("unknown function: %s", fn)
+			if v, ok := p.Scope.FindVar(fc.Func); ok && v != nil {
+				if vt, verr := p.TypeOf(v); verr == nil && vt.Prim() == types.PFunc {
+					return types.Unalias(vt).(types.FuncType).Ret, nil
+				}
+			}
+			err = fmt.Errorf("unknown function: %s", fc.Func)
 			return
 		}
 		t = f.Ret
+		if len(f.Params) > 0 {
+			t = p.instantiateCall(f, fc.Args)
+		}
+	case ast.NMethodCall:
+		mc := n.(ast.MethodCallNode)
+		m, ok := p.Tree.Methods[mc.Type][mc.Method]
+		if !ok {
+			err = fmt.Errorf("unknown method: %s#%s", mc.Type, mc.Method)
+			return
+		}
+		t = m.Ret
+		if len(m.Params) > 0 {
+			t = p.instantiateCall(m, append([]ast.MetaNode{mc.Recv}, mc.Args...))
+		}
+	case ast.NFuncRef:
+		f, ok := p.Tree.Funcs[n.(ast.FuncRefNode).Func]
+		if !ok {
+			err = fmt.Errorf("unknown function: %s", n.(ast.FuncRefNode).Func)
+			return
+		}
+		t = funcType(f)
+	case ast.NLambda:
+		l := n.(ast.LambdaNode)
+		ft := types.FuncType{Args: make([]types.Type, len(l.Proto)), Ret: l.Ret}
+		for i, a := range l.Proto {
+			ft.Args[i] = a.Type
+		}
+		t = ft
 	case ast.NSelector:
 		s := n.(ast.SelectorNode)
 		path := s.Path()
@@ -135,6 +275,10 @@ func (p *Parser) TypeOf(n ast.Node) (t types.Type, err error) {
 			err = fmt.Errorf("unknown variable: %s", root.Name)
 			return
 		}
+		if v == nil {
+			err = fmt.Errorf("type of variable %s is unknown", root.Name)
+			return
+		}
 
 		// set the type to the variable's type (if it is found) and return if it is
 		// the only element of the path
@@ -163,6 +307,17 @@ func (p *Parser) TypeOf(n ast.Node) (t types.Type, err error) {
 			}
 			// field selection because the Name is not empty
 			if e.Name != "" {
+				// selecting a variant of a union results in the variant's payload,
+				// if the union value is that variant
+				if u, ok := types.Unalias(t).(types.UnionType); ok {
+					vt, ok := u.Variant(e.Name)
+					if !ok {
+						err = fmt.Errorf("%s does not contain variant '%s'", t.String(), e.Name)
+						return
+					}
+					t = types.Result(vt)
+					continue
+				}
 				// make sure we are selecting fields on a structure
 				if t.Prim() != types.PStruct {
 					err = fmt.Errorf("can only select fields on structures (you are selecting field '%s' on %s)", e.Name, t.String())
@@ -170,7 +325,7 @@ func (p *Parser) TypeOf(n ast.Node) (t types.Type, err error) {
 				}
 				// now, ensure the structure contains the given field and update our
 				// current type accordingly
-				s := t.(types.StructType)
+				s := types.Unalias(t).(types.StructType)
 				ok := false
 				for _, f := range s.Fields {
 					if f.Name == e.Name {
@@ -187,49 +342,51 @@ func (p *Parser) TypeOf(n ast.Node) (t types.Type, err error) {
 				// otherwise we can just move on to the next element (or exit the loop)
 				continue
 			}
-			// finally, if neither are specified, process array index
+			// finally, if neither are specified, process array or string index
+			if types.String.Equals(t) {
+				t = types.Result(types.Char)
+				continue
+			}
 			if t.Prim() != types.PArray {
 				err = fmt.Errorf("can only index arrays")
 				return
 			}
 			// return a result type for the array's element type (because s a f e t y)
-			a := t.(types.ArrayType)
+			a := types.Unalias(t).(types.ArrayType)
 			t = types.Result(a.Element)
 		}
 	case ast.NTypecast:
 		return n.(ast.TypecastNode).Cast, nil
 	case ast.NArray:
 		return n.(ast.ArrayNode).Type, nil
+	case ast.NMap:
+		return n.(ast.MapNode).Type, nil
 	case ast.NIndexSelector:
 		i := n.(ast.IndexSelectorNode)
 		ptype, err := p.TypeOf(i.Parent)
 		if err != nil {
 			return nil, err
 		}
+		if types.String.Equals(ptype) {
+			return types.Result(types.Char), nil
+		}
 		if ptype.Prim() != types.PArray {
 			return nil, fmt.Errorf("cannot index %s value", ptype.String())
 		}
-		atype := ptype.(types.ArrayType)
-		rtype := types.MakeStruct(atype.Element.String()+"Result",
-			"val", atype.Element,
-			"ok", types.Bool)
-		p.Scope.Types[rtype.(types.StructType).Name] = rtype
-		return rtype, nil
+		return types.Result(types.Unalias(ptype).(types.ArrayType).Element), nil
 	case ast.NIndexConst:
 		i := n.(ast.IndexConstNode)
 		ptype, err := p.TypeOf(i.Parent)
 		if err != nil {
 			return nil, err
 		}
+		if types.String.Equals(ptype) {
+			return types.Result(types.Char), nil
+		}
 		if ptype.Prim() != types.PArray {
 			return nil, fmt.Errorf("cannot index %s value", ptype.String())
 		}
-		atype := ptype.(types.ArrayType)
-		rtype := types.MakeStruct(atype.Element.String()+"Result",
-			"val", atype.Element,
-			"ok", types.Bool)
-		p.Scope.Types[rtype.(types.StructType).Name] = rtype
-		return rtype, nil
+		return types.Result(types.Unalias(ptype).(types.ArrayType).Element), nil
 	default:
 		err = fmt.Errorf("%s node is not a value", n.Kind())
 	}
@@ -252,11 +409,35 @@ func (p *Parser) NodeOf(t types.Type) (n ast.Node, ok bool) {
 		n = ast.StringNode{}
 	} else if t.Prim() == types.PArray {
 		n = ast.ArrayNode{
-			Type: t.(types.ArrayType),
+			Type: types.Unalias(t).(types.ArrayType),
 		}
 	} else if t.Prim() == types.PStruct {
 		n = ast.StructNode{
-			Type: t.(types.StructType),
+			Type: types.Unalias(t).(types.StructType),
+		}
+	} else if t.Prim() == types.PMap {
+		n = ast.MapNode{
+			Type: types.Unalias(t).(types.MapType),
+		}
+	} else if t.Prim() == types.PUnion {
+		n = ast.VariantNode{
+			Type: types.Unalias(t).(types.UnionType),
+		}
+	} else if t.Prim() == types.PTuple {
+		elems := types.Unalias(t).(types.TupleType).Elems
+		tn := ast.TupleNode{
+			Elems: make([]ast.MetaNode, len(elems)),
+		}
+		for i, e := range elems {
+			if tn.Elems[i].Node, ok = p.NodeOf(e); !ok {
+				return
+			}
+		}
+		n = tn
+	} else if t.Prim() == types.PParam || t.Prim() == types.PFunc {
+		// the value of a type parameter or function can only be known by it's type
+		n = ast.TypecastNode{
+			Cast: t,
 		}
 	} else {
 		ok = false
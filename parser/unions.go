@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/lexer"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// parseUnion parses the variants of a tagged union type definition, after the
+// question mark following its name and type parameters. Variants without a
+// type do not carry a payload. The union is registered in the given scope.
+//
+//	@Shape?(Circle/float Rect/Vec2f Empty)
+//	       ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^
+func (p *Parser) parseUnion(scope *Scope, name string, params []string) (n ast.Node, err error) {
+	var variants []types.Descriptor
+
+	tok, err := p.nextToken()
+	if err != nil {
+		return
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PLParen {
+		err = tokErr(pe.EExpectedLParen, tok)
+		return
+	}
+
+	for {
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
+			break
+		}
+		if tok.Kind != lexer.TIdent {
+			err = tokErr(pe.EExpectedName, tok)
+			return
+		}
+		v := types.Descriptor{Name: tok.Raw, Type: types.Nothing}
+
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+		if pn, ok := tok.Punct(); ok && pn == lexer.PType {
+			v.Type, err = p.parseType()
+			if err != nil {
+				return
+			}
+		} else {
+			p.rollback(tok)
+		}
+		variants = append(variants, v)
+	}
+
+	if len(variants) == 0 {
+		err = pe.New(pe.EExpectedName).Section("Reason", "Unions need at least one variant")
+		return
+	}
+
+	scope.Types[name] = types.UnionType{
+		Name:     name,
+		Params:   params,
+		Variants: variants,
+	}
+	n = ast.UnionDefNode{
+		Name:     name,
+		Params:   params,
+		Variants: variants,
+	}
+	return
+}
+
+// parseVariant parses a tagged union literal, after the name of the union. The
+// type arguments of a generic union are inferred from the payload, unless they
+// are given explicitly. If the type of the payload cannot be determined by the
+// parser, the union is left generic and the type arguments are inferred by the
+// typechecker instead.
+//
+//	@Shape#Circle 1.5
+//	@Option[int]#None
+//	      ^^^^^^^^^^^
+func (p *Parser) parseVariant(u types.UnionType, name *lexer.Token) (n ast.Node, err error) {
+	var (
+		tok      *lexer.Token
+		explicit bool
+		value    ast.MetaNode
+	)
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	// like with structures, type arguments have to directly follow the name
+	if pn, ok := tok.Punct(); ok && pn == lexer.PLBrack && u.IsGeneric() && tok.Where.Start.Offset == name.Where.End.Offset {
+		var args []types.Type
+		args, err = p.parseTypeArgs(u.Params, name)
+		if err != nil {
+			return
+		}
+		u = types.InstantiateUnion(u, args)
+		explicit = true
+		tok, err = p.nextToken()
+		if err != nil {
+			return
+		}
+	}
+	if pn, ok := tok.Punct(); !ok || pn != lexer.PField {
+		err = tokErr(pe.EExpectedSelectorElem, tok)
+		return
+	}
+
+	tok, err = p.nextToken()
+	if err != nil {
+		return
+	}
+	if tok.Kind != lexer.TIdent {
+		err = tokErr(pe.EExpectedName, tok)
+		return
+	}
+	variant := tok
+	vt, ok := u.Variant(variant.Raw)
+	if !ok {
+		err = tokErr(pe.EUnknownVariant, variant).Section("Union", "%s", u)
+		return
+	}
+
+	if vt.Prim() != types.PNothing {
+		value, err = p.ParseValue()
+		if err != nil {
+			return
+		}
+	}
+
+	if u.IsGeneric() && !explicit {
+		u, err = p.inferUnion(u, vt, value, name)
+		if err != nil {
+			return
+		}
+	}
+
+	n = ast.VariantNode{
+		Type:    u,
+		Variant: variant.Raw,
+		Value:   value,
+	}
+	return
+}
+
+// inferUnion determines the type arguments of a generic union from the payload
+// of one of its variants. See [Parser.parseVariant].
+func (p *Parser) inferUnion(u types.UnionType, vt types.Type, value ast.MetaNode, name *lexer.Token) (inst types.UnionType, err error) {
+	bound := make(map[string]types.Type)
+	if value.Node != nil {
+		t, terr := p.TypeOf(value.Node)
+		if terr != nil {
+			// leave it for the typechecker
+			return u, nil
+		}
+		if !types.Infer(vt, t, bound) {
+			err = nodeErr(pe.ECannotInferType, value).Section("Union", "%s", u)
+			return
+		}
+	}
+	args := make([]types.Type, len(u.Params))
+	for i, param := range u.Params {
+		t, ok := bound[param]
+		if !ok {
+			err = tokErr(pe.ECannotInferType, name).Section("Type parameter", param)
+			return
+		}
+		args[i] = t
+	}
+	inst = types.InstantiateUnion(u, args)
+	return
+}
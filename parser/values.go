@@ -3,6 +3,7 @@ package parser
 import (
 	"errors"
 	"io"
+	"unicode/utf8"
 
 	"github.com/syzkrash/skol/ast"
 	"github.com/syzkrash/skol/common/pe"
@@ -29,17 +30,58 @@ import (
 //
 //	"Hello world"  "hi\nthere"  "how\tare\tyou?"
 //
+// Interpolated string literal:
+//
+//	"Hello \{Name}!"  "\{X}, \{Y}"
+//
 // Structure literal:
 //
 //	@Vec2i(12 34)
 //	@Vec3f(1.23 4.56 7.68)
 //
+// Generic structure literal, with inferred or explicit type arguments:
+//
+//	@Box 123
+//	@Box[float] 1.0
+//
+// Tagged union literal, with inferred or explicit type arguments:
+//
+//	@Shape#Circle 1.5
+//	@Shape#Empty
+//	@Option#Some 123
+//	@Option[int]#None
+//
 // Array literal:
 //
 //	[int](0 1 2 3 4 5 6 7 8 9)
 //	   [](0.1 2.3 4.5 6.7 8.9)
 //	[string]()
 //
+// Tuple literal:
+//
+//	(1 "one")
+//	(State * Row)
+//
+// Map literal:
+//
+//	{str:int}("one": 1 "two": 2)
+//	       {}('a': "A" 'b': "B")
+//	{int:str}()
+//
+// Function reference:
+//
+//	$Add
+//
+// Propagated result:
+//
+//	^int! S
+//	^Reader#Next!
+//
+// Anonymous function:
+//
+//	$(A/int B/int)/int(> add! A B)
+//	$(A/int B/int)/int: add! A B
+//
 // Any selector:
 //
 //	Someone
@@ -53,14 +95,28 @@ import (
 //	DontDoAnything!
 //	Say! MyName
 //	add_i! 12 34
+//
+// Call of a variable holding a function:
+//
+//	Callback! 12
+//
+// Method call:
+//
+//	Reader#GetChar!
+//	People#0#Greet! MyName
 func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
-	tok, err := p.lexer.Next()
+	tok, err := p.nextToken()
 	if err != nil {
 		return
 	}
 
-	mn.Where = tok.Where
+	mn.Node, err = p.value(tok)
+	mn.Where = p.span(tok)
+	return
+}
 
+// value parses the value starting with the given token. See [ParseValue].
+func (p *Parser) value(tok *lexer.Token) (n ast.Node, err error) {
 	switch tok.Kind {
 	case lexer.TInt:
 		i, ok := tok.Int()
@@ -69,7 +125,7 @@ func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
 			return
 		}
 
-		mn.Node = ast.IntNode{
+		n = ast.IntNode{
 			Value: i,
 		}
 	case lexer.TFloat:
@@ -79,20 +135,23 @@ func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
 			return
 		}
 
-		mn.Node = ast.FloatNode{
+		n = ast.FloatNode{
 			Value: f,
 		}
 	case lexer.TString:
-		mn.Node = ast.StringNode{
+		n = ast.StringNode{
 			Value: tok.Raw,
 		}
+	case lexer.TStringHead:
+		n, err = p.parseInterp(tok)
 	case lexer.TChar:
-		mn.Node = ast.CharNode{
-			Value: tok.Raw[0],
+		c, _ := utf8.DecodeRuneInString(tok.Raw)
+		n = ast.CharNode{
+			Value: c,
 		}
 	case lexer.TIdent:
 		var maybeBang *lexer.Token
-		maybeBang, err = p.lexer.Next()
+		maybeBang, err = p.nextToken()
 		if errors.Is(err, io.EOF) {
 			goto checkIdent
 		}
@@ -100,29 +159,25 @@ func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
 			return
 		}
 		if pn, ok := maybeBang.Punct(); ok && pn == lexer.PExecute {
-			fn := tok.Raw
 			var argc int
-			f, ok := p.Tree.Funcs[fn]
-			if !ok {
-				bf, ok := builtins[fn]
-				if !ok {
-					err = tokErr(pe.EUnknownFunction, tok)
-					return
-				}
-				argc = bf.ArgCount
-			} else {
-				argc = len(f.Args)
+			argc, err = p.argCount(tok)
+			if err != nil {
+				return
 			}
-			mn.Node, err = p.parseCall(fn, argc, tok.Where)
+			n, err = p.parseCall(tok.Raw, argc, tok.Where)
 			return
 		}
-		p.lexer.Rollback(maybeBang)
+		p.rollback(maybeBang)
 
 	checkIdent:
 		if _, ok := p.Scope.FindVar(tok.Raw); ok {
-			mn.Node, err = p.parseSelector(tok)
+			n, err = p.parseSelector(tok)
+			if err != nil {
+				return
+			}
+			n, err = p.parseMethodCall(tok, n)
 		} else if v, ok := p.Scope.FindConst(tok.Raw); ok {
-			mn.Node = v
+			n = v
 		} else {
 			err = tokErr(pe.EUnknownVariable, tok)
 		}
@@ -130,15 +185,27 @@ func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
 		pn, _ := tok.Punct()
 		switch pn {
 		case lexer.PLoop:
-			mn.Node = ast.BoolNode{
+			n = ast.BoolNode{
 				Value: true,
 			}
 		case lexer.PType:
-			mn.Node = ast.BoolNode{
+			n = ast.BoolNode{
 				Value: false,
 			}
+		case lexer.PFunc:
+			tok, err = p.nextToken()
+			if err != nil {
+				return
+			}
+			if pn, ok := tok.Punct(); ok && pn == lexer.PLParen {
+				n, err = p.parseLambda()
+			} else if tok.Kind == lexer.TIdent {
+				n, err = p.parseFuncRef(tok)
+			} else {
+				err = tokErr(pe.EExpectedName, tok)
+			}
 		case lexer.PStruct:
-			tok, err = p.lexer.Next()
+			tok, err = p.nextToken()
 			if err != nil {
 				return
 			}
@@ -151,34 +218,81 @@ func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
 				err = tokErr(pe.EUnknownType, tok)
 				return
 			}
-			s := t.(types.StructType)
+			if u, ok := types.Unalias(t).(types.UnionType); ok {
+				n, err = p.parseVariant(u, tok)
+				return
+			}
+			s := types.Unalias(t).(types.StructType)
+			name := tok
+			explicit := false
+			if s.IsGeneric() {
+				// type arguments have to directly follow the name, otherwise they
+				// could be confused with an array value
+				tok, err = p.nextToken()
+				if err != nil {
+					return
+				}
+				if pn, ok := tok.Punct(); ok && pn == lexer.PLBrack && tok.Where.Start.Offset == name.Where.End.Offset {
+					var args []types.Type
+					args, err = p.parseTypeArgs(s.Params, name)
+					if err != nil {
+						return
+					}
+					s = types.Instantiate(s, args)
+					explicit = true
+				} else {
+					p.rollback(tok)
+				}
+			}
+			if len(s.Fields) > 0 {
+				// named fields have to directly follow the name or type arguments,
+				// otherwise they could be confused with a block
+				end := p.lexer.End()
+				tok, err = p.nextToken()
+				if err != nil {
+					return
+				}
+				if pn, ok := tok.Punct(); ok && pn == lexer.PLParen && tok.Where.Start.Offset == end.Offset {
+					n, err = p.parseNamedStruct(s, name, explicit)
+					return
+				}
+				p.rollback(tok)
+			}
 			args := make([]ast.MetaNode, len(s.Fields))
 			for i := range s.Fields {
-				mn, err = p.ParseValue()
+				args[i], err = p.ParseValue()
 				if err != nil {
 					return
 				}
-				args[i] = mn
+				if i == 0 && p.isUpdate(s, args[0]) {
+					n, err = p.parseStructUpdate(s, args[0])
+					return
+				}
 			}
-			mn.Node = ast.StructNode{
+			if s.IsGeneric() && !explicit {
+				s, err = p.inferStruct(s, args, name)
+				if err != nil {
+					return
+				}
+			}
+			n = ast.StructNode{
 				Type: s,
 				Args: args,
 			}
 		case lexer.PLBrack:
 			begin := tok
 			var elemtype types.Type = types.Undefined
-			tok, err = p.lexer.Next()
+			tok, err = p.nextToken()
 			if err != nil {
 				return
 			}
-			if tok.Kind == lexer.TIdent {
-				var ok bool
-				elemtype, ok = p.typeByName(tok.Raw)
-				if !ok {
-					err = tokErr(pe.EUnknownType, tok)
+			if pn, ok := tok.Punct(); !ok || pn != lexer.PRBrack {
+				p.rollback(tok)
+				elemtype, err = p.parseType()
+				if err != nil {
 					return
 				}
-				tok, err = p.lexer.Next()
+				tok, err = p.nextToken()
 				if err != nil {
 					return
 				}
@@ -187,7 +301,7 @@ func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
 				err = tokErr(pe.EExpectedType, tok)
 				return
 			}
-			tok, err = p.lexer.Next()
+			tok, err = p.nextToken()
 			if err != nil {
 				return
 			}
@@ -198,14 +312,14 @@ func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
 			elems := []ast.MetaNode{}
 			var elem ast.MetaNode
 			for {
-				tok, err = p.lexer.Next()
+				tok, err = p.nextToken()
 				if err != nil {
 					return
 				}
 				if pn, ok := tok.Punct(); ok && pn == lexer.PRParen {
 					break
 				} else {
-					p.lexer.Rollback(tok)
+					p.rollback(tok)
 				}
 				elem, err = p.ParseValue()
 				if err != nil {
@@ -223,10 +337,21 @@ func (p *Parser) ParseValue() (mn ast.MetaNode, err error) {
 				err = tokErr(pe.ENeedTypeOrValue, begin)
 				return
 			}
-			mn.Node = ast.ArrayNode{
+			n = ast.ArrayNode{
 				Type:  types.ArrayType{Element: elemtype},
 				Elems: elems,
 			}
+		case lexer.PLBrace:
+			n, err = p.parseMap(tok)
+		case lexer.PLParen:
+			n, err = p.parseTuple(tok)
+		case lexer.PTry:
+			n, err = p.parseTry()
+		case lexer.PRParen:
+			// leave the parenthesis for the enclosing block, so that it can still
+			// be closed after this error
+			p.rollback(tok)
+			err = tokErr(pe.EUnexpectedToken, tok)
 		default:
 			err = tokErr(pe.EUnexpectedToken, tok)
 		}
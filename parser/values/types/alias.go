@@ -0,0 +1,35 @@
+package types
+
+// AliasType gives another name to an existing type. Aliases are transparent:
+// an alias has the primitive of the type it stands for and is compatible with
+// everything that type is compatible with, so an Offset aliasing Int can be
+// used wherever an Int can and vice versa. The name is only kept for error
+// messages and generated code.
+type AliasType struct {
+	Name string
+	Type Type
+}
+
+func (a AliasType) Prim() Primitive {
+	return a.Type.Prim()
+}
+
+func (a AliasType) Equals(b Type) bool {
+	return a.Type.Equals(b)
+}
+
+func (a AliasType) String() string {
+	return a.Name + " (" + a.Type.String() + ")"
+}
+
+// Unalias returns the type the given type stands for, looking through any
+// amount of aliases. Other types are returned as is.
+func Unalias(t Type) Type {
+	for {
+		a, ok := t.(AliasType)
+		if !ok {
+			return t
+		}
+		t = a.Type
+	}
+}
@@ -12,7 +12,7 @@ func (a ArrayType) Equals(b Type) bool {
 	if b.Prim() != PArray {
 		return false
 	}
-	return a.Element.Equals(b.(ArrayType).Element)
+	return a.Element.Equals(Unalias(b).(ArrayType).Element)
 }
 
 func (t ArrayType) String() string {
@@ -9,6 +9,23 @@
 // [ArrayType]s always have the [PArray] primitive and are distinguished by
 // the type of their elements.
 //
+// [MapType]s always have the [PMap] primitive and are distinguished by the
+// types of their keys and values.
+//
+// [FuncType]s always have the [PFunc] primitive and are distinguished by the
+// types of their arguments and their return type.
+//
+// [UnionType]s always have the [PUnion] primitive and are distinguished by their
+// name and type arguments.
+//
+// A [ParamType] is a type parameter of a generic function or structure. It is
+// only compatible with itself, and is replaced with an actual type wherever the
+// function or structure is used. See [Subst] and [Infer].
+//
+// An [AliasType] is another name for an existing type. It has the primitive of
+// that type and is compatible with everything that type is compatible with. See
+// [Unalias].
+//
 // The [AnyType] always has the [PAny] primitive and is compatible with any
 // other type. Because of this it is only allowed under strict conditions.
 // (e.g. in builtin functions and external functions)
@@ -0,0 +1,46 @@
+package types
+
+import "strings"
+
+// FuncType represents all function values with the primitive [PFunc]. A
+// function type is compatible with another function type if it takes the same
+// arguments and returns the same type.
+type FuncType struct {
+	Args []Type
+	Ret  Type
+}
+
+func (FuncType) Prim() Primitive {
+	return PFunc
+}
+
+func (a FuncType) Equals(b Type) bool {
+	if b.Prim() != PFunc {
+		return false
+	}
+	bf := Unalias(b).(FuncType)
+	if len(a.Args) != len(bf.Args) {
+		return false
+	}
+	for i, t := range a.Args {
+		if !t.Equals(bf.Args[i]) {
+			return false
+		}
+	}
+	if a.Ret.Prim() == PNothing {
+		return bf.Ret.Prim() == PNothing
+	}
+	return a.Ret.Equals(bf.Ret)
+}
+
+func (t FuncType) String() string {
+	args := make([]string, len(t.Args))
+	for i, a := range t.Args {
+		args[i] = a.String()
+	}
+	s := "Function(" + strings.Join(args, " ") + ")"
+	if t.Ret.Prim() != PNothing {
+		s += " " + t.Ret.String()
+	}
+	return s
+}
@@ -0,0 +1,226 @@
+package types
+
+import "strings"
+
+// ParamType is a type parameter of a generic function or structure. It is only
+// compatible with the same type parameter and is replaced with an actual type
+// once the function or structure is used, see [Subst].
+type ParamType struct {
+	Name string
+}
+
+func (ParamType) Prim() Primitive {
+	return PParam
+}
+
+func (t ParamType) Equals(b Type) bool {
+	if b.Prim() != PParam {
+		return false
+	}
+	return Unalias(b).(ParamType).Name == t.Name
+}
+
+func (t ParamType) String() string {
+	return t.Name
+}
+
+// typeList formats the given type arguments like they are written in code
+func typeList(ts []Type) string {
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = t.String()
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+// Subst replaces the type parameters within the given type with the types they
+// are bound to. Unbound type parameters are kept.
+func Subst(t Type, bound map[string]Type) Type {
+	if len(bound) == 0 {
+		return t
+	}
+	switch t := t.(type) {
+	case ParamType:
+		if b, ok := bound[t.Name]; ok {
+			return b
+		}
+	case ArrayType:
+		return ArrayType{Element: Subst(t.Element, bound)}
+	case StructType:
+		s := StructType{
+			Name:   t.Name,
+			Params: t.Params,
+			Fields: make([]Descriptor, len(t.Fields)),
+		}
+		for i, f := range t.Fields {
+			s.Fields[i] = Descriptor{Name: f.Name, Type: Subst(f.Type, bound)}
+		}
+		if t.Args != nil {
+			s.Args = make([]Type, len(t.Args))
+			for i, a := range t.Args {
+				s.Args[i] = Subst(a, bound)
+			}
+		}
+		return s
+	case UnionType:
+		u := UnionType{
+			Name:     t.Name,
+			Params:   t.Params,
+			Variants: make([]Descriptor, len(t.Variants)),
+		}
+		for i, v := range t.Variants {
+			u.Variants[i] = Descriptor{Name: v.Name, Type: Subst(v.Type, bound)}
+		}
+		if t.Args != nil {
+			u.Args = make([]Type, len(t.Args))
+			for i, a := range t.Args {
+				u.Args[i] = Subst(a, bound)
+			}
+		}
+		return u
+	case MapType:
+		return MapType{Key: Subst(t.Key, bound), Value: Subst(t.Value, bound)}
+	case FuncType:
+		f := FuncType{Args: make([]Type, len(t.Args)), Ret: Subst(t.Ret, bound)}
+		for i, a := range t.Args {
+			f.Args[i] = Subst(a, bound)
+		}
+		return f
+	case TupleType:
+		tt := TupleType{Elems: make([]Type, len(t.Elems))}
+		for i, e := range t.Elems {
+			tt.Elems[i] = Subst(e, bound)
+		}
+		return tt
+	}
+	return t
+}
+
+// Instantiate creates an instance of a generic structure with the given type
+// arguments, which must match the structure's type parameters in amount.
+func Instantiate(s StructType, args []Type) StructType {
+	bound := make(map[string]Type, len(args))
+	for i, p := range s.Params {
+		bound[p] = args[i]
+	}
+	i := Subst(s, bound).(StructType)
+	i.Args = args
+	return i
+}
+
+// InstantiateUnion creates an instance of a generic union with the given type
+// arguments, which must match the union's type parameters in amount.
+func InstantiateUnion(u UnionType, args []Type) UnionType {
+	bound := make(map[string]Type, len(args))
+	for i, p := range u.Params {
+		bound[p] = args[i]
+	}
+	i := Subst(u, bound).(UnionType)
+	i.Args = args
+	return i
+}
+
+// Infer binds the type parameters within want to the matching parts of got,
+// adding them to bound. It returns false if got is not compatible with want,
+// including when a type parameter would have to be bound to two different
+// types.
+func Infer(want, got Type, bound map[string]Type) bool {
+	got = Unalias(got)
+	switch w := want.(type) {
+	case AliasType:
+		return Infer(w.Type, got, bound)
+	case ParamType:
+		if b, ok := bound[w.Name]; ok {
+			return b.Equals(got)
+		}
+		bound[w.Name] = got
+		return true
+	case ArrayType:
+		if got.Prim() != PArray {
+			return false
+		}
+		return Infer(w.Element, got.(ArrayType).Element, bound)
+	case StructType:
+		if got.Prim() != PStruct {
+			return false
+		}
+		g := got.(StructType)
+		for _, f := range w.Fields {
+			gt, ok := g.FieldType(f.Name)
+			if !ok || !Infer(f.Type, gt, bound) {
+				return false
+			}
+		}
+		return true
+	case UnionType:
+		if got.Prim() != PUnion {
+			return false
+		}
+		g := got.(UnionType)
+		if w.Name != g.Name {
+			return false
+		}
+		if w.Args != nil && g.Args != nil {
+			if len(w.Args) != len(g.Args) {
+				return false
+			}
+			for i, a := range w.Args {
+				if !Infer(a, g.Args[i], bound) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, v := range w.Variants {
+			gt, ok := g.Variant(v.Name)
+			if !ok {
+				return false
+			}
+			if v.Type.Prim() == PNothing {
+				continue
+			}
+			if !Infer(v.Type, gt, bound) {
+				return false
+			}
+		}
+		return true
+	case MapType:
+		if got.Prim() != PMap {
+			return false
+		}
+		g := got.(MapType)
+		return Infer(w.Key, g.Key, bound) && Infer(w.Value, g.Value, bound)
+	case FuncType:
+		if got.Prim() != PFunc {
+			return false
+		}
+		g := got.(FuncType)
+		if len(w.Args) != len(g.Args) {
+			return false
+		}
+		for i, a := range w.Args {
+			if !Infer(a, g.Args[i], bound) {
+				return false
+			}
+		}
+		if w.Ret.Prim() == PNothing {
+			return g.Ret.Prim() == PNothing
+		}
+		return Infer(w.Ret, g.Ret, bound)
+	case TupleType:
+		if got.Prim() != PTuple {
+			return false
+		}
+		g := got.(TupleType)
+		if len(w.Elems) != len(g.Elems) {
+			return false
+		}
+		for i, e := range w.Elems {
+			if !Infer(e, g.Elems[i], bound) {
+				return false
+			}
+		}
+		return true
+	}
+	return want.Equals(got)
+}
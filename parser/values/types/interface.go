@@ -15,6 +15,14 @@ const (
 	PAny
 	PNothing
 	PUndefined
+	PParam
+	PFunc
+	PUnion
+	PMap
+	// PAlias is never returned by [Type.Prim], as aliases have the primitive of
+	// the type they stand for. It only marks aliases in encoded ASTs.
+	PAlias
+	PTuple
 )
 
 // Type represents a Skol type.
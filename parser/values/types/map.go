@@ -0,0 +1,36 @@
+package types
+
+// MapType represents all maps with the primitive [PMap]. A map type is
+// compatible with another map type if both their key and value types are
+// compatible.
+type MapType struct {
+	Key   Type
+	Value Type
+}
+
+func (MapType) Prim() Primitive {
+	return PMap
+}
+
+func (a MapType) Equals(b Type) bool {
+	if b.Prim() != PMap {
+		return false
+	}
+	bm := Unalias(b).(MapType)
+	return a.Key.Equals(bm.Key) && a.Value.Equals(bm.Value)
+}
+
+func (t MapType) String() string {
+	return "Map of " + t.Key.String() + " to " + t.Value.String()
+}
+
+// IsKey returns true if values of the given type can be used as map keys. Only
+// primitive types can be keys.
+func IsKey(t Type) bool {
+	switch t.Prim() {
+	case PBool, PChar, PInt, PFloat, PString:
+		return true
+	default:
+		return false
+	}
+}
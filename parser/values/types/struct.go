@@ -1,15 +1,35 @@
 package types
 
+import "strings"
+
 // StructType represents all structure types with the primtive [PStruct].
+//
+// A generic structure has type parameters, which its fields may refer to. An
+// instance of a generic structure also has the type arguments it was created
+// with, and its fields have the parameters replaced with the arguments.
 type StructType struct {
 	Name   string
+	Params []string
+	Args   []Type
 	Fields []Descriptor
 }
 
 func (s StructType) String() string {
+	switch {
+	case s.Args != nil:
+		return "Structure " + s.Name + typeList(s.Args)
+	case len(s.Params) > 0:
+		return "Structure " + s.Name + "[" + strings.Join(s.Params, " ") + "]"
+	}
 	return "Structure " + s.Name
 }
 
+// IsGeneric checks if this is a generic structure which has not been
+// instantiated yet.
+func (s StructType) IsGeneric() bool {
+	return len(s.Params) > 0 && s.Args == nil
+}
+
 func (StructType) Prim() Primitive {
 	return PStruct
 }
@@ -30,7 +50,7 @@ func (a StructType) Equals(b Type) bool {
 	if b.Prim() != PStruct {
 		return false
 	}
-	bs := b.(StructType)
+	bs := Unalias(b).(StructType)
 	bf := map[string]Type{}
 	for _, f := range bs.Fields {
 		bf[f.Name] = f.Type
@@ -65,7 +85,29 @@ func MakeStruct(name string, fields ...any) Type {
 	}
 }
 
+// ResultStruct is the built-in generic Result structure. A result is only ok if
+// it holds a value. Indexes, union variant selections and some builtins result
+// in instances of it, and it can be used like any other generic structure.
+var ResultStruct = StructType{
+	Name:   "Result",
+	Params: []string{"T"},
+	Fields: []Descriptor{
+		{Name: "ok", Type: Bool},
+		{Name: "value", Type: ParamType{Name: "T"}},
+	},
+}
+
 // Result makes a result type wrapping the given type
 func Result(t Type) Type {
-	return MakeStruct(t.String()+"Result", "ok", Bool, "value", t)
+	return Instantiate(ResultStruct, []Type{t})
+}
+
+// IsResult checks if the given type is an instance of the [ResultStruct],
+// returning the type of the value it holds.
+func IsResult(t Type) (Type, bool) {
+	s, ok := Unalias(t).(StructType)
+	if !ok || s.Name != ResultStruct.Name || len(s.Args) != 1 {
+		return nil, false
+	}
+	return s.Args[0], true
 }
@@ -0,0 +1,38 @@
+package types
+
+import "strings"
+
+// TupleType represents all tuples with the primitive [PTuple]. A tuple type is
+// compatible with another tuple type if it has the same amount of elements and
+// every element is compatible with the element at the same position.
+type TupleType struct {
+	Elems []Type
+}
+
+func (TupleType) Prim() Primitive {
+	return PTuple
+}
+
+func (a TupleType) Equals(b Type) bool {
+	if b.Prim() != PTuple {
+		return false
+	}
+	bt := Unalias(b).(TupleType)
+	if len(a.Elems) != len(bt.Elems) {
+		return false
+	}
+	for i, e := range a.Elems {
+		if !e.Equals(bt.Elems[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t TupleType) String() string {
+	elems := make([]string, len(t.Elems))
+	for i, e := range t.Elems {
+		elems[i] = e.String()
+	}
+	return "Tuple(" + strings.Join(elems, " ") + ")"
+}
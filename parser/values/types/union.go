@@ -0,0 +1,78 @@
+package types
+
+import "strings"
+
+// UnionType represents all tagged union types with the primitive [PUnion]. A
+// value of a union type is exactly one of its variants, each of which may carry
+// a payload. Variants without a payload have the [Nothing] type.
+//
+// Unlike structures, unions are only compatible with unions of the same name
+// and type arguments.
+type UnionType struct {
+	Name     string
+	Params   []string
+	Args     []Type
+	Variants []Descriptor
+}
+
+func (UnionType) Prim() Primitive {
+	return PUnion
+}
+
+func (a UnionType) Equals(b Type) bool {
+	if b.Prim() != PUnion {
+		return false
+	}
+	bu := Unalias(b).(UnionType)
+	if a.Name != bu.Name || len(a.Args) != len(bu.Args) {
+		return false
+	}
+	for i, t := range a.Args {
+		if !t.Equals(bu.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (u UnionType) String() string {
+	switch {
+	case u.Args != nil:
+		return "Union " + u.Name + typeList(u.Args)
+	case len(u.Params) > 0:
+		return "Union " + u.Name + "[" + strings.Join(u.Params, " ") + "]"
+	}
+	return "Union " + u.Name
+}
+
+// IsGeneric checks if this is a generic union which has not been instantiated
+// yet.
+func (u UnionType) IsGeneric() bool {
+	return len(u.Params) > 0 && u.Args == nil
+}
+
+// Variant returns the payload type of the variant with the given name.
+func (u UnionType) Variant(name string) (Type, bool) {
+	for _, v := range u.Variants {
+		if v.Name == name {
+			return v.Type, true
+		}
+	}
+	return nil, false
+}
+
+// Missing returns the names of the variants that are not in covered, in the
+// order they were declared. A check of a union value is exhaustive if nothing
+// is missing.
+func (u UnionType) Missing(covered []string) (missing []string) {
+	seen := make(map[string]bool, len(covered))
+	for _, c := range covered {
+		seen[c] = true
+	}
+	for _, v := range u.Variants {
+		if !seen[v.Name] {
+			missing = append(missing, v.Name)
+		}
+	}
+	return
+}
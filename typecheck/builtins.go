@@ -29,6 +29,41 @@ func simpleBuiltin(ret types.Type, exp ...types.Type) builtin {
 	}
 }
 
+// mapBuiltin creates a builtin taking a map, followed by a key and a value if
+// withKey and withValue are set. The return type is determined from the map
+// type by ret.
+func mapBuiltin(withKey, withValue bool, ret func(types.MapType) types.Type) builtin {
+	return func(mn ast.MetaNode, t []types.Type) (rt types.Type, err *pe.PrettyError) {
+		argc := 1
+		if withKey {
+			argc++
+		}
+		if withValue {
+			argc++
+		}
+		if len(t) < argc {
+			err = nodeErr(pe.ENeedMoreArgs, mn)
+			return
+		}
+
+		if t[0].Prim() != types.PMap {
+			err = typeMismatch(mn, types.MapType{Key: types.Any, Value: types.Any}, t[0])
+			return
+		}
+		mt := types.Unalias(t[0]).(types.MapType)
+		if withKey && !mt.Key.Equals(t[1]) {
+			err = typeMismatch(mn, mt.Key, t[1])
+			return
+		}
+		if withValue && !mt.Value.Equals(t[2]) {
+			err = typeMismatch(mn, mt.Value, t[2])
+			return
+		}
+
+		return ret(mt), nil
+	}
+}
+
 func mathBuiltin(mn ast.MetaNode, t []types.Type) (rt types.Type, err *pe.PrettyError) {
 	if len(t) < 2 {
 		err = pe.New(pe.ENeedMoreArgs)
@@ -85,6 +120,8 @@ var builtins = map[string]builtin{
 	"and": simpleBuiltin(types.Bool, types.Bool, types.Bool),
 	"or":  simpleBuiltin(types.Bool, types.Bool, types.Bool),
 
+	// strings are treated as arrays of characters (Unicode code points) by all
+	// of the builtins below, so lengths and indices count characters, not bytes
 	"append": func(mn ast.MetaNode, t []types.Type) (rt types.Type, err *pe.PrettyError) {
 		if len(t) < 2 {
 			err = pe.New(pe.ENeedMoreArgs)
@@ -100,7 +137,7 @@ var builtins = map[string]builtin{
 			return
 		}
 
-		t0a := t[0].(types.ArrayType)
+		t0a := types.Unalias(t[0]).(types.ArrayType)
 		if !t[1].Equals(t0a.Element) {
 			err = typeMismatch(mn, t0a.Element, t[1])
 			return
@@ -127,8 +164,8 @@ var builtins = map[string]builtin{
 			return
 		}
 
-		t0a := t[0].(types.ArrayType)
-		t1a := t[1].(types.ArrayType)
+		t0a := types.Unalias(t[0]).(types.ArrayType)
+		t1a := types.Unalias(t[1]).(types.ArrayType)
 
 		if !t1a.Element.Equals(t0a.Element) {
 			err = typeMismatch(mn, t0a.Element, t1a.Element)
@@ -181,7 +218,7 @@ var builtins = map[string]builtin{
 			return
 		}
 
-		return t[0].(types.ArrayType).Element, nil
+		return types.Unalias(t[0]).(types.ArrayType).Element, nil
 	},
 	"len": func(mn ast.MetaNode, t []types.Type) (rt types.Type, err *pe.PrettyError) {
 		if len(t) < 1 {
@@ -189,7 +226,7 @@ var builtins = map[string]builtin{
 			return
 		}
 
-		if types.String.Equals(t[0]) {
+		if types.String.Equals(t[0]) || t[0].Prim() == types.PMap {
 			return types.Int, nil
 		}
 
@@ -201,6 +238,24 @@ var builtins = map[string]builtin{
 		return types.Int, nil
 	},
 
+	// maps are shared rather than copied, so set and delete change the map
+	// itself instead of returning a changed copy
+	"get": mapBuiltin(true, false, func(m types.MapType) types.Type {
+		return types.Result(m.Value)
+	}),
+	"set": mapBuiltin(true, true, func(types.MapType) types.Type {
+		return types.Nothing
+	}),
+	"delete": mapBuiltin(true, false, func(types.MapType) types.Type {
+		return types.Nothing
+	}),
+	"has": mapBuiltin(true, false, func(types.MapType) types.Type {
+		return types.Bool
+	}),
+	"keys": mapBuiltin(false, false, func(m types.MapType) types.Type {
+		return types.ArrayType{Element: m.Key}
+	}),
+
 	"str":        simpleBuiltin(types.String, types.Any),
 	"bool":       simpleBuiltin(types.Bool, types.Any),
 	"parse_bool": simpleBuiltin(types.Result(types.Bool), types.String),
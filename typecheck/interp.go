@@ -0,0 +1,27 @@
+package typecheck
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// interpType checks the values embedded in an interpolated string, which are
+// turned into strings like the str builtin does. Functions, and calls of
+// functions that return nothing, cannot be turned into strings.
+func (c *Checker) interpType(mn ast.MetaNode) (t types.Type, ok bool) {
+	n := mn.Node.(ast.InterpNode)
+	ok = true
+	for _, v := range n.Values {
+		vt, vok := c.typeOf(v)
+		if !vok {
+			ok = false
+			continue
+		}
+		if p := vt.Prim(); p == types.PFunc || p == types.PNothing {
+			c.errs <- nodeErr(pe.ENotPrintable, v).Section("Embedded type", "%s", vt)
+			ok = false
+		}
+	}
+	return types.String, ok
+}
@@ -0,0 +1,146 @@
+package typecheck
+
+import (
+	"strings"
+
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// coverage keeps track of the values matched by the arms of a match statement.
+// Only the top-level pattern of an arm is considered, so arms with nested
+// refutable patterns never cover anything.
+type coverage struct {
+	all      bool
+	literals map[ast.Node]bool
+	variants []string
+	seen     map[string]bool
+}
+
+// covers returns true if every value the given pattern matches has already
+// been matched by a previous arm.
+func (cv *coverage) covers(p ast.Pattern) bool {
+	switch {
+	case cv.all:
+		return true
+	case p.Kind == ast.PatLiteral:
+		return cv.literals[p.Value.Node]
+	case p.Kind == ast.PatVariant:
+		return cv.seen[p.Variant]
+	default:
+		return false
+	}
+}
+
+// add marks the values matched by the given pattern as covered.
+func (cv *coverage) add(p ast.Pattern, t types.Type) {
+	switch {
+	case p.Irrefutable():
+		cv.all = true
+	case p.Kind == ast.PatLiteral:
+		cv.literals[p.Value.Node] = true
+		if types.Bool.Equals(t) && len(cv.literals) == 2 {
+			cv.all = true
+		}
+	case p.Kind == ast.PatVariant && (len(p.Fields) == 0 || p.Fields[0].Irrefutable()):
+		cv.variants = append(cv.variants, p.Variant)
+		cv.seen[p.Variant] = true
+		if len(types.Unalias(t).(types.UnionType).Missing(cv.variants)) == 0 {
+			cv.all = true
+		}
+	}
+}
+
+// checkMatch ensures the patterns of a match statement fit the type of the
+// matched value, that every arm can be reached and that every possible value
+// is matched by one of the arms.
+func (c *Checker) checkMatch(mn ast.MetaNode, ret types.Type) {
+	n := mn.Node.(ast.MatchNode)
+	c.checkLambdas(n.Value)
+	t, ok := c.typeOf(n.Value)
+	if !ok {
+		return
+	}
+
+	cv := coverage{
+		literals: make(map[ast.Node]bool),
+		seen:     make(map[string]bool),
+	}
+	for _, a := range n.Arms {
+		c.scope = c.scope.sub()
+		if c.checkPattern(a.Pattern, t) {
+			if cv.covers(a.Pattern) {
+				c.errs <- patternErr(pe.EUnreachableArm, a.Pattern)
+			}
+			cv.add(a.Pattern, t)
+		}
+		c.checkBlock(a.Block, ret)
+		c.scope = c.scope.parent
+	}
+
+	if cv.all {
+		return
+	}
+	err := nodeErr(pe.ENonExhaustive, mn).Section("Matched type", "%s", t)
+	if u, ok := types.Unalias(t).(types.UnionType); ok {
+		err.Section("Missing variants", "%s", strings.Join(u.Missing(cv.variants), ", "))
+	}
+	c.errs <- err
+}
+
+// checkPattern ensures the given pattern can match values of the given type,
+// declaring the variables bound by it. Returns false if the pattern is
+// invalid.
+func (c *Checker) checkPattern(p ast.Pattern, t types.Type) bool {
+	switch p.Kind {
+	case ast.PatBind:
+		if p.Bind != "" {
+			c.scope.vars[p.Bind] = t
+		}
+	case ast.PatLiteral:
+		lt, ok := c.typeOf(p.Value)
+		if !ok {
+			return false
+		}
+		if !t.Equals(lt) {
+			c.typeMismatch(p.Value, t, lt)
+			return false
+		}
+	case ast.PatStruct:
+		if !t.Equals(p.Type) {
+			c.errs <- patternMismatch(p, t)
+			return false
+		}
+		valid := true
+		for i, f := range types.Unalias(t).(types.StructType).Fields {
+			if i < len(p.Fields) && !c.checkPattern(p.Fields[i], f.Type) {
+				valid = false
+			}
+		}
+		return valid
+	case ast.PatVariant:
+		u, ok := types.Unalias(t).(types.UnionType)
+		if !ok || !u.Equals(p.Type) {
+			c.errs <- patternMismatch(p, t)
+			return false
+		}
+		vt, ok := u.Variant(p.Variant)
+		if !ok {
+			c.errs <- patternErr(pe.EUnknownVariant, p).Section("Union", "%s", u)
+			return false
+		}
+		if len(p.Fields) > 0 {
+			return c.checkPattern(p.Fields[0], vt)
+		}
+	}
+	return true
+}
+
+func patternMismatch(p ast.Pattern, want types.Type) *pe.PrettyError {
+	return pe.New(pe.ETypeMismatch).Section("Wanted type", "%s", want).Section("Got type", "%s", p.Type).Section("Caused by", "pattern at %s", p.Where)
+}
+
+func patternErr(e pe.ErrorCode, p ast.Pattern) *pe.PrettyError {
+	return pe.New(e).Section("Caused by", "pattern at %s", p.Where)
+}
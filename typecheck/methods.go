@@ -0,0 +1,48 @@
+package typecheck
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// defineMethod adds the given method to the method set of it's structure.
+func (c *Checker) defineMethod(recv, name string, f funcproto) {
+	if c.methods[recv] == nil {
+		c.methods[recv] = make(map[string]funcproto)
+	}
+	c.methods[recv][name] = f
+}
+
+// method finds the method with the given name in the method set of the given
+// receiver type, which has to be a structure.
+func (c *Checker) method(mn ast.MetaNode, recv types.Type, name string) (f funcproto, ok bool) {
+	s, ok := types.Unalias(recv).(types.StructType)
+	if !ok {
+		c.errs <- nodeErr(pe.EBadSelectorParent, mn).Section("Receiver type", "%s", recv)
+		return
+	}
+	f, ok = c.methods[s.Name][name]
+	if !ok {
+		c.errs <- nodeErr(pe.EUnknownMethod, mn).Section("Method", "%s", name).Section("Receiver type", "%s", s)
+	}
+	return
+}
+
+// methodCall checks the arguments of a method call and returns it's return
+// type. The receiver is checked like the first argument of the method.
+func (c *Checker) methodCall(mn ast.MetaNode) (t types.Type, ok bool) {
+	n := mn.Node.(ast.MethodCallNode)
+	args := make([]types.Type, len(n.Args)+1)
+	for i, a := range append([]ast.MetaNode{n.Recv}, n.Args...) {
+		args[i], ok = c.typeOf(a)
+		if !ok {
+			return
+		}
+	}
+	f, ok := c.method(mn, args[0], n.Method)
+	if !ok {
+		return
+	}
+	return c.instantiate(mn, f, args)
+}
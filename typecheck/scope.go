@@ -4,10 +4,24 @@ import (
 	"github.com/syzkrash/skol/parser/values/types"
 )
 
-// funcproto defines the prototype of a function: it's arguments and return type
+// funcproto defines the prototype of a function: it's type parameters,
+// arguments and return type
 type funcproto struct {
-	Args []types.Descriptor
-	Ret  types.Type
+	Params []string
+	Args   []types.Descriptor
+	Ret    types.Type
+}
+
+// funcType returns the type of this function when it is used as a value.
+func (f funcproto) funcType() types.FuncType {
+	t := types.FuncType{
+		Args: make([]types.Type, len(f.Args)),
+		Ret:  f.Ret,
+	}
+	for i, a := range f.Args {
+		t.Args[i] = a.Type
+	}
+	return t
 }
 
 // scope contains the types of variables and function prototypes. This is
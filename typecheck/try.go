@@ -0,0 +1,30 @@
+package typecheck
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// tryType determines the type of a propagated result, which is the type of the
+// value the result holds. A failed result is returned from the current
+// function, so the function has to return a result as well.
+func (c *Checker) tryType(mn ast.MetaNode) (t types.Type, ok bool) {
+	n := mn.Node.(ast.TryNode)
+	if c.ret == nil {
+		c.nodeErr(pe.EBadTry, mn)
+		return
+	}
+	if _, ok = types.IsResult(c.ret); !ok {
+		c.errs <- nodeErr(pe.EBadTry, mn).Section("Function returns", "%s", c.ret)
+		return
+	}
+	rt, ok := c.typeOf(n.Value)
+	if !ok {
+		return
+	}
+	if t, ok = types.IsResult(rt); !ok {
+		c.errs <- nodeErr(pe.ENotResult, n.Value).Section("Tried type", "%s", rt)
+	}
+	return
+}
@@ -0,0 +1,52 @@
+package typecheck
+
+import (
+	"github.com/syzkrash/skol/ast"
+	"github.com/syzkrash/skol/common/pe"
+	"github.com/syzkrash/skol/parser/values/types"
+)
+
+// tupleType determines the type of a tuple literal from the types of it's
+// elements.
+func (c *Checker) tupleType(n ast.TupleNode) (t types.TupleType, ok bool) {
+	t.Elems = make([]types.Type, len(n.Elems))
+	for i, e := range n.Elems {
+		if t.Elems[i], ok = c.typeOf(e); !ok {
+			return
+		}
+	}
+	return t, true
+}
+
+// checkDestructure ensures the destructured value is a tuple with exactly one
+// element for every variable. Every element is then assigned to it's variable
+// like a variable assignment would.
+func (c *Checker) checkDestructure(mn ast.MetaNode) {
+	n := mn.Node.(ast.DestructureNode)
+	c.checkLambdas(n.Value)
+	t, ok := c.typeOf(n.Value)
+	if !ok {
+		return
+	}
+	tt, ok := types.Unalias(t).(types.TupleType)
+	if !ok {
+		c.errs <- nodeErr(pe.ENotTuple, n.Value).Section("Destructured type", "%s", t)
+		return
+	}
+	if len(tt.Elems) != len(n.Vars) {
+		c.errs <- nodeErr(pe.EDestructureCount, mn).
+			Section("Tuple type", "%s", t).
+			Section("Variables", "%d", len(n.Vars))
+		return
+	}
+	for i, v := range n.Vars {
+		et := tt.Elems[i]
+		if ot, ok := c.scope.getVar(v); ok {
+			if !ot.Equals(et) {
+				c.typeMismatch(mn, ot, et)
+			}
+		} else {
+			c.scope.setVar(v, et)
+		}
+	}
+}
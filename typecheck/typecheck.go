@@ -9,7 +9,12 @@ import (
 // Checker ensures type correctness of an AST.
 type Checker struct {
 	scope *scope
-	errs  chan error
+	// methods holds the method sets of structures by the structure's name
+	methods map[string]map[string]funcproto
+	// ret is the return type of the function being checked, or nil outside of
+	// functions
+	ret  types.Type
+	errs chan error
 }
 
 // NewChecker creates a blank Checker.
@@ -20,13 +25,31 @@ func NewChecker(errOut chan error) *Checker {
 			vars:   make(map[string]types.Type),
 			funcs:  make(map[string]funcproto),
 		},
-		errs: errOut,
+		methods: make(map[string]map[string]funcproto),
+		errs:    errOut,
 	}
 }
 
 // Check thoroughly inspects the provided AST for any typing-related errors
 // that may have occured.
 func (c *Checker) Check(tree ast.AST) {
+	// first loop to declare functions, which variables may refer to
+	for _, f := range tree.Funcs {
+		c.scope.funcs[f.Name] = funcproto{
+			Params: f.Params,
+			Args:   f.Args,
+			Ret:    f.Ret,
+		}
+	}
+	for _, ms := range tree.Methods {
+		for _, m := range ms {
+			c.defineMethod(m.Recv, m.Name, funcproto{
+				Params: m.Params,
+				Args:   m.Args,
+				Ret:    m.Ret,
+			})
+		}
+	}
 	for _, v := range tree.Typedefs {
 		c.scope.vars[v.Name] = v.Type
 	}
@@ -36,12 +59,8 @@ func (c *Checker) Check(tree ast.AST) {
 			c.scope.vars[v.Name] = t
 		}
 	}
-	// first loop to declare functions
-	for _, f := range tree.Funcs {
-		c.scope.funcs[f.Name] = funcproto{
-			Args: f.Args,
-			Ret:  f.Ret,
-		}
+	for _, v := range tree.Vars {
+		c.checkLambdas(v.Value)
 	}
 	// second loop to typecheck function bodies with function type information
 	for _, f := range tree.Funcs {
@@ -51,6 +70,15 @@ func (c *Checker) Check(tree ast.AST) {
 		}
 		c.checkFunc(args, f.Ret, f.Body)
 	}
+	for _, ms := range tree.Methods {
+		for _, m := range ms {
+			args := make(map[string]types.Type)
+			for _, a := range m.Args {
+				args[a.Name] = a.Type
+			}
+			c.checkFunc(args, m.Ret, m.Body)
+		}
+	}
 }
 
 func (c *Checker) checkNode(mn ast.MetaNode, ret types.Type) {
@@ -60,25 +88,56 @@ func (c *Checker) checkNode(mn ast.MetaNode, ret types.Type) {
 	// literals
 	case ast.NStruct:
 		nstruct := n.(ast.StructNode)
+		bound := make(map[string]types.Type)
 		for i, a := range nstruct.Args {
+			c.checkLambdas(a)
 			at, ok := c.typeOf(a)
 			if !ok {
 				continue
 			}
 			ft := nstruct.Type.Fields[i].Type
-			if !ft.Equals(at) {
-				c.typeMismatch(a, ft, at)
+			if !types.Infer(ft, at, bound) {
+				c.typeMismatch(a, types.Subst(ft, bound), at)
 			}
 		}
+		if nstruct.Type.IsGeneric() {
+			for _, p := range nstruct.Type.Params {
+				if _, ok := bound[p]; !ok {
+					c.errs <- nodeErr(pe.ECannotInferType, mn).Section("Type parameter", p)
+				}
+			}
+		}
+	case ast.NStructUpdate:
+		c.checkLambdas(mn)
+		c.checkUpdate(mn)
+	case ast.NLambda:
+		c.checkLambdas(mn)
+	case ast.NVariant:
+		c.checkLambdas(mn)
 	case ast.NArray:
 		narray := n.(ast.ArrayNode)
 		for _, e := range narray.Elems {
+			c.checkLambdas(e)
 			et, ok := c.typeOf(e)
 			if !ok {
 				continue
 			}
-			if !narray.Type.Equals(et) {
-				c.typeMismatch(e, narray.Type, et)
+			if !narray.Type.Element.Equals(et) {
+				c.typeMismatch(e, narray.Type.Element, et)
+			}
+		}
+
+	case ast.NMap:
+		nmap := n.(ast.MapNode)
+		for i, k := range nmap.Keys {
+			v := nmap.Values[i]
+			c.checkLambdas(k)
+			c.checkLambdas(v)
+			if kt, ok := c.typeOf(k); ok && !nmap.Type.Key.Equals(kt) {
+				c.typeMismatch(k, nmap.Type.Key, kt)
+			}
+			if vt, ok := c.typeOf(v); ok && !nmap.Type.Value.Equals(vt) {
+				c.typeMismatch(v, nmap.Type.Value, vt)
 			}
 		}
 
@@ -94,8 +153,15 @@ func (c *Checker) checkNode(mn ast.MetaNode, ret types.Type) {
 		nwhile := n.(ast.WhileNode)
 		c.checkCond(nwhile.Cond)
 		c.checkBlock(nwhile.Block, ret)
+	case ast.NForEach:
+		c.checkForEach(mn, ret)
+	case ast.NBreak, ast.NContinue:
+		// nothing to check
+	case ast.NMatch:
+		c.checkMatch(mn, ret)
 	case ast.NReturn:
 		nreturn := n.(ast.ReturnNode)
+		c.checkLambdas(nreturn.Value)
 		rt, ok := c.typeOf(nreturn.Value)
 		if !ok {
 			return
@@ -119,6 +185,10 @@ func (c *Checker) checkNode(mn ast.MetaNode, ret types.Type) {
 		} else {
 			c.scope.setVar(nvarset.Var, nvt)
 		}
+	case ast.NSelectorSet:
+		c.checkSelectorSet(mn)
+	case ast.NDestructure:
+		c.checkDestructure(mn)
 	case ast.NVarDef:
 		nvardef := n.(ast.VarDefNode)
 		c.scope.setVar(nvardef.Var, nvardef.Type)
@@ -140,18 +210,31 @@ func (c *Checker) checkNode(mn ast.MetaNode, ret types.Type) {
 			if !ovt.Equals(nvarsettyped.Type) {
 				c.typeMismatch(nvarsettyped.Value, ovt, nvt)
 			}
+		} else {
+			if !nvarsettyped.Type.Equals(nvt) {
+				c.typeMismatch(nvarsettyped.Value, nvarsettyped.Type, nvt)
+			}
+			c.scope.setVar(nvarsettyped.Var, nvarsettyped.Type)
 		}
 	case ast.NFuncDef:
 		nfuncdef := n.(ast.FuncDefNode)
+		f := funcproto{
+			Params: nfuncdef.Params,
+			Args:   nfuncdef.Proto,
+			Ret:    nfuncdef.Ret,
+		}
+		// functions nested in another function are variables of the enclosing
+		// function, declared before the body so that they can call themselves
+		if nfuncdef.Recv != "" {
+			c.defineMethod(nfuncdef.Recv, nfuncdef.Name, f)
+		} else {
+			c.scope.vars[nfuncdef.Name] = f.funcType()
+		}
 		args := make(map[string]types.Type)
 		for _, a := range nfuncdef.Proto {
 			args[a.Name] = a.Type
 		}
 		c.checkFunc(args, nfuncdef.Ret, nfuncdef.Body)
-		c.scope.funcs[nfuncdef.Name] = funcproto{
-			Args: nfuncdef.Proto,
-			Ret:  nfuncdef.Ret,
-		}
 	case ast.NFuncExtern:
 		nfuncextern := n.(ast.FuncExternNode)
 		c.scope.funcs[nfuncextern.Alias] = funcproto{
@@ -164,6 +247,7 @@ func (c *Checker) checkNode(mn ast.MetaNode, ret types.Type) {
 		nfunccall := n.(ast.FuncCallNode)
 		args := make([]types.Type, len(nfunccall.Args))
 		for i, a := range nfunccall.Args {
+			c.checkLambdas(a)
 			t, ok := c.typeOf(a)
 			if !ok {
 				return
@@ -172,27 +256,124 @@ func (c *Checker) checkNode(mn ast.MetaNode, ret types.Type) {
 		}
 		f, ok := c.scope.getFunc(nfunccall.Func)
 		if !ok {
-			bf, ok := builtins[nfunccall.Func]
-			if !ok {
-				c.nodeErr(pe.EUnknownFunction, mn)
+			if bf, ok := builtins[nfunccall.Func]; ok {
+				if _, err := bf(mn, args); err != nil {
+					c.errs <- err
+				}
 				return
 			}
-			if _, err := bf(mn, args); err != nil {
-				c.errs <- err
+			if f, ok = c.varFunc(mn, nfunccall.Func); !ok {
+				return
 			}
+		}
+		c.instantiate(mn, f, args)
+	case ast.NMethodCall:
+		c.checkLambdas(mn)
+		c.methodCall(mn)
+	case ast.NTry:
+		c.checkLambdas(mn)
+		c.typeOf(mn)
+	}
+	return
+}
+
+// instantiate checks the arguments of a call to the given function and returns
+// it's return type. The type arguments of generic functions are inferred from
+// the types of the arguments and replace the type parameters in the return
+// type.
+func (c *Checker) instantiate(mn ast.MetaNode, f funcproto, args []types.Type) (ret types.Type, ok bool) {
+	if len(args) != len(f.Args) {
+		c.nodeErr(pe.ENeedMoreArgs, mn)
+		return
+	}
+	bound := make(map[string]types.Type)
+	for i := 0; i < len(args); i++ {
+		if !types.Infer(f.Args[i].Type, args[i], bound) {
+			c.typeMismatch(mn, types.Subst(f.Args[i].Type, bound), args[i])
 			return
 		}
-		if len(args) != len(f.Args) {
-			c.nodeErr(pe.ENeedMoreArgs, mn)
+	}
+	for _, p := range f.Params {
+		if _, found := bound[p]; !found {
+			c.errs <- nodeErr(pe.ECannotInferType, mn).Section("Type parameter", p)
 			return
 		}
-		for i := 0; i < len(args); i++ {
-			if !f.Args[i].Type.Equals(args[i]) {
-				c.typeMismatch(mn, f.Args[i].Type, args[i])
-			}
+	}
+	return types.Subst(f.Ret, bound), true
+}
+
+// varFunc returns the prototype of the function held by the variable with the
+// given name, so that it can be called.
+func (c *Checker) varFunc(mn ast.MetaNode, name string) (f funcproto, ok bool) {
+	vt, ok := c.scope.getVar(name)
+	if !ok {
+		c.nodeErr(pe.EUnknownFunction, mn)
+		return
+	}
+	ft, ok := types.Unalias(vt).(types.FuncType)
+	if !ok {
+		c.nodeErr(pe.ENotCallable, mn)
+		return
+	}
+	f.Ret = ft.Ret
+	f.Args = make([]types.Descriptor, len(ft.Args))
+	for i, a := range ft.Args {
+		f.Args[i] = types.Descriptor{Type: a}
+	}
+	return f, true
+}
+
+// checkLambdas checks the bodies of all anonymous functions within the given
+// value. The bodies can use the variables of the current scope.
+func (c *Checker) checkLambdas(mn ast.MetaNode) {
+	switch n := mn.Node.(type) {
+	case ast.LambdaNode:
+		args := make(map[string]types.Type)
+		for _, a := range n.Proto {
+			args[a.Name] = a.Type
+		}
+		c.checkFunc(args, n.Ret, n.Body)
+	case ast.FuncCallNode:
+		for _, a := range n.Args {
+			c.checkLambdas(a)
+		}
+	case ast.MethodCallNode:
+		for _, a := range n.Args {
+			c.checkLambdas(a)
+		}
+	case ast.StructNode:
+		for _, a := range n.Args {
+			c.checkLambdas(a)
+		}
+	case ast.TryNode:
+		c.checkLambdas(n.Value)
+	case ast.InterpNode:
+		for _, v := range n.Values {
+			c.checkLambdas(v)
+		}
+	case ast.TupleNode:
+		for _, e := range n.Elems {
+			c.checkLambdas(e)
+		}
+	case ast.StructUpdateNode:
+		c.checkLambdas(n.Base)
+		for _, v := range n.Values {
+			c.checkLambdas(v)
+		}
+	case ast.ArrayNode:
+		for _, e := range n.Elems {
+			c.checkLambdas(e)
+		}
+	case ast.VariantNode:
+		if n.Value.Node != nil {
+			c.checkLambdas(n.Value)
+		}
+	case ast.MapNode:
+		for i, k := range n.Keys {
+			c.checkLambdas(k)
+			c.checkLambdas(n.Values[i])
 		}
 	}
-	return
 }
 
 // checkFunc ensures type correctness given the function arguments' types and
@@ -202,11 +383,96 @@ func (c *Checker) checkFunc(args map[string]types.Type, ret types.Type, body ast
 	for n, t := range args {
 		c.scope.vars[n] = t
 	}
+	outer := c.ret
+	c.ret = ret
 	c.checkBlock(body, ret)
+	c.ret = outer
 	c.scope = c.scope.parent
 	return
 }
 
+// checkForEach ensures the value iterated by a for-each loop is an array or a
+// string, then checks the loop body with the index and element variables
+// declared.
+func (c *Checker) checkForEach(mn ast.MetaNode, ret types.Type) {
+	n := mn.Node.(ast.ForEachNode)
+	c.checkLambdas(n.Iter)
+	t, ok := c.typeOf(n.Iter)
+	if !ok {
+		return
+	}
+	var elem types.Type
+	switch {
+	case types.String.Equals(t):
+		elem = types.Char
+	case t.Prim() == types.PArray:
+		elem = types.Unalias(t).(types.ArrayType).Element
+	default:
+		c.errs <- nodeErr(pe.ENotIterable, n.Iter).Section("Iterated type", "%s", t)
+		return
+	}
+	c.scope = c.scope.sub()
+	if n.Index != "" {
+		c.scope.vars[n.Index] = types.Int
+	}
+	c.scope.vars[n.Elem] = elem
+	c.checkBlock(n.Block, ret)
+	c.scope = c.scope.parent
+}
+
+// checkSelectorSet ensures the target of a selector assignment is a structure
+// field or an array element with the same type as the assigned value.
+func (c *Checker) checkSelectorSet(mn ast.MetaNode) {
+	n := mn.Node.(ast.SelectorSetNode)
+	c.checkLambdas(n.Value)
+	p := n.Target.Path()
+	t, ok := c.scope.getVar(p[0].Name)
+	if !ok {
+		c.nodeErr(pe.EUnknownVariable, mn)
+		return
+	}
+	for _, e := range p[1:] {
+		switch {
+		case e.IsCast():
+			c.nodeErr(pe.ENotAssignable, mn)
+			return
+		case e.IsName():
+			if t.Prim() != types.PStruct {
+				c.nodeErr(pe.EBadSelectorParent, mn)
+				return
+			}
+			t, ok = types.Unalias(t).(types.StructType).FieldType(e.Name)
+			if !ok {
+				c.nodeErr(pe.EUnknownField, mn)
+				return
+			}
+		default:
+			if e.IsSelIdx() {
+				idx := ast.MetaNode{Node: e.IdxS, Where: mn.Where}
+				if it, ok := c.typeOf(idx); ok && !types.Int.Equals(it) {
+					c.typeMismatch(idx, types.Int, it)
+				}
+			}
+			if types.String.Equals(t) {
+				c.errs <- nodeErr(pe.ENotAssignable, mn).Section("Indexed type", "%s", t)
+				return
+			}
+			if t.Prim() != types.PArray {
+				c.nodeErr(pe.EBadIndexParent, mn)
+				return
+			}
+			t = types.Unalias(t).(types.ArrayType).Element
+		}
+	}
+	vt, ok := c.typeOf(n.Value)
+	if !ok {
+		return
+	}
+	if !t.Equals(vt) {
+		c.typeMismatch(n.Value, t, vt)
+	}
+}
+
 func (c *Checker) checkBranch(b ast.Branch, ret types.Type) {
 	c.checkCond(b.Cond)
 	c.checkBlock(b.Block, ret)
@@ -234,6 +500,8 @@ func (c *Checker) checkBlock(b ast.Block, ret types.Type) {
 // typeOf determines the type of any abstract AST node.
 func (c *Checker) typeOf(mn ast.MetaNode) (t types.Type, ok bool) {
 	n := mn.Node
+	// literals always have a known type, every other case sets ok itself
+	ok = true
 
 	switch n.Kind() {
 	// literals
@@ -247,10 +515,20 @@ func (c *Checker) typeOf(mn ast.MetaNode) (t types.Type, ok bool) {
 		t = types.Float
 	case ast.NString:
 		t = types.String
+	case ast.NInterp:
+		t, ok = c.interpType(mn)
 	case ast.NStruct:
-		t = n.(ast.StructNode).Type
+		t, ok = c.structType(n.(ast.StructNode))
+	case ast.NStructUpdate:
+		t, ok = c.updateType(n.(ast.StructUpdateNode))
+	case ast.NVariant:
+		t, ok = c.variantType(n.(ast.VariantNode))
 	case ast.NArray:
 		t = n.(ast.ArrayNode).Type
+	case ast.NMap:
+		t = n.(ast.MapNode).Type
+	case ast.NTuple:
+		t, ok = c.tupleType(n.(ast.TupleNode))
 
 	// others
 	case ast.NFuncCall:
@@ -268,32 +546,36 @@ func (c *Checker) typeOf(mn ast.MetaNode) (t types.Type, ok bool) {
 		f, ok = c.scope.getFunc(nfunccall.Func)
 		if !ok {
 			var bf builtin
-			bf, ok = builtins[nfunccall.Func]
-			if !ok {
-				c.nodeErr(pe.EUnknownFunction, mn)
+			if bf, ok = builtins[nfunccall.Func]; ok {
+				var err *pe.PrettyError
+				t, err = bf(mn, args)
+				if err != nil {
+					ok = false
+					c.errs <- err
+				}
 				return
 			}
-			var err error
-			t, err = bf(mn, args)
-			if err != nil {
-				ok = false
-				c.errs <- err
+			if f, ok = c.varFunc(mn, nfunccall.Func); !ok {
+				return
 			}
-			return
 		}
-		if len(args) != len(f.Args) {
-			c.nodeErr(pe.ENeedMoreArgs, mn)
-			ok = false
+		t, ok = c.instantiate(mn, f, args)
+	case ast.NMethodCall:
+		t, ok = c.methodCall(mn)
+	case ast.NTry:
+		t, ok = c.tryType(mn)
+	case ast.NFuncRef:
+		nfuncref := n.(ast.FuncRefNode)
+		var f funcproto
+		f, ok = c.scope.getFunc(nfuncref.Func)
+		if !ok {
+			c.nodeErr(pe.EUnknownFunction, mn)
 			return
 		}
-		for i := 0; i < len(args); i++ {
-			if !f.Args[i].Type.Equals(args[i]) {
-				c.typeMismatch(mn, f.Args[i].Type, args[i])
-				ok = false
-				return
-			}
-		}
-		t = f.Ret
+		t = f.funcType()
+	case ast.NLambda:
+		nlambda := n.(ast.LambdaNode)
+		t = funcproto{Args: nlambda.Proto, Ret: nlambda.Ret}.funcType()
 
 	default:
 		var sel ast.Selector
@@ -333,13 +615,23 @@ func (c *Checker) typeOf(mn ast.MetaNode) (t types.Type, ok bool) {
 					}
 					t = e.Cast
 				case e.IsName():
+					if u, isUnion := types.Unalias(t).(types.UnionType); isUnion {
+						var vt types.Type
+						vt, ok = u.Variant(e.Name)
+						if !ok {
+							c.nodeErr(pe.EUnknownVariant, mn)
+							return
+						}
+						t = types.Result(vt)
+						continue
+					}
 					if t.Prim() != types.PStruct {
 						c.nodeErr(pe.EBadSelectorParent, mn)
 						ok = false
 						return
 					}
 					var fieldType types.Type
-					fieldType, ok = t.(types.StructType).FieldType(e.Name)
+					fieldType, ok = types.Unalias(t).(types.StructType).FieldType(e.Name)
 					if !ok {
 						c.nodeErr(pe.EUnknownField, mn)
 						return
@@ -348,14 +640,14 @@ func (c *Checker) typeOf(mn ast.MetaNode) (t types.Type, ok bool) {
 				default:
 					if types.String.Equals(t) {
 						t = types.Result(types.Char)
-						return
+						continue
 					}
 					if t.Prim() != types.PArray {
 						c.nodeErr(pe.EBadIndexParent, mn)
 						ok = false
 						return
 					}
-					t = types.Result(t.(types.ArrayType).Element)
+					t = types.Result(types.Unalias(t).(types.ArrayType).Element)
 				}
 			}
 		}
@@ -364,6 +656,106 @@ func (c *Checker) typeOf(mn ast.MetaNode) (t types.Type, ok bool) {
 	return
 }
 
+// structType determines the type of a structure literal. The parser leaves
+// generic structures uninstantiated if it cannot infer their type arguments,
+// in which case they are inferred here.
+func (c *Checker) structType(n ast.StructNode) (t types.StructType, ok bool) {
+	if !n.Type.IsGeneric() {
+		return n.Type, true
+	}
+	bound := make(map[string]types.Type)
+	for i, a := range n.Args {
+		at, ok := c.typeOf(a)
+		if !ok || !types.Infer(n.Type.Fields[i].Type, at, bound) {
+			return t, false
+		}
+	}
+	args := make([]types.Type, len(n.Type.Params))
+	for i, p := range n.Type.Params {
+		if args[i], ok = bound[p]; !ok {
+			return
+		}
+	}
+	return types.Instantiate(n.Type, args), true
+}
+
+// updateType determines the type of a structure update. The type arguments of
+// a generic structure are taken from the base value.
+func (c *Checker) updateType(n ast.StructUpdateNode) (t types.StructType, ok bool) {
+	if !n.Type.IsGeneric() {
+		return n.Type, true
+	}
+	bt, ok := c.typeOf(n.Base)
+	if !ok {
+		return
+	}
+	bound := make(map[string]types.Type)
+	if !types.Infer(n.Type, bt, bound) {
+		return t, false
+	}
+	args := make([]types.Type, len(n.Type.Params))
+	for i, p := range n.Type.Params {
+		if args[i], ok = bound[p]; !ok {
+			return
+		}
+	}
+	return types.Instantiate(n.Type, args), true
+}
+
+// checkUpdate ensures the base value of a structure update has every field of
+// the structure, and that the changed fields are given values of their types.
+func (c *Checker) checkUpdate(mn ast.MetaNode) {
+	n := mn.Node.(ast.StructUpdateNode)
+	bt, ok := c.typeOf(n.Base)
+	if !ok {
+		return
+	}
+	if !types.Infer(n.Type, bt, make(map[string]types.Type)) {
+		c.typeMismatch(n.Base, n.Type, bt)
+		return
+	}
+	s, ok := c.updateType(n)
+	if !ok {
+		c.errs <- nodeErr(pe.ECannotInferType, mn).Section("Structure", "%s", n.Type)
+		return
+	}
+	for i, f := range n.Fields {
+		ft, _ := s.FieldType(f)
+		if vt, ok := c.typeOf(n.Values[i]); ok && !ft.Equals(vt) {
+			c.typeMismatch(n.Values[i], ft, vt)
+		}
+	}
+}
+
+// variantType determines the type of a tagged union literal, ensuring the
+// payload matches the variant. The type arguments of generic unions are
+// inferred like [Checker.structType] does.
+func (c *Checker) variantType(n ast.VariantNode) (t types.UnionType, ok bool) {
+	if n.Value.Node == nil {
+		return n.Type, !n.Type.IsGeneric()
+	}
+	vt, _ := n.Type.Variant(n.Variant)
+	pt, ok := c.typeOf(n.Value)
+	if !ok {
+		return
+	}
+	bound := make(map[string]types.Type)
+	if !types.Infer(vt, pt, bound) {
+		c.typeMismatch(n.Value, types.Subst(vt, bound), pt)
+		return t, false
+	}
+	if !n.Type.IsGeneric() {
+		return n.Type, true
+	}
+	args := make([]types.Type, len(n.Type.Params))
+	for i, p := range n.Type.Params {
+		if args[i], ok = bound[p]; !ok {
+			return
+		}
+	}
+	return types.InstantiateUnion(n.Type, args), true
+}
+
 func (c *Checker) typeMismatch(mn ast.MetaNode, want, got types.Type) {
 	c.errs <- typeMismatch(mn, want, got)
 }